@@ -0,0 +1,18 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/cmd"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/factory"
+)
+
+func main() {
+	err := cmd.NewCmdSecretFacade(factory.SecretManagerFactory{}).Execute()
+	if err != nil && !errors.Is(err, cmd.ErrDifferent) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	os.Exit(cmd.ExitCode(err))
+}
@@ -0,0 +1,200 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+)
+
+// Outcomes recorded in Event.Outcome
+const (
+	// OutcomeAttempt is recorded before a call which changes a secret is made, its outcome is recorded once it returns
+	OutcomeAttempt = "attempt"
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event records a single call made to a secret store. Secret values are never recorded
+type Event struct {
+	// Sequence numbers the events of a log starting at 1
+	Sequence   uint64                `json:"sequence"`
+	Time       time.Time             `json:"time"`
+	Actor      string                `json:"actor,omitempty"`
+	StoreType  secretstore.Type      `json:"storeType"`
+	Operation  secretstore.Operation `json:"operation"`
+	Location   string                `json:"location"`
+	SecretName string                `json:"secretName,omitempty"`
+	SecretKey  string                `json:"secretKey,omitempty"`
+	Version    string                `json:"version,omitempty"`
+	Outcome    string                `json:"outcome"`
+	Error      string                `json:"error,omitempty"`
+	// PrevHash is the Hash of the previous event, empty for the first event of a log
+	PrevHash string `json:"prevHash"`
+	// Hash is the hex encoded SHA-256 of the event without its Hash, or its HMAC-SHA256 if the log is written with a
+	// key, so modifying, removing or reordering events breaks the chain
+	Hash string `json:"hash,omitempty"`
+}
+
+// computeHash returns the hash of the event excluding its Hash field, using HMAC-SHA256 if key is not empty
+func (e *Event) computeHash(key []byte) (string, error) {
+	unhashed := *e
+	unhashed.Hash = ""
+	data, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	if len(key) > 0 {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Sink stores audit events
+type Sink interface {
+	Write(ctx context.Context, event *Event) error
+}
+
+// ResumableSink is implemented by sinks which can return the last event written so that a new Logger continues the
+// existing hash chain
+type ResumableSink interface {
+	Sink
+	LastEvent() (*Event, error)
+}
+
+// Options configures the audit Logger. A nil *Options uses the defaults
+type Options struct {
+	// DefaultActor is recorded when the context of a call has no actor set with WithActor
+	DefaultActor string
+	// Key is an HMAC key the events are hashed with. Without a key anyone able to edit the log can recompute the
+	// hash chain after tampering with it, with a key only holders of the key can
+	Key []byte
+}
+
+func (o *Options) key() []byte {
+	if o == nil {
+		return nil
+	}
+	return o.Key
+}
+
+// Logger writes hash chained audit events to a sink. It is safe for concurrent use
+type Logger struct {
+	sink    Sink
+	options *Options
+	now     func() time.Time
+
+	lock     sync.Mutex
+	sequence uint64
+	lastHash string
+}
+
+// NewLogger creates a Logger writing to sink. If sink is a ResumableSink the hash chain continues from its last event
+func NewLogger(sink Sink, options *Options) (*Logger, error) {
+	l := &Logger{sink: sink, options: options, now: time.Now}
+	if resumable, ok := sink.(ResumableSink); ok {
+		last, err := resumable.LastEvent()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the last audit event: %w", err)
+		}
+		if last != nil {
+			l.sequence = last.Sequence
+			l.lastHash = last.Hash
+		}
+	}
+	return l, nil
+}
+
+// Log completes the sequence, time, actor and hashes of the event and writes it to the sink
+func (l *Logger) Log(ctx context.Context, event *Event) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	event.Sequence = l.sequence + 1
+	event.Time = l.now().UTC()
+	if event.Actor == "" {
+		event.Actor = ActorFromContext(ctx)
+	}
+	if event.Actor == "" && l.options != nil {
+		event.Actor = l.options.DefaultActor
+	}
+	event.PrevHash = l.lastHash
+	hash, err := event.computeHash(l.options.key())
+	if err != nil {
+		return err
+	}
+	event.Hash = hash
+
+	err = l.sink.Write(ctx, event)
+	if err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	l.sequence = event.Sequence
+	l.lastHash = event.Hash
+	return nil
+}
+
+// Middleware records an audit event for every call made to a secret manager, so that no secret is read or changed
+// without an audit record of it. Calls which change secrets are recorded as an attempt before they are made, and are
+// not made if the attempt cannot be recorded, then their outcome is recorded. A change which was made is not reported
+// as failed if only its outcome cannot be recorded. Other calls fail if their event cannot be recorded, so no secret
+// value is returned without a record of it being read
+func Middleware(logger *Logger) secretstore.StoreMiddleware {
+	return func(storeType secretstore.Type) secretstore.Middleware {
+		return secretstore.Intercept(func(ctx context.Context, call *secretstore.Call, invoke func(ctx context.Context) error) error {
+			newEvent := func(outcome string) *Event {
+				return &Event{
+					StoreType:  storeType,
+					Operation:  call.Operation,
+					Location:   call.Location,
+					SecretName: call.SecretName,
+					SecretKey:  call.SecretKey,
+					Version:    call.Version,
+					Outcome:    outcome,
+				}
+			}
+			write := call.Operation.IsWrite()
+			if write {
+				if err := logger.Log(ctx, newEvent(OutcomeAttempt)); err != nil {
+					return err
+				}
+			}
+
+			err := invoke(ctx)
+			event := newEvent(OutcomeSuccess)
+			if err != nil {
+				event.Outcome = OutcomeFailure
+				event.Error = err.Error()
+			}
+			// the call is recorded even if it failed because the context was cancelled
+			logErr := logger.Log(context.WithoutCancel(ctx), event)
+			if logErr != nil && !write {
+				return errors.Join(err, logErr)
+			}
+			return err
+		})
+	}
+}
+
+type actorKey struct{}
+
+// WithActor returns a context recording actor as the identity making the calls in the audit log
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set with WithActor or an empty string
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
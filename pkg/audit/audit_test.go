@@ -0,0 +1,219 @@
+//go:build unit
+// +build unit
+
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/audit"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+// writeLog makes calls through an audited secret manager writing to sink
+func writeLog(t *testing.T, sink audit.Sink) {
+	writeLogWithOptions(t, sink, &audit.Options{DefaultActor: "pipeline"})
+}
+
+func writeLogWithOptions(t *testing.T, sink audit.Sink, options *audit.Options) {
+	logger, err := audit.NewLogger(sink, options)
+	require.NoError(t, err)
+	mgr := secretstore.Chain(fake.NewFakeSecretStore(), audit.Middleware(logger)(secretstore.SecretStoreTypeVault))
+	ctx := audit.WithActor(context.Background(), "alice")
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "loc", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"password": "super-secret"},
+	}))
+	value, err := mgr.GetSecretWithContext(ctx, "loc", "db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "super-secret", value)
+	_, err = mgr.GetSecret("loc", "missing", "")
+	require.Error(t, err)
+}
+
+func parseLog(t *testing.T, data string) []audit.Event {
+	var events []audit.Event
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		event := audit.Event{}
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestMiddlewareWritesHashChainedEvents(t *testing.T) {
+	var buf bytes.Buffer
+	writeLog(t, audit.NewWriterSink(&buf))
+
+	assert.NotContains(t, buf.String(), "super-secret")
+	events := parseLog(t, buf.String())
+	require.Len(t, events, 4)
+
+	assert.Equal(t, uint64(1), events[0].Sequence)
+	assert.Equal(t, "alice", events[0].Actor)
+	assert.Equal(t, secretstore.OperationSetSecret, events[0].Operation)
+	assert.Equal(t, secretstore.SecretStoreTypeVault, events[0].StoreType)
+	assert.Equal(t, audit.OutcomeAttempt, events[0].Outcome)
+	assert.Empty(t, events[0].PrevHash)
+	assert.Equal(t, secretstore.OperationSetSecret, events[1].Operation)
+	assert.Equal(t, audit.OutcomeSuccess, events[1].Outcome)
+	assert.Equal(t, events[0].Hash, events[1].PrevHash)
+	assert.Equal(t, "password", events[2].SecretKey)
+	assert.Equal(t, events[1].Hash, events[2].PrevHash)
+	assert.Equal(t, "pipeline", events[3].Actor)
+	assert.Equal(t, audit.OutcomeFailure, events[3].Outcome)
+	assert.NotEmpty(t, events[3].Error)
+
+	count, err := audit.Verify(&buf, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+}
+
+// failingSink fails to write events once failAfter events have been written
+type failingSink struct {
+	events    []*audit.Event
+	failAfter int
+}
+
+func (f *failingSink) Write(_ context.Context, event *audit.Event) error {
+	if len(f.events) >= f.failAfter {
+		return errors.New("sink unavailable")
+	}
+	f.events = append(f.events, event)
+	return nil
+}
+
+func TestMiddlewareFailsClosed(t *testing.T) {
+	ctx := context.Background()
+	store := fake.NewFakeSecretStore()
+	newManager := func(sink audit.Sink) secretstore.Interface {
+		logger, err := audit.NewLogger(sink, nil)
+		require.NoError(t, err)
+		return secretstore.Chain(store, audit.Middleware(logger)(secretstore.SecretStoreTypeVault))
+	}
+
+	// a write whose attempt cannot be recorded is not made
+	err := newManager(&failingSink{}).SetSecretWithContext(ctx, "loc", "db", &secretstore.SecretValue{Value: "a"})
+	assert.Error(t, err)
+	_, err = store.GetSecretValue(ctx, "loc", "db")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+
+	// a write which was made is not failed when only its outcome cannot be recorded
+	sink := &failingSink{failAfter: 1}
+	require.NoError(t, newManager(sink).SetSecretWithContext(ctx, "loc", "db", &secretstore.SecretValue{Value: "a"}))
+	require.Len(t, sink.events, 1)
+	assert.Equal(t, audit.OutcomeAttempt, sink.events[0].Outcome)
+
+	// a value is not returned if its read cannot be recorded
+	_, err = newManager(&failingSink{}).GetSecretWithContext(ctx, "loc", "db", "")
+	assert.Error(t, err)
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	var buf bytes.Buffer
+	writeLog(t, audit.NewWriterSink(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	testCases := map[string][]string{
+		"modified":  {lines[0], strings.Replace(lines[1], `"actor":"alice"`, `"actor":"bob"`, 1), lines[2]},
+		"removed":   {lines[0], lines[2]},
+		"reordered": {lines[1], lines[0], lines[2]},
+		"truncated": {lines[1], lines[2]},
+	}
+	for name, tampered := range testCases {
+		_, err := audit.Verify(strings.NewReader(strings.Join(tampered, "\n")), nil)
+		var verificationErr *audit.VerificationError
+		assert.True(t, errors.As(err, &verificationErr), name)
+	}
+}
+
+func TestVerifyAfterCheckpoint(t *testing.T) {
+	var buf bytes.Buffer
+	writeLog(t, audit.NewWriterSink(&buf))
+	events := parseLog(t, buf.String())
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	rotated := strings.NewReader(strings.Join(lines[1:], "\n"))
+
+	count, err := audit.Verify(rotated, &audit.VerifyOptions{After: &audit.Checkpoint{Sequence: 1, Hash: events[0].Hash}})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	err = audit.VerifyEvents(events[2:], &audit.VerifyOptions{After: &audit.Checkpoint{Sequence: 1, Hash: events[0].Hash}})
+	var verificationErr *audit.VerificationError
+	assert.True(t, errors.As(err, &verificationErr))
+}
+
+func TestVerifyWithKey(t *testing.T) {
+	key := []byte("audit-key")
+	var buf bytes.Buffer
+	writeLogWithOptions(t, audit.NewWriterSink(&buf), &audit.Options{Key: key})
+	events := parseLog(t, buf.String())
+
+	assert.NoError(t, audit.VerifyEvents(events, &audit.VerifyOptions{Key: key}))
+	assert.Error(t, audit.VerifyEvents(events, nil))
+	assert.Error(t, audit.VerifyEvents(events, &audit.VerifyOptions{Key: []byte("another-key")}))
+
+	// a log rewritten by someone without the key does not verify
+	var forged bytes.Buffer
+	writeLogWithOptions(t, audit.NewWriterSink(&forged), nil)
+	_, err := audit.Verify(&forged, &audit.VerifyOptions{Key: key})
+	var verificationErr *audit.VerificationError
+	assert.True(t, errors.As(err, &verificationErr))
+}
+
+func TestFileSinkContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		sink, err := audit.NewFileSink(path)
+		require.NoError(t, err)
+		writeLog(t, sink)
+		require.NoError(t, sink.Close())
+	}
+
+	sink, err := audit.NewFileSink(path)
+	require.NoError(t, err)
+	defer sink.Close()
+	last, err := sink.LastEvent()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(8), last.Sequence)
+}
+
+func TestKubernetesEventSink(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	object := corev1.ObjectReference{Kind: "Namespace", Name: "jx", Namespace: "jx"}
+	writeLog(t, audit.NewKubernetesEventSink(client, object))
+
+	list, err := client.CoreV1().Events("jx").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 4)
+	for _, k8sEvent := range list.Items {
+		event := audit.Event{}
+		require.NoError(t, json.Unmarshal([]byte(k8sEvent.Annotations[audit.EventAnnotation]), &event))
+		if event.Outcome == audit.OutcomeFailure {
+			assert.Equal(t, corev1.EventTypeWarning, k8sEvent.Type)
+		}
+	}
+
+	// another process continues the chain of the events of the object
+	writeLog(t, audit.NewKubernetesEventSink(client, object))
+	// the events of other objects form their own chain
+	writeLog(t, audit.NewKubernetesEventSink(client, corev1.ObjectReference{Kind: "Pod", Name: "runner", Namespace: "jx"}))
+
+	events, err := audit.NewKubernetesEventSink(client, object).Events(context.Background())
+	require.NoError(t, err)
+	require.Len(t, events, 8)
+	assert.Equal(t, uint64(8), events[7].Sequence)
+	assert.NoError(t, audit.VerifyEvents(events, nil))
+}
@@ -0,0 +1,203 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WriterSink writes each event as a line of JSON
+type WriterSink struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewWriterSink creates a sink writing JSON lines to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Write(_ context.Context, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+// FileSink appends events as JSON lines to a file, continuing the hash chain of the events already in the file
+type FileSink struct {
+	*WriterSink
+	path string
+	file *os.File
+}
+
+// NewFileSink opens or creates the audit log file at path
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	return &FileSink{WriterSink: NewWriterSink(file), path: path, file: file}, nil
+}
+
+// LastEvent returns the last event in the file or nil if the file is empty
+func (s *FileSink) LastEvent() (*Event, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", s.path, err)
+	}
+	defer f.Close()
+
+	var last string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			last = line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log %s: %w", s.path, err)
+	}
+	if last == "" {
+		return nil, nil
+	}
+	event := &Event{}
+	err = json.Unmarshal([]byte(last), event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the last event of audit log %s: %w", s.path, err)
+	}
+	return event, nil
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// EventAnnotation is the annotation holding the JSON of the audit event on Kubernetes Events
+const EventAnnotation = "secretfacade.jenkins-x.io/audit-event"
+
+// KubernetesEventSink records events as Kubernetes Events involving an object, typically the namespace or pod
+// making the calls. The JSON of the audit event is stored in the EventAnnotation annotation. Loggers writing to the
+// sink continue the hash chain of the Events already recorded for the object, so processes writing at the same time
+// should involve different objects, such as their pods
+type KubernetesEventSink struct {
+	client kubernetes.Interface
+	object corev1.ObjectReference
+	// Component is the source component of the Events, it defaults to secretfacade
+	Component string
+}
+
+// NewKubernetesEventSink creates a sink creating Events in the namespace of object
+func NewKubernetesEventSink(client kubernetes.Interface, object corev1.ObjectReference) *KubernetesEventSink {
+	return &KubernetesEventSink{client: client, object: object, Component: "secretfacade"}
+}
+
+func (s *KubernetesEventSink) Write(ctx context.Context, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	eventType := corev1.EventTypeNormal
+	if event.Outcome == OutcomeFailure {
+		eventType = corev1.EventTypeWarning
+	}
+	message := fmt.Sprintf("%s %s of secret %s in %s by %s: %s", event.StoreType, event.Operation, event.SecretName,
+		event.Location, event.Actor, event.Outcome)
+	namespace := s.namespace()
+	k8sEvent := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("secretfacade-audit.%d.%s", event.Sequence, event.Hash[:16]),
+			Namespace:   namespace,
+			Annotations: map[string]string{EventAnnotation: string(data)},
+		},
+		InvolvedObject: s.object,
+		Reason:         "Secret" + string(event.Operation),
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: s.Component},
+		FirstTimestamp: metav1.NewTime(event.Time),
+		LastTimestamp:  metav1.NewTime(event.Time),
+		Count:          1,
+	}
+	_, err = s.client.CoreV1().Events(namespace).Create(ctx, k8sEvent, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create audit Event: %w", err)
+	}
+	return nil
+}
+
+// Events returns the audit events recorded for the object of the sink ordered by sequence, to verify them with
+// VerifyEvents. Kubernetes deletes Events after a time to live, an hour by default, so once the first events have been
+// deleted the remaining events are verified with VerifyOptions.After set to the last event verified before
+func (s *KubernetesEventSink) Events(ctx context.Context) ([]Event, error) {
+	list, err := s.client.CoreV1().Events(s.namespace()).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit Events: %w", err)
+	}
+	var events []Event
+	for i := range list.Items {
+		k8sEvent := &list.Items[i]
+		data, ok := k8sEvent.Annotations[EventAnnotation]
+		if !ok || k8sEvent.Source.Component != s.Component || k8sEvent.InvolvedObject.Kind != s.object.Kind ||
+			k8sEvent.InvolvedObject.Name != s.object.Name {
+			continue
+		}
+		event := Event{}
+		err = json.Unmarshal([]byte(data), &event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse audit Event %s: %w", k8sEvent.Name, err)
+		}
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Sequence < events[j].Sequence
+	})
+	return events, nil
+}
+
+// LastEvent returns the last event recorded for the object of the sink or nil if there are none
+func (s *KubernetesEventSink) LastEvent() (*Event, error) {
+	events, err := s.Events(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+	return &events[len(events)-1], nil
+}
+
+func (s *KubernetesEventSink) namespace() string {
+	if s.object.Namespace == "" {
+		return metav1.NamespaceDefault
+	}
+	return s.object.Namespace
+}
+
+// MultiSink writes events to every sink, failing if any sink fails
+type MultiSink []Sink
+
+func (m MultiSink) Write(ctx context.Context, event *Event) error {
+	var errs []error
+	for _, sink := range m {
+		errs = append(errs, sink.Write(ctx, event))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxLineSize is the longest audit log line read
+const maxLineSize = 1024 * 1024
+
+// VerificationError reports where the hash chain of an audit log is broken
+type VerificationError struct {
+	// Line is the 1 based line of the audit log
+	Line   int
+	Reason string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("audit log verification failed at line %d: %s", e.Line, e.Reason)
+}
+
+// Checkpoint identifies an event of an audit log which has been verified before
+type Checkpoint struct {
+	Sequence uint64
+	Hash     string
+}
+
+// VerifyOptions configures Verify and VerifyEvents. A nil *VerifyOptions verifies a complete log written without a key
+type VerifyOptions struct {
+	// Key is the HMAC key the log was written with, see Options.Key
+	Key []byte
+	// After is the event the log continues from, for example the last event of an earlier log which has been rotated
+	// away or of Kubernetes Events which have expired. Without it the log must start with the first event
+	After *Checkpoint
+}
+
+func (o *VerifyOptions) key() []byte {
+	if o == nil {
+		return nil
+	}
+	return o.Key
+}
+
+// first returns the checkpoint the first event follows, the zero Checkpoint for a log starting with the first event
+func (o *VerifyOptions) first() Checkpoint {
+	if o == nil || o.After == nil {
+		return Checkpoint{}
+	}
+	return *o.After
+}
+
+// Verify checks the hash chain of an audit log of JSON lines, as written by WriterSink and FileSink, and returns the
+// number of events verified. Editing, removing, inserting or reordering events results in a *VerificationError.
+// Removing events from the end of the log cannot be detected from the log alone, so compare the returned count or the
+// hash of the last event with a copy kept elsewhere. Unless the log is written with a key, someone able to rewrite the
+// whole log can also recompute its hashes, so keep a copy of a recent hash elsewhere and pass it as After
+func Verify(r io.Reader, options *VerifyOptions) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	previous := options.first()
+	count := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		event := &Event{}
+		err := json.Unmarshal([]byte(text), event)
+		if err != nil {
+			return count, &VerificationError{Line: line, Reason: fmt.Sprintf("invalid event: %s", err)}
+		}
+		err = verifyEvent(previous, event, options.key())
+		if err != nil {
+			return count, &VerificationError{Line: line, Reason: err.Error()}
+		}
+		previous = Checkpoint{Sequence: event.Sequence, Hash: event.Hash}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return count, nil
+}
+
+// VerifyEvents checks the hash chain of events, such as those read from Kubernetes Events, ordered by sequence
+func VerifyEvents(events []Event, options *VerifyOptions) error {
+	previous := options.first()
+	for i := range events {
+		err := verifyEvent(previous, &events[i], options.key())
+		if err != nil {
+			return &VerificationError{Line: i + 1, Reason: err.Error()}
+		}
+		previous = Checkpoint{Sequence: events[i].Sequence, Hash: events[i].Hash}
+	}
+	return nil
+}
+
+// verifyEvent checks the event has not been modified and follows previous, which is the zero Checkpoint for the
+// first event of a log
+func verifyEvent(previous Checkpoint, event *Event, key []byte) error {
+	hash, err := event.computeHash(key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(hash), []byte(event.Hash)) {
+		return fmt.Errorf("event %d has been modified", event.Sequence)
+	}
+	if event.Sequence != previous.Sequence+1 {
+		return fmt.Errorf("expected event %d but found event %d", previous.Sequence+1, event.Sequence)
+	}
+	if event.PrevHash != previous.Hash {
+		return fmt.Errorf("event %d does not follow event %d", event.Sequence, previous.Sequence)
+	}
+	return nil
+}
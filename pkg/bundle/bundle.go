@@ -0,0 +1,289 @@
+package bundle
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// FormatVersion is the version of the bundle format written by Export
+const FormatVersion = 1
+
+// ErrChecksumMismatch is returned when a secret in a bundle does not match the checksum in its manifest
+var ErrChecksumMismatch = errors.New("bundle checksum mismatch")
+
+// Bundle is a set of secrets exported from one location. Bundles are written encrypted with age, so they can also be
+// decrypted with the age command line tool, and the age keys used with sops work for bundles too
+type Bundle struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// StoreType and Location are where the secrets were exported from
+	StoreType secretstore.Type `json:"storeType,omitempty"`
+	Location  string           `json:"location"`
+	Secrets   []Secret         `json:"secrets"`
+	Manifest  Manifest         `json:"manifest"`
+}
+
+// Secret is a secret in a bundle with its metadata
+type Secret struct {
+	Name        string            `json:"name"`
+	Value       string            `json:"value,omitempty"`
+	Properties  map[string]string `json:"properties,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Type        corev1.SecretType `json:"type,omitempty"`
+}
+
+// Manifest holds the SHA-256 checksum of every secret in a bundle, keyed by secret name
+type Manifest struct {
+	Checksums map[string]string `json:"checksums"`
+}
+
+// SecretValue returns the value to write when importing the secret
+func (s *Secret) SecretValue() *secretstore.SecretValue {
+	return &secretstore.SecretValue{
+		Value:          s.Value,
+		PropertyValues: s.Properties,
+		Labels:         s.Labels,
+		Annotations:    s.Annotations,
+		SecretType:     s.Type,
+		Overwrite:      true,
+	}
+}
+
+// Checksum returns the hex encoded SHA-256 checksum of the secret and its metadata
+func (s *Secret) Checksum() (string, error) {
+	// encoding/json sorts map keys so the encoding is stable
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("error encoding secret %s: %w", s.Name, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify checks that the manifest lists exactly the secrets of the bundle with matching checksums
+func (b *Bundle) Verify() error {
+	if b.Version != FormatVersion {
+		return fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	var errs []error
+	names := map[string]bool{}
+	for i := range b.Secrets {
+		secret := &b.Secrets[i]
+		names[secret.Name] = true
+		checksum, err := secret.Checksum()
+		if err != nil {
+			return err
+		}
+		expected, ok := b.Manifest.Checksums[secret.Name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("secret %s is missing from the manifest: %w", secret.Name, ErrChecksumMismatch))
+		case expected != checksum:
+			errs = append(errs, fmt.Errorf("secret %s does not match its checksum: %w", secret.Name, ErrChecksumMismatch))
+		}
+	}
+	for name := range b.Manifest.Checksums {
+		if !names[name] {
+			errs = append(errs, fmt.Errorf("secret %s in the manifest is missing from the bundle: %w", name, ErrChecksumMismatch))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ExportOptions selects the secrets to export. A nil *ExportOptions exports every secret of the location
+type ExportOptions struct {
+	// Prefix only exports the secrets whose name starts with the prefix
+	Prefix string
+	// Names only exports the named secrets
+	Names []string
+	// StoreType is recorded in the bundle
+	StoreType secretstore.Type
+}
+
+// Export reads the secrets of a location in to a bundle
+func Export(ctx context.Context, mgr secretstore.Interface, location string, options *ExportOptions) (*Bundle, error) {
+	if options == nil {
+		options = &ExportOptions{}
+	}
+	names := options.Names
+	if len(names) == 0 {
+		var err error
+		names, err = mgr.ListSecrets(ctx, location, &secretstore.ListOptions{Prefix: options.Prefix}).Names()
+		if err != nil {
+			return nil, fmt.Errorf("error listing secrets to export in %s: %w", location, err)
+		}
+	}
+	sort.Strings(names)
+
+	b := &Bundle{
+		Version:   FormatVersion,
+		CreatedAt: time.Now().UTC(),
+		StoreType: options.StoreType,
+		Location:  location,
+		Manifest:  Manifest{Checksums: map[string]string{}},
+	}
+	for _, name := range names {
+		value, err := mgr.GetSecretValue(ctx, location, name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading secret %s in %s to export: %w", name, location, err)
+		}
+		secret := Secret{
+			Name:        name,
+			Value:       value.Value,
+			Properties:  value.PropertyValues,
+			Labels:      value.Labels,
+			Annotations: value.Annotations,
+			Type:        value.SecretType,
+		}
+		b.Manifest.Checksums[name], err = secret.Checksum()
+		if err != nil {
+			return nil, err
+		}
+		b.Secrets = append(b.Secrets, secret)
+	}
+	return b, nil
+}
+
+// ImportResult is the outcome of importing a single secret
+type ImportResult struct {
+	Name string
+	// Skipped is set when the secret already existed and was not overwritten
+	Skipped bool
+	Err     error
+}
+
+// ImportOptions configures Import. A nil *ImportOptions uses the defaults
+type ImportOptions struct {
+	// Overwrite replaces secrets which already exist, which are skipped otherwise
+	Overwrite bool
+	// Names only imports the named secrets
+	Names []string
+}
+
+// Import verifies the bundle and writes its secrets to a location, which does not have to be in the same kind of
+// secret store the bundle was exported from. Without Overwrite secrets are created with CreateOnly, so a secret created
+// by another writer during the import is skipped rather than replaced. Nothing is written if the bundle fails
+// verification, otherwise the returned error joins the errors of the secrets which could not be imported
+func Import(ctx context.Context, mgr secretstore.Interface, location string, b *Bundle, options *ImportOptions) ([]ImportResult, error) {
+	if options == nil {
+		options = &ImportOptions{}
+	}
+	if err := b.Verify(); err != nil {
+		return nil, err
+	}
+	include := map[string]bool{}
+	for _, name := range options.Names {
+		include[name] = true
+	}
+
+	var results []ImportResult
+	var errs []error
+	for i := range b.Secrets {
+		secret := &b.Secrets[i]
+		if len(include) > 0 && !include[secret.Name] {
+			continue
+		}
+		result := ImportResult{Name: secret.Name}
+		secretValue := secret.SecretValue()
+		secretValue.CreateOnly = !options.Overwrite
+		err := mgr.SetSecretWithContext(ctx, location, secret.Name, secretValue)
+		if errors.Is(err, secretstore.ErrNotSupported) && secretValue.CreateOnly {
+			err = importIfMissing(ctx, mgr, location, secret)
+		}
+		switch {
+		case errors.Is(err, secretstore.ErrAlreadyExists):
+			result.Skipped = true
+		case err != nil:
+			result.Err = fmt.Errorf("error importing secret %s to %s: %w", secret.Name, location, err)
+		}
+		errs = append(errs, result.Err)
+		results = append(results, result)
+	}
+	return results, errors.Join(errs...)
+}
+
+// importIfMissing writes the secret to secret stores which cannot create secrets only if they do not exist, such as
+// Azure Key Vault and sops files, if it did not exist when it was read. A secret created by another writer between the
+// read and the write is overwritten
+func importIfMissing(ctx context.Context, mgr secretstore.Interface, location string, secret *Secret) error {
+	_, err := mgr.GetSecretValue(ctx, location, secret.Name)
+	switch {
+	case err == nil:
+		return secretstore.NewAlreadyExistsError(location, secret.Name)
+	case !errors.Is(err, secretstore.ErrSecretNotFound):
+		return fmt.Errorf("error checking whether secret %s exists in %s: %w", secret.Name, location, err)
+	}
+	return mgr.SetSecretWithContext(ctx, location, secret.Name, secret.SecretValue())
+}
+
+// Encrypt writes the bundle encrypted to the age recipients, in the ASCII armored format if armored is set
+func (b *Bundle) Encrypt(w io.Writer, armored bool, recipients ...age.Recipient) error {
+	if len(recipients) == 0 {
+		return fmt.Errorf("no recipients to encrypt the bundle to")
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("error encoding bundle: %w", err)
+	}
+	var armorWriter io.WriteCloser
+	if armored {
+		armorWriter = armor.NewWriter(w)
+		w = armorWriter
+	}
+	encrypted, err := age.Encrypt(w, recipients...)
+	if err != nil {
+		return fmt.Errorf("error encrypting bundle: %w", err)
+	}
+	if _, err := encrypted.Write(data); err != nil {
+		return fmt.Errorf("error encrypting bundle: %w", err)
+	}
+	if err := encrypted.Close(); err != nil {
+		return fmt.Errorf("error encrypting bundle: %w", err)
+	}
+	if armorWriter != nil {
+		if err := armorWriter.Close(); err != nil {
+			return fmt.Errorf("error encrypting bundle: %w", err)
+		}
+	}
+	return nil
+}
+
+// Decrypt reads a bundle written by Encrypt, armored or not, and verifies it
+func Decrypt(r io.Reader, identities ...age.Identity) (*Bundle, error) {
+	buffered := bufio.NewReader(r)
+	if start, _ := buffered.Peek(len(armor.Header)); string(start) == armor.Header {
+		r = armor.NewReader(buffered)
+	} else {
+		r = buffered
+	}
+	decrypted, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting bundle: %w", err)
+	}
+	data, err := io.ReadAll(decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting bundle: %w", err)
+	}
+	b := &Bundle{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("error decoding bundle: %w", err)
+	}
+	if err := b.Verify(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,153 @@
+//go:build unit
+// +build unit
+
+package bundle_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/bundle"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func newStore(t *testing.T) *fake.SecretStore {
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("jx", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin", "password": "hunter2"},
+		Labels:         map[string]string{"team": "data"},
+		Annotations:    map[string]string{"owner": "data@example.com"},
+		SecretType:     corev1.SecretTypeBasicAuth,
+	}))
+	require.NoError(t, store.SetSecret("jx", "webhook", &secretstore.SecretValue{Value: "hmac"}))
+	return store
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	for _, armored := range []bool{false, true} {
+		b, err := bundle.Export(ctx, newStore(t), "jx", &bundle.ExportOptions{StoreType: secretstore.SecretStoreTypeKubernetes})
+		require.NoError(t, err)
+		require.Len(t, b.Secrets, 2)
+		assert.Len(t, b.Manifest.Checksums, 2)
+
+		encrypted := &bytes.Buffer{}
+		require.NoError(t, b.Encrypt(encrypted, armored, identity.Recipient()))
+		assert.NotContains(t, encrypted.String(), "hunter2")
+		assert.Equal(t, armored, strings.HasPrefix(encrypted.String(), "-----BEGIN AGE ENCRYPTED FILE-----"))
+
+		decrypted, err := bundle.Decrypt(encrypted, identity)
+		require.NoError(t, err)
+		assert.Equal(t, secretstore.SecretStoreTypeKubernetes, decrypted.StoreType)
+
+		target := fake.NewFakeSecretStore()
+		results, err := bundle.Import(ctx, target, "restored", decrypted, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []bundle.ImportResult{{Name: "db"}, {Name: "webhook"}}, results)
+
+		value, err := target.GetSecretValue(ctx, "restored", "db")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"username": "admin", "password": "hunter2"}, value.PropertyValues)
+		assert.Equal(t, map[string]string{"team": "data"}, value.Labels)
+		assert.Equal(t, map[string]string{"owner": "data@example.com"}, value.Annotations)
+		assert.Equal(t, corev1.SecretTypeBasicAuth, value.SecretType)
+	}
+}
+
+func TestImportSkipsExisting(t *testing.T) {
+	ctx := context.Background()
+	b, err := bundle.Export(ctx, newStore(t), "jx", &bundle.ExportOptions{Names: []string{"webhook"}})
+	require.NoError(t, err)
+	target := fake.NewFakeSecretStore()
+	require.NoError(t, target.SetSecret("jx", "webhook", &secretstore.SecretValue{Value: "newer"}))
+
+	results, err := bundle.Import(ctx, target, "jx", b, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []bundle.ImportResult{{Name: "webhook", Skipped: true}}, results)
+	value, err := target.GetSecret("jx", "webhook", "")
+	require.NoError(t, err)
+	assert.Equal(t, "newer", value)
+
+	_, err = bundle.Import(ctx, target, "jx", b, &bundle.ImportOptions{Overwrite: true})
+	require.NoError(t, err)
+	value, err = target.GetSecret("jx", "webhook", "")
+	require.NoError(t, err)
+	assert.Equal(t, "hmac", value)
+}
+
+// noCreateOnlyStore cannot create secrets only if they do not exist, as Azure Key Vault and sops files cannot
+type noCreateOnlyStore struct {
+	*fake.SecretStore
+}
+
+func (n noCreateOnlyStore) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	if secretValue.CreateOnly {
+		return secretstore.ErrNotSupported
+	}
+	return n.SecretStore.SetSecretWithContext(ctx, location, secretName, secretValue)
+}
+
+func TestImportWithoutCreateOnly(t *testing.T) {
+	ctx := context.Background()
+	b, err := bundle.Export(ctx, newStore(t), "jx", nil)
+	require.NoError(t, err)
+	target := noCreateOnlyStore{fake.NewFakeSecretStore()}
+	require.NoError(t, target.SetSecret("jx", "webhook", &secretstore.SecretValue{Value: "newer"}))
+
+	results, err := bundle.Import(ctx, target, "jx", b, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for _, result := range results {
+		assert.Equal(t, result.Name == "webhook", result.Skipped, result.Name)
+	}
+	value, err := target.GetSecret("jx", "webhook", "")
+	require.NoError(t, err)
+	assert.Equal(t, "newer", value)
+	value, err = target.GetSecret("jx", "db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", value)
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	b, err := bundle.Export(ctx, newStore(t), "jx", nil)
+	require.NoError(t, err)
+	require.NoError(t, b.Verify())
+
+	b.Secrets[0].Properties["password"] = "tampered"
+	assert.ErrorIs(t, b.Verify(), bundle.ErrChecksumMismatch)
+	target := fake.NewFakeSecretStore()
+	_, err = bundle.Import(ctx, target, "jx", b, nil)
+	assert.ErrorIs(t, err, bundle.ErrChecksumMismatch)
+	_, err = target.GetSecretValue(ctx, "jx", "webhook")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+
+	b, err = bundle.Export(ctx, newStore(t), "jx", nil)
+	require.NoError(t, err)
+	b.Secrets = b.Secrets[:1]
+	assert.ErrorIs(t, b.Verify(), bundle.ErrChecksumMismatch)
+}
+
+func TestDecryptWithWrongIdentity(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	other, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	b, err := bundle.Export(context.Background(), newStore(t), "jx", nil)
+	require.NoError(t, err)
+	encrypted := &bytes.Buffer{}
+	require.NoError(t, b.Encrypt(encrypted, false, identity.Recipient()))
+
+	_, err = bundle.Decrypt(encrypted, other)
+	assert.Error(t, err)
+}
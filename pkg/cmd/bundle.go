@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/bundle"
+	"github.com/spf13/cobra"
+)
+
+func newCmdExport(o *Options) *cobra.Command {
+	var file string
+	var recipients, recipientFiles, names []string
+	armored := false
+	cmd := &cobra.Command{
+		Use:   "export LOCATION",
+		Short: "Exports the secrets of a location to an age encrypted bundle",
+		Example: `  # back up every secret of a namespace
+  secretfacade export k8s://jx -f jx.age --recipient age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p`,
+		Args: exactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ref, err := parseLocation(args[0])
+			if err != nil {
+				return err
+			}
+			parsed, err := parseRecipients(recipients, recipientFiles)
+			if err != nil {
+				return err
+			}
+			mgr, err := o.manager(ref)
+			if err != nil {
+				return err
+			}
+			b, err := bundle.Export(cmd.Context(), mgr, ref.Location, &bundle.ExportOptions{
+				Prefix:    ref.SecretName,
+				Names:     names,
+				StoreType: ref.StoreType,
+			})
+			if err != nil {
+				return err
+			}
+			encrypt := func(out io.Writer) error {
+				return b.Encrypt(out, armored, parsed...)
+			}
+			if file == "" || file == "-" {
+				return encrypt(cmd.OutOrStdout())
+			}
+			return writeFile(file, encrypt)
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "-", "the bundle file to write, - for standard output")
+	cmd.Flags().StringArrayVarP(&recipients, "recipient", "r", nil, "an age public key to encrypt the bundle to, can be repeated")
+	cmd.Flags().StringArrayVarP(&recipientFiles, "recipients-file", "R", nil, "a file of age public keys to encrypt the bundle to, can be repeated")
+	cmd.Flags().StringArrayVar(&names, "name", nil, "only export the named secret, can be repeated")
+	cmd.Flags().BoolVarP(&armored, "armor", "a", false, "write the bundle in the ASCII armored format")
+	return cmd
+}
+
+func newCmdImport(o *Options) *cobra.Command {
+	var file string
+	var identityFiles, names []string
+	overwrite := false
+	cmd := &cobra.Command{
+		Use:   "import LOCATION",
+		Short: "Imports the secrets of an age encrypted bundle to a location",
+		Long: `Imports the secrets of an age encrypted bundle to a location, which can be in a different secret store to the one
+the bundle was exported from. Secrets which already exist are skipped unless --overwrite is set. The identity defaults
+to the file in $SOPS_AGE_KEY_FILE so that the same keys can be used as for sops.`,
+		Example: `  # restore a backup to GCP Secret Manager
+  secretfacade import gsm://my-project -f jx.age --identity key.txt`,
+		Args: exactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ref, err := parseLocation(args[0])
+			if err != nil {
+				return err
+			}
+			if len(identityFiles) == 0 && os.Getenv("SOPS_AGE_KEY_FILE") != "" {
+				identityFiles = []string{os.Getenv("SOPS_AGE_KEY_FILE")}
+			}
+			if len(identityFiles) == 0 {
+				return usageErrorf("missing --identity")
+			}
+			var identities []age.Identity
+			for _, path := range identityFiles {
+				parsed, err := readAgeFile(path, age.ParseIdentities)
+				if err != nil {
+					return err
+				}
+				identities = append(identities, parsed...)
+			}
+
+			in := cmd.InOrStdin()
+			if file != "" && file != "-" {
+				f, err := os.Open(file)
+				if err != nil {
+					return fmt.Errorf("error reading bundle %s: %w", file, err)
+				}
+				defer f.Close()
+				in = f
+			}
+			b, err := bundle.Decrypt(in, identities...)
+			if err != nil {
+				return err
+			}
+			mgr, err := o.manager(ref)
+			if err != nil {
+				return err
+			}
+			results, err := bundle.Import(cmd.Context(), mgr, ref.Location, b, &bundle.ImportOptions{Overwrite: overwrite, Names: names})
+			out := cmd.OutOrStdout()
+			for _, result := range results {
+				switch {
+				case result.Err != nil:
+					fmt.Fprintf(out, "failed %s: %v\n", result.Name, result.Err)
+				case result.Skipped:
+					fmt.Fprintf(out, "skipped %s\n", result.Name)
+				default:
+					fmt.Fprintf(out, "imported %s\n", result.Name)
+				}
+			}
+			return err
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "-", "the bundle file to read, - for standard input")
+	cmd.Flags().StringArrayVarP(&identityFiles, "identity", "i", nil, "an age identity file to decrypt the bundle with, can be repeated")
+	cmd.Flags().StringArrayVar(&names, "name", nil, "only import the named secret, can be repeated")
+	cmd.Flags().BoolVar(&overwrite, "overwrite", false, "replace secrets which already exist")
+	return cmd
+}
+
+// writeFile writes path with write through a temporary file in the same directory which is only renamed to path once
+// it has been written and closed, so that a failed write does not leave a truncated file behind
+func writeFile(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("error creating bundle %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	err = write(tmp)
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("error writing bundle %s: %w", path, closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("error writing bundle %s: %w", path, err)
+	}
+	return nil
+}
+
+func parseRecipients(recipients, files []string) ([]age.Recipient, error) {
+	var parsed []age.Recipient
+	for _, r := range recipients {
+		recipient, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return nil, usageError{fmt.Errorf("invalid recipient %q: %w", r, err)}
+		}
+		parsed = append(parsed, recipient)
+	}
+	for _, path := range files {
+		fromFile, err := readAgeFile(path, age.ParseRecipients)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, fromFile...)
+	}
+	if len(parsed) == 0 {
+		return nil, usageErrorf("missing --recipient or --recipients-file")
+	}
+	return parsed, nil
+}
+
+// readAgeFile parses a file of age keys with parse, such as age.ParseIdentities
+func readAgeFile[T any](path string, parse func(io.Reader) ([]T, error)) ([]T, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	defer f.Close()
+	parsed, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,196 @@
+//go:build unit
+// +build unit
+
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/cmd"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFactory(t *testing.T) (*fake.SecretManagerFactory, *fake.SecretStore) {
+	factory := &fake.SecretManagerFactory{}
+	_, err := factory.NewSecretManager(secretstore.SecretStoreTypeKubernetes)
+	require.NoError(t, err)
+	return factory, factory.GetSecretStore()
+}
+
+// run executes the command returning its output and exit code
+func run(factory secretstore.FactoryInterface, stdin string, args ...string) (string, int) {
+	c := cmd.NewCmdSecretFacade(factory)
+	out := &bytes.Buffer{}
+	c.SetOut(out)
+	c.SetIn(strings.NewReader(stdin))
+	c.SetArgs(args)
+	code := cmd.ExitCode(c.Execute())
+	return out.String(), code
+}
+
+func TestGetAndSet(t *testing.T) {
+	factory, store := newFactory(t)
+
+	_, code := run(factory, "", "set", "k8s://jx/db#password", "--value", "hunter2")
+	require.Equal(t, cmd.ExitOK, code)
+	_, code = run(factory, "admin\n", "set", "k8s://jx/db#username", "--stdin", "-p", "password=hunter2", "--label", "team=data")
+	require.Equal(t, cmd.ExitOK, code)
+
+	out, code := run(factory, "", "get", "k8s://jx/db#password")
+	assert.Equal(t, cmd.ExitOK, code)
+	assert.Equal(t, "hunter2\n", out)
+
+	out, code = run(factory, "", "get", "k8s://jx/db")
+	assert.Equal(t, cmd.ExitOK, code)
+	assert.Equal(t, "password=hunter2\nusername=admin\n", out)
+
+	out, code = run(factory, "", "get", "k8s://jx/db", "-o", "json")
+	assert.Equal(t, cmd.ExitOK, code)
+	assert.JSONEq(t, `{"location":"jx","name":"db","properties":{"password":"hunter2","username":"admin"},"labels":{"team":"data"},"version":"2"}`, out)
+
+	out, code = run(factory, "", "get", "k8s://jx/db#username", "-o", "yaml")
+	assert.Equal(t, cmd.ExitOK, code)
+	assert.Equal(t, "username: admin\n", out)
+
+	_, code = run(factory, "", "get", "k8s://jx/missing")
+	assert.Equal(t, cmd.ExitSecretNotFound, code)
+	_, code = run(factory, "", "get", "k8s://jx/db#missing")
+	assert.Equal(t, cmd.ExitKeyNotFound, code)
+	_, code = run(factory, "", "get", "k8s://jx/db", "-o", "xml")
+	assert.Equal(t, cmd.ExitUsage, code)
+	_, code = run(factory, "", "set", "k8s://jx/db#password", "--value", "x", "--expected-version", "1")
+	assert.Equal(t, cmd.ExitConflict, code)
+
+	value, err := store.GetSecretValue(context.Background(), "jx", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "hunter2", "username": "admin"}, value.PropertyValues)
+}
+
+func TestSetFromFiles(t *testing.T) {
+	factory, store := newFactory(t)
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls.crt")
+	require.NoError(t, os.WriteFile(certPath, []byte("certificate"), 0o600))
+	envPath := filepath.Join(dir, "app.env")
+	require.NoError(t, os.WriteFile(envPath, []byte(`# app settings
+export DB_HOST=db.example.com
+DB_PASSWORD="multi\nline"
+GREETING='hello world'
+`), 0o600))
+
+	_, code := run(factory, "", "set", "k8s://jx/app", "--from-file", certPath, "--from-file", "key="+certPath,
+		"--from-env-file", envPath, "-p", "extra=1", "--type", "kubernetes.io/tls")
+	require.Equal(t, cmd.ExitOK, code)
+
+	value, err := store.GetSecretValue(context.Background(), "jx", "app")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"tls.crt":     "certificate",
+		"key":         "certificate",
+		"DB_HOST":     "db.example.com",
+		"DB_PASSWORD": "multi\nline",
+		"GREETING":    "hello world",
+		"extra":       "1",
+	}, value.PropertyValues)
+	assert.Equal(t, "kubernetes.io/tls", string(value.SecretType))
+
+	_, code = run(factory, "", "set", "k8s://jx/app")
+	assert.Equal(t, cmd.ExitUsage, code)
+	_, code = run(factory, "", "set", "k8s://jx/app", "--value", "plain", "-p", "a=b")
+	assert.Equal(t, cmd.ExitUsage, code)
+}
+
+func TestListDeleteCopyAndDiff(t *testing.T) {
+	factory, store := newFactory(t)
+	require.NoError(t, store.SetSecret("jx", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "hunter2", "username": "admin"}}))
+	require.NoError(t, store.SetSecret("jx", "webhook", &secretstore.SecretValue{Value: "hmac"}))
+
+	out, code := run(factory, "", "list", "k8s://jx")
+	assert.Equal(t, cmd.ExitOK, code)
+	assert.Equal(t, "db\nwebhook\n", out)
+
+	_, code = run(factory, "", "copy", "k8s://jx/db", "k8s://jx-staging/db")
+	require.Equal(t, cmd.ExitOK, code)
+	_, code = run(factory, "", "copy", "k8s://jx/db#password", "k8s://jx-staging/app#db-password")
+	require.Equal(t, cmd.ExitOK, code)
+
+	out, code = run(factory, "", "diff", "k8s://jx/db", "k8s://jx-staging/db")
+	assert.Equal(t, cmd.ExitOK, code)
+	assert.Empty(t, out)
+	_, code = run(factory, "", "diff", "k8s://jx/db#password", "k8s://jx-staging/app#db-password")
+	assert.Equal(t, cmd.ExitOK, code)
+
+	_, code = run(factory, "", "set", "k8s://jx-staging/db#password", "--value", "changed", "-p", "username=admin")
+	require.Equal(t, cmd.ExitOK, code)
+	out, code = run(factory, "", "diff", "k8s://jx/db", "k8s://jx-staging/db", "-o", "json")
+	assert.Equal(t, cmd.ExitDifferent, code)
+	assert.JSONEq(t, `{"differences":["password"]}`, out)
+
+	_, code = run(factory, "", "delete", "k8s://jx/webhook")
+	assert.Equal(t, cmd.ExitOK, code)
+	_, code = run(factory, "", "delete", "k8s://jx/webhook")
+	assert.Equal(t, cmd.ExitSecretNotFound, code)
+	_, code = run(factory, "", "delete")
+	assert.Equal(t, cmd.ExitUsage, code)
+}
+
+func TestExportImport(t *testing.T) {
+	factory, store := newFactory(t)
+	require.NoError(t, store.SetSecret("jx", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "hunter2"}}))
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	identityPath := filepath.Join(dir, "key.txt")
+	require.NoError(t, os.WriteFile(identityPath, []byte(identity.String()+"\n"), 0o600))
+	bundlePath := filepath.Join(dir, "jx.age")
+
+	_, code := run(factory, "", "export", "k8s://jx", "-f", bundlePath, "-r", identity.Recipient().String())
+	require.Equal(t, cmd.ExitOK, code)
+	out, code := run(factory, "", "import", "k8s://restored", "-f", bundlePath, "-i", identityPath)
+	require.Equal(t, cmd.ExitOK, code)
+	assert.Equal(t, "imported db\n", out)
+
+	value, err := store.GetSecretValue(context.Background(), "restored", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "hunter2"}, value.PropertyValues)
+
+	_, code = run(factory, "", "export", "k8s://jx", "-f", bundlePath)
+	assert.Equal(t, cmd.ExitUsage, code)
+}
+
+func TestExportReplacesBundle(t *testing.T) {
+	factory, store := newFactory(t)
+	require.NoError(t, store.SetSecret("jx", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "hunter2"}}))
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	bundlePath := filepath.Join(dir, "jx.age")
+	require.NoError(t, os.WriteFile(bundlePath, []byte("an older and longer bundle which is replaced"), 0o600))
+
+	_, code := run(factory, "", "export", "k8s://jx", "-f", bundlePath, "-r", identity.Recipient().String(), "--armor")
+	require.Equal(t, cmd.ExitOK, code)
+
+	data, err := os.ReadFile(bundlePath)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "-----BEGIN AGE ENCRYPTED FILE-----"))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the temporary file is renamed to the bundle")
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, cmd.ExitOK, cmd.ExitCode(nil))
+	assert.Equal(t, cmd.ExitError, cmd.ExitCode(errors.New("boom")))
+	assert.Equal(t, cmd.ExitPermissionDenied, cmd.ExitCode(secretstore.NewError(secretstore.ErrPermissionDenied, "jx", "db", nil)))
+	assert.Equal(t, cmd.ExitCanceled, cmd.ExitCode(context.Canceled))
+}
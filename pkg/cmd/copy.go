@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/spf13/cobra"
+)
+
+func newCmdCopy(o *Options) *cobra.Command {
+	overwrite := false
+	cmd := &cobra.Command{
+		Use:   "copy SOURCE TARGET",
+		Short: "Copies a secret, or one key of it, to another location or secret store",
+		Long: `Copies a secret, or one key of it, to another location or secret store. A whole secret is copied with its
+labels, annotations and type, its properties, labels and annotations are merged in to those of the target unless
+--overwrite is set, which replaces them. A key is copied to the key of the target reference, which defaults to the same key.`,
+		Example: `  # copy a Kubernetes secret to GCP Secret Manager
+  secretfacade copy k8s://jx/db-creds gsm://my-project/db-creds
+
+  # copy one key to a key with a different name
+  secretfacade copy vault://vault.example.com:8200/secret/jx/db#password k8s://jx/app#db-password`,
+		Args: exactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			source, err := parseRef(args[0])
+			if err != nil {
+				return err
+			}
+			target, err := parseRef(args[1])
+			if err != nil {
+				return err
+			}
+			sourceMgr, err := o.manager(source)
+			if err != nil {
+				return err
+			}
+			targetMgr, err := o.manager(target)
+			if err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			var value *secretstore.SecretValue
+			if source.SecretKey != "" {
+				key := target.SecretKey
+				if key == "" {
+					key = source.SecretKey
+				}
+				v, err := sourceMgr.GetSecretWithContext(ctx, source.Location, source.SecretName, source.SecretKey)
+				if err != nil {
+					return err
+				}
+				value = &secretstore.SecretValue{PropertyValues: map[string]string{key: v}}
+			} else {
+				if target.SecretKey != "" {
+					return usageErrorf("a whole secret cannot be copied to the key %s, add a #key to the source", target.SecretKey)
+				}
+				value, err = sourceMgr.GetSecretValue(ctx, source.Location, source.SecretName)
+				if err != nil {
+					return err
+				}
+				value.Version = ""
+				value.Overwrite = overwrite
+			}
+			return targetMgr.SetSecretWithContext(ctx, target.Location, target.SecretName, value)
+		},
+	}
+	cmd.Flags().BoolVar(&overwrite, "overwrite", false, "replace the existing properties, labels and annotations of the target instead of merging in to them")
+	return cmd
+}
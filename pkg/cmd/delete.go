@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/spf13/cobra"
+)
+
+func newCmdDelete(o *Options) *cobra.Command {
+	options := &secretstore.DeleteOptions{}
+	cmd := &cobra.Command{
+		Use:   "delete REF",
+		Short: "Deletes a secret",
+		Example: `  # delete an AWS secret without a recovery window
+  secretfacade delete asm://eu-west-1/db-creds --force`,
+		Args: exactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ref, err := parseRef(args[0])
+			if err != nil {
+				return err
+			}
+			if ref.SecretKey != "" {
+				return usageErrorf("delete removes whole secrets, remove the #%s key from the reference", ref.SecretKey)
+			}
+			mgr, err := o.manager(ref)
+			if err != nil {
+				return err
+			}
+			return mgr.DeleteSecret(cmd.Context(), ref.Location, ref.SecretName, options)
+		},
+	}
+	cmd.Flags().BoolVar(&options.Purge, "purge", false, "permanently remove the secret rather than soft deleting it, for Azure Key Vault and Vault KV v2")
+	cmd.Flags().BoolVar(&options.ForceDeleteWithoutRecovery, "force", false, "delete an AWS Secrets Manager secret without a recovery window")
+	cmd.Flags().Int64Var(&options.RecoveryWindowInDays, "recovery-window", 0, "the number of days AWS Secrets Manager waits before deleting the secret")
+	return cmd
+}
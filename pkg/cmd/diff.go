@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/migration"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretref"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/spf13/cobra"
+)
+
+// Diff is the JSON and YAML output of diff
+type Diff struct {
+	// Differences are the keys which differ, values are never printed
+	Differences []string `json:"differences" yaml:"differences"`
+}
+
+func newCmdDiff(o *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff A B",
+		Short: "Compares two secrets, or one key of each",
+		Long: `Compares two secrets, or one key of each, and prints the keys which differ without their values. The command
+exits with code 13 if the secrets differ.`,
+		Example: `  # check a secret was copied correctly
+  secretfacade diff k8s://jx/db-creds gsm://my-project/db-creds`,
+		Args: exactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := parseRef(args[0])
+			if err != nil {
+				return err
+			}
+			b, err := parseRef(args[1])
+			if err != nil {
+				return err
+			}
+			if (a.SecretKey == "") != (b.SecretKey == "") {
+				return usageErrorf("compare either two whole secrets or a key of each")
+			}
+			valueA, err := o.read(cmd.Context(), a)
+			if err != nil {
+				return err
+			}
+			valueB, err := o.read(cmd.Context(), b)
+			if err != nil {
+				return err
+			}
+
+			diff := Diff{Differences: migration.Diff(valueA, valueB)}
+			if diff.Differences == nil {
+				diff.Differences = []string{}
+			}
+			out := cmd.OutOrStdout()
+			err = o.print(out, diff, func() error {
+				for _, k := range diff.Differences {
+					if _, err := fmt.Fprintf(out, "~ %s\n", k); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if len(diff.Differences) > 0 {
+				return ErrDifferent
+			}
+			return nil
+		},
+	}
+}
+
+// read returns the referenced secret, or a secret of just the referenced key
+func (o *Options) read(ctx context.Context, ref *secretref.Ref) (*secretstore.SecretValue, error) {
+	mgr, err := o.manager(ref)
+	if err != nil {
+		return nil, err
+	}
+	if ref.SecretKey == "" {
+		return mgr.GetSecretValue(ctx, ref.Location, ref.SecretName)
+	}
+	value, err := mgr.GetSecretWithContext(ctx, ref.Location, ref.SecretName, ref.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	return &secretstore.SecretValue{Value: value}, nil
+}
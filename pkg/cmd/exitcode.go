@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/metrics"
+)
+
+// Exit codes of the secretfacade command. Errors from the secret stores exit with the code of their error class, see
+// metrics.ErrorClass
+const (
+	ExitOK               = 0
+	ExitError            = 1
+	ExitUsage            = 2
+	ExitSecretNotFound   = 3
+	ExitKeyNotFound      = 4
+	ExitPermissionDenied = 5
+	ExitAlreadyExists    = 6
+	ExitConflict         = 7
+	ExitTransient        = 8
+	ExitNotSupported     = 9
+	ExitReadOnly         = 10
+	ExitCanceled         = 11
+	ExitDeadlineExceeded = 12
+	// ExitDifferent is returned by diff when the secrets differ
+	ExitDifferent = 13
+)
+
+// ErrDifferent is returned by diff when the secrets differ
+var ErrDifferent = errors.New("secrets differ")
+
+var errorClassExitCodes = map[string]int{
+	metrics.ErrorClassSecretNotFound:   ExitSecretNotFound,
+	metrics.ErrorClassKeyNotFound:      ExitKeyNotFound,
+	metrics.ErrorClassPermissionDenied: ExitPermissionDenied,
+	metrics.ErrorClassAlreadyExists:    ExitAlreadyExists,
+	metrics.ErrorClassConflict:         ExitConflict,
+	metrics.ErrorClassTransient:        ExitTransient,
+	metrics.ErrorClassNotSupported:     ExitNotSupported,
+	metrics.ErrorClassReadOnly:         ExitReadOnly,
+	metrics.ErrorClassCanceled:         ExitCanceled,
+	metrics.ErrorClassDeadlineExceeded: ExitDeadlineExceeded,
+}
+
+// usageError is an error in the arguments or flags of a command
+type usageError struct {
+	error
+}
+
+func (e usageError) Unwrap() error {
+	return e.error
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return usageError{fmt.Errorf(format, args...)}
+}
+
+// ExitCode returns the exit code for the error returned by executing the command
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if errors.Is(err, ErrDifferent) {
+		return ExitDifferent
+	}
+	if errors.As(err, &usageError{}) {
+		return ExitUsage
+	}
+	if code, ok := errorClassExitCodes[metrics.ErrorClass(err)]; ok {
+		return code
+	}
+	return ExitError
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretref"
+	"github.com/spf13/cobra"
+)
+
+func newCmdGet(o *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get REF",
+		Short: "Prints a secret, or one key of it",
+		Example: `  # print the password key of a GCP secret
+  secretfacade get gsm://my-project/db-creds#password
+
+  # print every property of a Kubernetes secret as JSON
+  secretfacade get k8s://jx/db-creds -o json`,
+		Args: exactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ref, err := parseRef(args[0])
+			if err != nil {
+				return err
+			}
+			mgr, err := o.manager(ref)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if ref.SecretKey != "" {
+				value, err := mgr.GetSecretWithContext(cmd.Context(), ref.Location, ref.SecretName, ref.SecretKey)
+				if err != nil {
+					return err
+				}
+				return o.print(out, map[string]string{ref.SecretKey: value}, func() error {
+					_, err := fmt.Fprintln(out, value)
+					return err
+				})
+			}
+			value, err := mgr.GetSecretValue(cmd.Context(), ref.Location, ref.SecretName)
+			if err != nil {
+				return err
+			}
+			return o.print(out, newSecret(ref, value), func() error {
+				if value.Value != "" {
+					_, err := fmt.Fprintln(out, value.Value)
+					return err
+				}
+				return printProperties(out, value.PropertyValues)
+			})
+		},
+	}
+}
+
+func parseRef(arg string) (*secretref.Ref, error) {
+	ref, err := secretref.Parse(arg)
+	if err != nil {
+		return nil, usageError{err}
+	}
+	return ref, nil
+}
+
+func parseLocation(arg string) (*secretref.Ref, error) {
+	ref, err := secretref.ParseLocation(arg)
+	if err != nil {
+		return nil, usageError{err}
+	}
+	return ref, nil
+}
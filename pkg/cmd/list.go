@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/spf13/cobra"
+)
+
+func newCmdList(o *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list LOCATION",
+		Short: "Lists the secrets of a location",
+		Long: `Lists the secrets of a location. The location is a reference without a secret name, such as k8s://jx, or with
+a prefix of the secret names to list, such as vault://vault.example.com:8200/secret/jx/`,
+		Example: `  # list the secrets of a GCP project as YAML
+  secretfacade list gsm://my-project -o yaml`,
+		Args: exactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ref, err := parseLocation(args[0])
+			if err != nil {
+				return err
+			}
+			mgr, err := o.manager(ref)
+			if err != nil {
+				return err
+			}
+			secrets, err := mgr.ListSecrets(cmd.Context(), ref.Location, &secretstore.ListOptions{Prefix: ref.SecretName}).All()
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			output := make([]Secret, 0, len(secrets))
+			for i := range secrets {
+				output = append(output, Secret{
+					Location:    ref.Location,
+					Name:        secrets[i].Name,
+					Labels:      secrets[i].Labels,
+					Annotations: secrets[i].Annotations,
+				})
+			}
+			return o.print(out, output, func() error {
+				for i := range secrets {
+					if _, err := fmt.Fprintln(out, secrets[i].Name); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+	}
+}
@@ -0,0 +1,123 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/migration"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/factory"
+	"github.com/spf13/cobra"
+)
+
+const example = `  # copy every secret of a Vault mount to GCP Secret Manager, prefixing the names with jx-
+  secretfacade migrate --from-type vault --to-type gcpSecretsManager \
+    --from-location https://vault.example.com:8200 --to-location my-project \
+    --prefix secret/jx/ --include 'secret/jx/(.*)' --rename 'jx-$1'
+
+  # plan a migration described by a rules file without writing anything
+  secretfacade migrate --from-type vault --to-type gcpSecretsManager --rules rules.yaml --dry-run
+`
+
+// Options are the options of the migrate command
+type Options struct {
+	FromType  string
+	ToType    string
+	RulesFile string
+	Rule      migration.Rule
+	Existing  string
+	DryRun    bool
+	NoVerify  bool
+	ValueKey  string
+
+	// Factory creates the secret managers, defaults to factory.SecretManagerFactory
+	Factory secretstore.FactoryInterface
+	Out     io.Writer
+}
+
+// NewCmdMigrate creates the migrate command and its options
+func NewCmdMigrate() (*cobra.Command, *Options) {
+	o := &Options{}
+	cmd := &cobra.Command{
+		Use:     "migrate",
+		Short:   "Copies secrets from one secret store to another",
+		Example: example,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			o.Out = cmd.OutOrStdout()
+			return o.Run(cmd)
+		},
+	}
+	cmd.Flags().StringVar(&o.FromType, "from-type", "", "the store type to copy secrets from, such as vault or kubernetes")
+	cmd.Flags().StringVar(&o.ToType, "to-type", "", "the store type to copy secrets to, defaults to --from-type")
+	cmd.Flags().StringVar(&o.RulesFile, "rules", "", "a YAML file of migration rules, instead of the rule flags")
+	cmd.Flags().StringVar(&o.Rule.SourceLocation, "from-location", "", "the location to copy secrets from")
+	cmd.Flags().StringVar(&o.Rule.TargetLocation, "to-location", "", "the location to copy secrets to, defaults to --from-location")
+	cmd.Flags().StringVar(&o.Rule.Prefix, "prefix", "", "only list the secrets whose name starts with the prefix")
+	cmd.Flags().StringVar(&o.Rule.Include, "include", "", "a regular expression of the secret names to copy, defaults to every secret")
+	cmd.Flags().StringVar(&o.Rule.Exclude, "exclude", "", "a regular expression of the secret names not to copy")
+	cmd.Flags().StringVar(&o.Rule.Rename, "rename", "", "the target secret name, which can refer to the submatches of --include as $1")
+	cmd.Flags().StringVar(&o.Existing, "existing", string(migration.ExistingSkip), "what to do with secrets which already exist in the target: skip, overwrite or fail")
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", false, "print the changes which would be made to the target without making them")
+	cmd.Flags().BoolVar(&o.NoVerify, "no-verify", false, "do not compare the source and target secrets after copying them")
+	cmd.Flags().StringVar(&o.ValueKey, "value-key", "", "the key to write plain secret values to in targets which only store keys, such as kubernetes and vault")
+	return cmd, o
+}
+
+// Run migrates the secrets
+func (o *Options) Run(cmd *cobra.Command) error {
+	if o.FromType == "" {
+		return fmt.Errorf("missing --from-type")
+	}
+	if o.ToType == "" {
+		o.ToType = o.FromType
+	}
+	if o.Factory == nil {
+		o.Factory = factory.SecretManagerFactory{}
+	}
+	rules := []migration.Rule{o.Rule}
+	if o.RulesFile != "" {
+		var err error
+		rules, err = migration.LoadRules(o.RulesFile)
+		if err != nil {
+			return err
+		}
+	} else if o.Rule.SourceLocation == "" {
+		return fmt.Errorf("missing --from-location or --rules")
+	}
+
+	source, err := o.Factory.NewSecretManager(secretstore.Type(o.FromType))
+	if err != nil {
+		return err
+	}
+	target, err := o.Factory.NewSecretManager(secretstore.Type(o.ToType))
+	if err != nil {
+		return err
+	}
+	report, err := migration.Migrate(cmd.Context(), source, target, &migration.Options{
+		Rules:      rules,
+		Existing:   migration.ExistingPolicy(o.Existing),
+		DryRun:     o.DryRun,
+		Verify:     !o.NoVerify,
+		TargetType: secretstore.Type(o.ToType),
+		ValueKey:   o.ValueKey,
+	})
+	if report == nil {
+		return err
+	}
+	if report.Plan != nil {
+		fmt.Fprint(o.Out, report.Plan.Text())
+		return err
+	}
+	for i := range report.Results {
+		r := &report.Results[i]
+		fmt.Fprintf(o.Out, "%s %s/%s -> %s/%s\n", r.Action, r.SourceLocation, r.SourceName, r.TargetLocation, r.TargetName)
+		if r.Err != nil {
+			fmt.Fprintf(o.Out, "    error: %v\n", r.Err)
+		} else if len(r.Differences) > 0 {
+			fmt.Fprintf(o.Out, "    differs in %v\n", r.Differences)
+		}
+	}
+	fmt.Fprintln(o.Out, report.Summary())
+	return err
+}
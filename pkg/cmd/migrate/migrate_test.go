@@ -0,0 +1,36 @@
+//go:build unit
+// +build unit
+
+package migrate_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/cmd/migrate"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	factory := &fake.SecretManagerFactory{}
+	_, err := factory.NewSecretManager(secretstore.SecretStoreTypeKubernetes)
+	require.NoError(t, err)
+	store := factory.GetSecretStore()
+	require.NoError(t, store.SetSecret("jx", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "hunter2"}}))
+
+	cmd, o := migrate.NewCmdMigrate()
+	o.Factory = factory
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"--from-type", "kubernetes", "--from-location", "jx", "--to-location", "jx-staging"})
+	require.NoError(t, cmd.Execute())
+	assert.Equal(t, "create jx/db -> jx-staging/db\n1 create, 0 overwrite, 0 skip, 0 unchanged, 0 failed\n", out.String())
+
+	value, err := store.GetSecretValue(context.Background(), "jx-staging", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", value.PropertyValues["password"])
+}
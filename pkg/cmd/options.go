@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretref"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// OutputPlain prints secret values as they are and properties as key=value lines
+	OutputPlain = "plain"
+	// OutputJSON prints JSON
+	OutputJSON = "json"
+	// OutputYAML prints YAML
+	OutputYAML = "yaml"
+)
+
+// Options are shared by every command
+type Options struct {
+	// Output is the output format, OutputPlain, OutputJSON or OutputYAML
+	Output string
+
+	resolver *secretref.Resolver
+}
+
+// manager returns the secret manager of the store type
+func (o *Options) manager(ref *secretref.Ref) (secretstore.Interface, error) {
+	return o.resolver.Manager(ref.StoreType)
+}
+
+// print writes v in the output format, calling plain for OutputPlain
+func (o *Options) print(out io.Writer, v interface{}, plain func() error) error {
+	switch o.Output {
+	case "", OutputPlain:
+		return plain()
+	case OutputJSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshalling output: %w", err)
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	case OutputYAML:
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		err := encoder.Encode(v)
+		if err != nil {
+			return fmt.Errorf("error marshalling output: %w", err)
+		}
+		return encoder.Close()
+	default:
+		return usageErrorf("unknown output format %q, use %s, %s or %s", o.Output, OutputPlain, OutputJSON, OutputYAML)
+	}
+}
+
+// Secret is the JSON and YAML output of a secret
+type Secret struct {
+	Location    string            `json:"location" yaml:"location"`
+	Name        string            `json:"name" yaml:"name"`
+	Value       string            `json:"value,omitempty" yaml:"value,omitempty"`
+	Properties  map[string]string `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	Type        corev1.SecretType `json:"type,omitempty" yaml:"type,omitempty"`
+	Version     string            `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+func newSecret(ref *secretref.Ref, value *secretstore.SecretValue) *Secret {
+	return &Secret{
+		Location:    ref.Location,
+		Name:        ref.SecretName,
+		Value:       value.Value,
+		Properties:  value.PropertyValues,
+		Labels:      value.Labels,
+		Annotations: value.Annotations,
+		Type:        value.SecretType,
+		Version:     value.Version,
+	}
+}
+
+// printProperties prints the properties as sorted key=value lines
+func printProperties(out io.Writer, properties map[string]string) error {
+	keys := make([]string, 0, len(properties))
+	for k := range properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, err := fmt.Fprintf(out, "%s=%s\n", k, properties[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
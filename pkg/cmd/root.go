@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"github.com/jenkins-x-plugins/secretfacade/pkg/cmd/migrate"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretref"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdSecretFacade creates the secretfacade command, using factory to create the secret managers. Secrets are
+// referenced as described in the secretref package, such as gsm://my-project/db-creds#password
+func NewCmdSecretFacade(factory secretstore.FactoryInterface) *cobra.Command {
+	o := &Options{resolver: secretref.NewResolver(factory)}
+	cmd := &cobra.Command{
+		Use:   "secretfacade",
+		Short: "Works with secrets in any of the secret stores supported by secretfacade",
+		Long: `Works with secrets in any of the secret stores supported by secretfacade. Secrets are referenced as
+SCHEME://LOCATION/NAME#KEY where the scheme is one of gsm, vault, vault+http, asm, ssm, azkv, k8s, sops or age. The
+location of sops and age secrets is a path, such as sops:///path/to/secrets.yaml/NAME#KEY.
+
+Errors exit with a code for their class: 2 usage, 3 secret not found, 4 key not found, 5 permission denied,
+6 already exists, 7 conflict, 8 transient, 9 not supported, 10 read only, 11 canceled, 12 deadline exceeded and 1 for
+any other error. diff exits with 13 when the secrets differ.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	cmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return usageError{err}
+	})
+	cmd.PersistentFlags().StringVarP(&o.Output, "output", "o", OutputPlain, "the output format: plain, json or yaml")
+
+	migrateCmd, migrateOptions := migrate.NewCmdMigrate()
+	migrateOptions.Factory = factory
+	cmd.AddCommand(
+		newCmdGet(o),
+		newCmdSet(o),
+		newCmdDelete(o),
+		newCmdList(o),
+		newCmdCopy(o),
+		newCmdDiff(o),
+		newCmdExport(o),
+		newCmdImport(o),
+		migrateCmd,
+	)
+	return cmd
+}
+
+// exactArgs reports the wrong number of arguments as a usage error
+func exactArgs(n int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := cobra.ExactArgs(n)(cmd, args); err != nil {
+			return usageError{err}
+		}
+		return nil
+	}
+}
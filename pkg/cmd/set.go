@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type setOptions struct {
+	value           string
+	stdin           bool
+	properties      []string
+	files           []string
+	envFiles        []string
+	labels          map[string]string
+	annotations     map[string]string
+	secretType      string
+	overwrite       bool
+	expectedVersion string
+}
+
+func newCmdSet(o *Options) *cobra.Command {
+	s := &setOptions{}
+	cmd := &cobra.Command{
+		Use:   "set REF",
+		Short: "Writes a secret, or one key of it",
+		Long: `Writes a secret. The value is taken from --value or standard input and written to the key of the reference,
+or as the whole value of the secret if the reference has no key. Properties are taken from --property, --from-file and
+--from-env-file and are merged in to the existing properties of the secret, as are labels and annotations, unless
+--overwrite is set, which replaces the existing properties, labels and annotations.`,
+		Example: `  # set one key of a Kubernetes secret
+  secretfacade set k8s://jx/db-creds#password --value hunter2
+
+  # write the password from standard input
+  generate-password | secretfacade set gsm://my-project/db-creds#password --stdin
+
+  # write the properties of a .env file, replacing the existing ones
+  secretfacade set vault://vault.example.com:8200/secret/jx/app --from-env-file app.env --overwrite`,
+		Args: exactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ref, err := parseRef(args[0])
+			if err != nil {
+				return err
+			}
+			value, err := s.secretValue(ref.SecretKey, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			mgr, err := o.manager(ref)
+			if err != nil {
+				return err
+			}
+			return mgr.SetSecretWithContext(cmd.Context(), ref.Location, ref.SecretName, value)
+		},
+	}
+	cmd.Flags().StringVar(&s.value, "value", "", "the value to write")
+	cmd.Flags().BoolVar(&s.stdin, "stdin", false, "read the value to write from standard input")
+	cmd.Flags().StringArrayVarP(&s.properties, "property", "p", nil, "a key=value property to write, can be repeated")
+	cmd.Flags().StringArrayVar(&s.files, "from-file", nil, "a [key=]path file whose content is written to the key, which defaults to the file name, can be repeated")
+	cmd.Flags().StringArrayVar(&s.envFiles, "from-env-file", nil, "a .env file of KEY=VALUE lines to write as properties, can be repeated")
+	cmd.Flags().StringToStringVar(&s.labels, "label", nil, "labels of the secret")
+	cmd.Flags().StringToStringVar(&s.annotations, "annotation", nil, "annotations of the secret")
+	cmd.Flags().StringVar(&s.secretType, "type", "", "the type of Kubernetes secrets, such as kubernetes.io/tls")
+	cmd.Flags().BoolVar(&s.overwrite, "overwrite", false, "replace the existing properties, labels and annotations of the secret instead of merging in to them")
+	cmd.Flags().StringVar(&s.expectedVersion, "expected-version", "", "only write the secret if its current version matches")
+	return cmd
+}
+
+// secretValue builds the secret value to write from the flags
+func (s *setOptions) secretValue(key string, stdin io.Reader) (*secretstore.SecretValue, error) {
+	properties := map[string]string{}
+	for _, p := range s.properties {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || k == "" {
+			return nil, usageErrorf("invalid property %q, use key=value", p)
+		}
+		properties[k] = v
+	}
+	for _, f := range s.files {
+		k, path, ok := strings.Cut(f, "=")
+		if !ok {
+			k, path = filepath.Base(f), f
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		properties[k] = string(data)
+	}
+	for _, path := range s.envFiles {
+		env, err := readEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range env {
+			properties[k] = v
+		}
+	}
+
+	hasValue := s.value != "" || s.stdin
+	if s.value != "" && s.stdin {
+		return nil, usageErrorf("use either --value or --stdin")
+	}
+	value := s.value
+	if s.stdin {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("error reading standard input: %w", err)
+		}
+		value = strings.TrimSuffix(string(data), "\n")
+	}
+
+	secretValue := &secretstore.SecretValue{
+		Labels:          s.labels,
+		Annotations:     s.annotations,
+		SecretType:      corev1.SecretType(s.secretType),
+		Overwrite:       s.overwrite,
+		ExpectedVersion: s.expectedVersion,
+	}
+	switch {
+	case hasValue && key != "":
+		properties[key] = value
+	case hasValue && len(properties) > 0:
+		return nil, usageErrorf("a value without a key cannot be combined with properties, add a #key to the reference")
+	case hasValue:
+		secretValue.Value = value
+	case key != "":
+		return nil, usageErrorf("missing --value or --stdin for key %s", key)
+	case len(properties) == 0:
+		return nil, usageErrorf("nothing to write, use --value, --stdin, --property, --from-file or --from-env-file")
+	}
+	if len(properties) > 0 {
+		secretValue.PropertyValues = properties
+	}
+	return secretValue, nil
+}
+
+// readEnvFile parses a .env file of KEY=VALUE lines. Blank lines and lines starting with # are ignored, an export
+// prefix is allowed and values can be single or double quoted, with escapes such as \n in double quoted values
+func readEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	defer f.Close()
+
+	env := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid line %d of %s, use KEY=VALUE", n, path)
+		}
+		v = strings.TrimSpace(v)
+		switch {
+		case len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"':
+			v, err = strconv.Unquote(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted value on line %d of %s: %w", n, path, err)
+			}
+		case len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'':
+			v = v[1 : len(v)-1]
+		}
+		env[k] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return env, nil
+}
@@ -0,0 +1,171 @@
+package generators
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// DefaultPasswordLength is the length of passwords when Password does not set Length
+	DefaultPasswordLength = 20
+	// DefaultTokenBytes is the number of random bytes in tokens when HMACToken does not set Bytes
+	DefaultTokenBytes = 32
+
+	// CharsetAlphanumeric is the default character set of passwords
+	CharsetAlphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// CharsetSymbols can be appended to CharsetAlphanumeric for passwords which need symbols
+	CharsetSymbols = "!#%+-.:=?@^_~"
+)
+
+// Generator creates a new secret value. The generators in this package can also be used as rotation.Generator
+type Generator interface {
+	Generate(ctx context.Context) (*secretstore.SecretValue, error)
+}
+
+// GenerateIfMissing generates and writes the secret only if it does not exist, returning whether it was created.
+// Existing secrets are never modified, so it is safe to call every time an application starts. The secret is created
+// with CreateOnly so that concurrent callers do not overwrite each other's secret. On secret stores which cannot create
+// secrets atomically, such as Azure Key Vault and sops files, the secret is written if it did not exist when it was
+// read, so concurrent callers may each write a secret and the last one wins
+func GenerateIfMissing(ctx context.Context, mgr secretstore.Interface, location, secretName string, generator Generator) (bool, error) {
+	_, err := mgr.GetSecretValue(ctx, location, secretName)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, secretstore.ErrSecretNotFound) {
+		return false, fmt.Errorf("error checking whether secret %s exists in %s: %w", secretName, location, err)
+	}
+	secretValue, err := generator.Generate(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error generating secret %s: %w", secretName, err)
+	}
+	secretValue = secretValue.DeepCopy()
+	secretValue.CreateOnly = true
+	err = mgr.SetSecretWithContext(ctx, location, secretName, secretValue)
+	if errors.Is(err, secretstore.ErrNotSupported) {
+		secretValue.CreateOnly = false
+		err = mgr.SetSecretWithContext(ctx, location, secretName, secretValue)
+	}
+	if errors.Is(err, secretstore.ErrAlreadyExists) {
+		// another caller created the secret since it was read, which it is read again to check
+		_, err = mgr.GetSecretValue(ctx, location, secretName)
+		if err != nil {
+			return false, fmt.Errorf("error reading secret %s in %s created by another caller: %w", secretName, location, err)
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error writing generated secret %s to %s: %w", secretName, location, err)
+	}
+	return true, nil
+}
+
+// Password generates a random password
+type Password struct {
+	// Key is the property the password is stored in, defaults to password
+	Key string
+	// Length defaults to DefaultPasswordLength
+	Length int
+	// Charset is the characters the password is made of, defaults to CharsetAlphanumeric
+	Charset string
+}
+
+func (p Password) Generate(context.Context) (*secretstore.SecretValue, error) {
+	password, err := randomString(p.Length, p.Charset)
+	if err != nil {
+		return nil, err
+	}
+	return &secretstore.SecretValue{PropertyValues: map[string]string{withDefault(p.Key, "password"): password}}, nil
+}
+
+// HMACToken generates a random hex encoded token, such as the shared secret used to sign webhooks
+type HMACToken struct {
+	// Key is the property the token is stored in, defaults to hmac
+	Key string
+	// Bytes is the number of random bytes, defaults to DefaultTokenBytes
+	Bytes int
+}
+
+func (h HMACToken) Generate(context.Context) (*secretstore.SecretValue, error) {
+	n := h.Bytes
+	if n <= 0 {
+		n = DefaultTokenBytes
+	}
+	token, err := randomBytes(n)
+	if err != nil {
+		return nil, err
+	}
+	return &secretstore.SecretValue{PropertyValues: map[string]string{withDefault(h.Key, "hmac"): hex.EncodeToString(token)}}, nil
+}
+
+// Htpasswd generates an htpasswd entry with a bcrypt hashed password, as used for basic authentication by ingress
+// controllers. The plain username and password are stored alongside the entry in the username and Password.Key
+// properties
+type Htpasswd struct {
+	Username string
+	// Password generates the password
+	Password Password
+	// Key is the property the htpasswd entry is stored in, defaults to auth
+	Key string
+}
+
+func (h Htpasswd) Generate(ctx context.Context) (*secretstore.SecretValue, error) {
+	if h.Username == "" {
+		return nil, fmt.Errorf("htpasswd entries need a username")
+	}
+	generated, err := h.Password.Generate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	passwordKey := withDefault(h.Password.Key, "password")
+	password := generated.PropertyValues[passwordKey]
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing password: %w", err)
+	}
+	return &secretstore.SecretValue{PropertyValues: map[string]string{
+		withDefault(h.Key, "auth"): h.Username + ":" + string(hash),
+		"username":                 h.Username,
+		passwordKey:                password,
+	}}, nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("error reading random bytes: %w", err)
+	}
+	return b, nil
+}
+
+// randomString picks each character uniformly from charset
+func randomString(length int, charset string) (string, error) {
+	if length <= 0 {
+		length = DefaultPasswordLength
+	}
+	chars := []rune(withDefault(charset, CharsetAlphanumeric))
+	size := big.NewInt(int64(len(chars)))
+	s := make([]rune, length)
+	for i := range s {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", fmt.Errorf("error reading random number: %w", err)
+		}
+		s[i] = chars[n.Int64()]
+	}
+	return string(s), nil
+}
+
+func withDefault(s, defaultValue string) string {
+	if s == "" {
+		return defaultValue
+	}
+	return s
+}
@@ -0,0 +1,225 @@
+//go:build unit
+// +build unit
+
+package generators_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/generators"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/rotation"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// the generators can be used for rotation
+var _ rotation.Generator = generators.Password{}
+
+func TestPassword(t *testing.T) {
+	ctx := context.Background()
+	value, err := generators.Password{}.Generate(ctx)
+	require.NoError(t, err)
+	password := value.PropertyValues["password"]
+	assert.Len(t, password, generators.DefaultPasswordLength)
+	assert.Empty(t, strings.Trim(password, generators.CharsetAlphanumeric))
+
+	value, err = generators.Password{Key: "pin", Length: 6, Charset: "0123456789"}.Generate(ctx)
+	require.NoError(t, err)
+	assert.Regexp(t, "^[0-9]{6}$", value.PropertyValues["pin"])
+}
+
+func TestHMACToken(t *testing.T) {
+	value, err := generators.HMACToken{Bytes: 16}.Generate(context.Background())
+	require.NoError(t, err)
+	token, err := hex.DecodeString(value.PropertyValues["hmac"])
+	require.NoError(t, err)
+	assert.Len(t, token, 16)
+}
+
+func TestHtpasswd(t *testing.T) {
+	ctx := context.Background()
+	_, err := generators.Htpasswd{}.Generate(ctx)
+	assert.Error(t, err)
+
+	value, err := generators.Htpasswd{Username: "admin"}.Generate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", value.PropertyValues["username"])
+	user, hash, found := strings.Cut(value.PropertyValues["auth"], ":")
+	require.True(t, found)
+	assert.Equal(t, "admin", user)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte(value.PropertyValues["password"])))
+}
+
+func TestSSHKeyPair(t *testing.T) {
+	for _, keyType := range []string{generators.KeyTypeEd25519, generators.KeyTypeECDSA, generators.KeyTypeRSA} {
+		t.Run(keyType, func(t *testing.T) {
+			value, err := generators.SSHKeyPair{KeyType: keyType, Bits: 1024, Comment: "jenkins-x"}.Generate(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, corev1.SecretTypeSSHAuth, value.SecretType)
+
+			signer, err := ssh.ParsePrivateKey([]byte(value.PropertyValues[corev1.SSHAuthPrivateKey]))
+			require.NoError(t, err)
+			publicKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(value.PropertyValues["ssh-publickey"]))
+			require.NoError(t, err)
+			assert.Equal(t, "jenkins-x", comment)
+			assert.Equal(t, signer.PublicKey().Marshal(), publicKey.Marshal())
+		})
+	}
+
+	_, err := generators.SSHKeyPair{KeyType: "dsa"}.Generate(context.Background())
+	assert.Error(t, err)
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	value, err := generators.SelfSignedCertificate{CommonName: "jx.example.com"}.Generate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, corev1.SecretTypeTLS, value.SecretType)
+	assert.Equal(t, value.PropertyValues[corev1.TLSCertKey], value.PropertyValues["ca.crt"])
+
+	block, _ := pem.Decode([]byte(value.PropertyValues[corev1.TLSCertKey]))
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	assert.Equal(t, "jx.example.com", cert.Subject.CommonName)
+	assert.NoError(t, cert.VerifyHostname("jx.example.com"))
+
+	block, _ = pem.Decode([]byte(value.PropertyValues[corev1.TLSPrivateKeyKey]))
+	require.NotNil(t, block)
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	require.NoError(t, err)
+	assert.True(t, key.(*ecdsa.PrivateKey).PublicKey.Equal(cert.PublicKey))
+}
+
+func TestJWTSigningKey(t *testing.T) {
+	tests := map[string]interface{}{
+		generators.JWTAlgorithmRS256: &rsa.PrivateKey{},
+		generators.JWTAlgorithmES256: &ecdsa.PrivateKey{},
+		generators.JWTAlgorithmEdDSA: ed25519.PrivateKey{},
+	}
+	for algorithm, expectedKey := range tests {
+		t.Run(algorithm, func(t *testing.T) {
+			value, err := generators.JWTSigningKey{Algorithm: algorithm, Bits: 1024}.Generate(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, algorithm, value.PropertyValues["alg"])
+			assert.NotEmpty(t, value.PropertyValues["kid"])
+
+			block, _ := pem.Decode([]byte(value.PropertyValues["private.pem"]))
+			require.NotNil(t, block)
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			require.NoError(t, err)
+			assert.IsType(t, expectedKey, key)
+
+			block, _ = pem.Decode([]byte(value.PropertyValues["public.pem"]))
+			require.NotNil(t, block)
+			_, err = x509.ParsePKIXPublicKey(block.Bytes)
+			assert.NoError(t, err)
+		})
+	}
+
+	value, err := generators.JWTSigningKey{Algorithm: generators.JWTAlgorithmHS256}.Generate(context.Background())
+	require.NoError(t, err)
+	assert.NotEmpty(t, value.PropertyValues["secret"])
+	assert.NotContains(t, value.PropertyValues, "private.pem")
+
+	_, err = generators.JWTSigningKey{Algorithm: "none"}.Generate(context.Background())
+	assert.Error(t, err)
+}
+
+func TestGenerateIfMissing(t *testing.T) {
+	ctx := context.Background()
+	store := fake.NewFakeSecretStore()
+	generator := generators.Password{}
+
+	created, err := generators.GenerateIfMissing(ctx, store, "jx", "db", generator)
+	require.NoError(t, err)
+	assert.True(t, created)
+	first, err := store.GetSecretValue(ctx, "jx", "db")
+	require.NoError(t, err)
+
+	created, err = generators.GenerateIfMissing(ctx, store, "jx", "db", generator)
+	require.NoError(t, err)
+	assert.False(t, created)
+	second, err := store.GetSecretValue(ctx, "jx", "db")
+	require.NoError(t, err)
+	assert.Equal(t, first.PropertyValues, second.PropertyValues)
+	assert.Equal(t, first.Version, second.Version)
+}
+
+// deniedStore denies reading secrets
+type deniedStore struct {
+	*fake.SecretStore
+}
+
+func (d deniedStore) GetSecretValue(_ context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	return nil, secretstore.NewError(secretstore.ErrPermissionDenied, location, secretName, nil)
+}
+
+func TestGenerateIfMissingReturnsReadErrors(t *testing.T) {
+	store := deniedStore{SecretStore: fake.NewFakeSecretStore()}
+	created, err := generators.GenerateIfMissing(context.Background(), store, "jx", "db", generators.Password{})
+	assert.ErrorIs(t, err, secretstore.ErrPermissionDenied)
+	assert.False(t, created)
+	_, err = store.SecretStore.GetSecretValue(context.Background(), "jx", "db")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+}
+
+// racingStore creates the secret as another caller would, after GetSecretValue first reports it missing
+type racingStore struct {
+	*fake.SecretStore
+	raced bool
+}
+
+func (r *racingStore) GetSecretValue(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	if !r.raced {
+		r.raced = true
+		if err := r.SecretStore.SetSecret(location, secretName, &secretstore.SecretValue{Value: "other"}); err != nil {
+			return nil, err
+		}
+		return nil, secretstore.NewSecretNotFoundError(location, secretName)
+	}
+	return r.SecretStore.GetSecretValue(ctx, location, secretName)
+}
+
+func TestGenerateIfMissingRace(t *testing.T) {
+	store := &racingStore{SecretStore: fake.NewFakeSecretStore()}
+	created, err := generators.GenerateIfMissing(context.Background(), store, "jx", "db", generators.Password{})
+	require.NoError(t, err)
+	assert.False(t, created)
+	value, err := store.GetSecret("jx", "db", "")
+	require.NoError(t, err)
+	assert.Equal(t, "other", value)
+}
+
+// noCreateOnlyStore cannot create secrets atomically
+type noCreateOnlyStore struct {
+	*fake.SecretStore
+}
+
+func (n noCreateOnlyStore) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	if secretValue.CreateOnly {
+		return secretstore.ErrNotSupported
+	}
+	return n.SecretStore.SetSecretWithContext(ctx, location, secretName, secretValue)
+}
+
+func TestGenerateIfMissingWithoutCreateOnly(t *testing.T) {
+	store := noCreateOnlyStore{SecretStore: fake.NewFakeSecretStore()}
+	created, err := generators.GenerateIfMissing(context.Background(), store, "jx", "db", generators.Password{})
+	require.NoError(t, err)
+	assert.True(t, created)
+	_, err = store.GetSecret("jx", "db", "password")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,238 @@
+package generators
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultRSABits is the size of RSA keys when a generator does not set Bits
+	DefaultRSABits = 2048
+	// DefaultCertificateValidity is how long self signed certificates are valid when SelfSignedCertificate does not
+	// set Validity
+	DefaultCertificateValidity = 365 * 24 * time.Hour
+
+	// KeyTypeEd25519 generates Ed25519 keys
+	KeyTypeEd25519 = "ed25519"
+	// KeyTypeRSA generates RSA keys
+	KeyTypeRSA = "rsa"
+	// KeyTypeECDSA generates ECDSA keys on the P-256 curve
+	KeyTypeECDSA = "ecdsa"
+
+	// JWTAlgorithmRS256 signs JWTs with an RSA key
+	JWTAlgorithmRS256 = "RS256"
+	// JWTAlgorithmES256 signs JWTs with an ECDSA P-256 key
+	JWTAlgorithmES256 = "ES256"
+	// JWTAlgorithmEdDSA signs JWTs with an Ed25519 key
+	JWTAlgorithmEdDSA = "EdDSA"
+	// JWTAlgorithmHS256 signs JWTs with a shared secret
+	JWTAlgorithmHS256 = "HS256"
+)
+
+// SSHKeyPair generates an SSH key pair as a kubernetes.io/ssh-auth secret, the private key is stored in ssh-privatekey
+// in OpenSSH format and the public key in ssh-publickey in authorized_keys format
+type SSHKeyPair struct {
+	// KeyType is KeyTypeEd25519, the default, KeyTypeRSA or KeyTypeECDSA
+	KeyType string
+	// Bits is the size of RSA keys, defaults to DefaultRSABits
+	Bits int
+	// Comment is added to the keys, such as the email of the owner
+	Comment string
+}
+
+func (s SSHKeyPair) Generate(context.Context) (*secretstore.SecretValue, error) {
+	key, err := generateKey(withDefault(s.KeyType, KeyTypeEd25519), s.Bits)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(key, s.Comment)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding SSH private key: %w", err)
+	}
+	publicKey, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("error encoding SSH public key: %w", err)
+	}
+	authorizedKey := ssh.MarshalAuthorizedKey(publicKey)
+	if s.Comment != "" {
+		authorizedKey = append(authorizedKey[:len(authorizedKey)-1], []byte(" "+s.Comment+"\n")...)
+	}
+	return &secretstore.SecretValue{
+		PropertyValues: map[string]string{
+			corev1.SSHAuthPrivateKey: string(pem.EncodeToMemory(block)),
+			"ssh-publickey":          string(authorizedKey),
+		},
+		SecretType: corev1.SecretTypeSSHAuth,
+	}, nil
+}
+
+// SelfSignedCertificate generates a self signed TLS certificate as a kubernetes.io/tls secret with an ECDSA P-256
+// key. The certificate is also stored as ca.crt so clients can trust it
+type SelfSignedCertificate struct {
+	CommonName string
+	// DNSNames and IPAddresses are the subject alternative names, DNSNames defaults to CommonName
+	DNSNames    []string
+	IPAddresses []net.IP
+	// Validity defaults to DefaultCertificateValidity
+	Validity time.Duration
+}
+
+func (c SelfSignedCertificate) Generate(context.Context) (*secretstore.SecretValue, error) {
+	if c.CommonName == "" {
+		return nil, fmt.Errorf("self signed certificates need a common name")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating certificate key: %w", err)
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("error generating certificate serial number: %w", err)
+	}
+	validity := c.Validity
+	if validity <= 0 {
+		validity = DefaultCertificateValidity
+	}
+	dnsNames := c.DNSNames
+	if len(dnsNames) == 0 && len(c.IPAddresses) == 0 {
+		dnsNames = []string{c.CommonName}
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: c.CommonName},
+		DNSNames:              dnsNames,
+		IPAddresses:           c.IPAddresses,
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate: %w", err)
+	}
+	keyPEM, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	return &secretstore.SecretValue{
+		PropertyValues: map[string]string{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+			"ca.crt":                certPEM,
+		},
+		SecretType: corev1.SecretTypeTLS,
+	}, nil
+}
+
+// JWTSigningKey generates a key for signing JWTs. Asymmetric keys are stored in private.pem in PKCS #8 format and
+// public.pem in PKIX format, HS256 secrets in secret base64url encoded. The algorithm is stored in alg and a key id
+// derived from the key in kid
+type JWTSigningKey struct {
+	// Algorithm is JWTAlgorithmRS256, the default, JWTAlgorithmES256, JWTAlgorithmEdDSA or JWTAlgorithmHS256
+	Algorithm string
+	// Bits is the size of RS256 keys, defaults to DefaultRSABits
+	Bits int
+}
+
+func (j JWTSigningKey) Generate(context.Context) (*secretstore.SecretValue, error) {
+	algorithm := withDefault(j.Algorithm, JWTAlgorithmRS256)
+	keyType := ""
+	switch algorithm {
+	case JWTAlgorithmRS256:
+		keyType = KeyTypeRSA
+	case JWTAlgorithmES256:
+		keyType = KeyTypeECDSA
+	case JWTAlgorithmEdDSA:
+		keyType = KeyTypeEd25519
+	case JWTAlgorithmHS256:
+		secret, err := randomBytes(64)
+		if err != nil {
+			return nil, err
+		}
+		return &secretstore.SecretValue{PropertyValues: map[string]string{
+			"secret": base64.RawURLEncoding.EncodeToString(secret),
+			"alg":    algorithm,
+			"kid":    keyID(secret),
+		}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %s", algorithm)
+	}
+
+	key, err := generateKey(keyType, j.Bits)
+	if err != nil {
+		return nil, err
+	}
+	privatePEM, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("error encoding public key: %w", err)
+	}
+	return &secretstore.SecretValue{PropertyValues: map[string]string{
+		"private.pem": privatePEM,
+		"public.pem":  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		"alg":         algorithm,
+		"kid":         keyID(publicDER),
+	}}, nil
+}
+
+func generateKey(keyType string, bits int) (crypto.Signer, error) {
+	var key crypto.Signer
+	var err error
+	switch keyType {
+	case KeyTypeEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case KeyTypeRSA:
+		if bits <= 0 {
+			bits = DefaultRSABits
+		}
+		key, err = rsa.GenerateKey(rand.Reader, bits)
+	case KeyTypeECDSA:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", keyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error generating %s key: %w", keyType, err)
+	}
+	return key, nil
+}
+
+func encodePrivateKey(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("error encoding private key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// keyID derives a stable identifier from the public key, or the secret of symmetric keys
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
@@ -1,8 +1,14 @@
 package azureiam
 
 import (
+	"context"
+	"strings"
+
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var keyvaultCredentials azcore.TokenCredential
@@ -14,10 +20,26 @@ func GetKeyvaultCredentials() (azcore.TokenCredential, error) {
 	if keyvaultCredentials != nil {
 		return keyvaultCredentials, nil
 	}
+	_, span := tracing.Start(context.TODO(), "azureiam.NewDefaultAzureCredential")
 	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
-	keyvaultCredentials = cred
+	keyvaultCredentials = tracedCredential{cred}
 	return keyvaultCredentials, err
 }
+
+// tracedCredential traces acquiring tokens, which the Azure SDK does lazily when the credential is first used and
+// whenever the cached token expires
+type tracedCredential struct {
+	azcore.TokenCredential
+}
+
+func (c tracedCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (token azcore.AccessToken, err error) {
+	ctx, span := tracing.Start(ctx, "azureiam.GetToken", attribute.String("azure.scopes", strings.Join(options.Scopes, " ")))
+	defer func() {
+		tracing.End(span, err)
+	}()
+	return c.TokenCredential.GetToken(ctx, options)
+}
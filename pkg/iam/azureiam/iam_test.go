@@ -0,0 +1,52 @@
+//go:build unit
+// +build unit
+
+package azureiam
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type fakeCredential struct {
+	err error
+}
+
+func (f fakeCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "token123"}, f.err
+}
+
+func TestTracedCredentialCreatesSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(previous)
+	options := policy.TokenRequestOptions{Scopes: []string{"https://vault.azure.net/.default"}}
+
+	token, err := tracedCredential{fakeCredential{}}.GetToken(context.Background(), options)
+	require.NoError(t, err)
+	assert.Equal(t, "token123", token.Token)
+	failed := errors.New("no credential available")
+	_, err = tracedCredential{fakeCredential{err: failed}}.GetToken(context.Background(), options)
+	assert.ErrorIs(t, err, failed)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "azureiam.GetToken", spans[0].Name)
+	assert.Contains(t, spans[0].Attributes, attribute.String("azure.scopes", "https://vault.azure.net/.default"))
+	for _, kv := range spans[0].Attributes {
+		assert.NotContains(t, kv.Value.Emit(), "token123")
+	}
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+}
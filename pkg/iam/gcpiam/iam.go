@@ -3,11 +3,14 @@ package gcpiam
 import (
 	"context"
 
+	"github.com/jenkins-x-plugins/secretfacade/pkg/tracing"
 	"golang.org/x/oauth2/google"
 )
 
 func DefaultCredentials() (*google.Credentials, error) {
-	adc, err := google.FindDefaultCredentials(context.TODO(), "https://www.googleapis.com/auth/cloud-platform")
+	ctx, span := tracing.Start(context.TODO(), "gcpiam.DefaultCredentials")
+	adc, err := google.FindDefaultCredentials(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
@@ -7,7 +7,9 @@ import (
 	"strings"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/tracing"
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"go.opentelemetry.io/otel/attribute"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -39,7 +41,13 @@ func NewEnvironmentCreds() (VaultCreds, error) {
 }
 
 func NewExternalSecretCreds(client *api.Client, kubeClient kubernetes.Interface) (VaultCreds, error) {
-	token, err := getTokenForExternalVault(client, kubeClient)
+	return NewExternalSecretCredsWithContext(context.Background(), client, kubeClient)
+}
+
+// NewExternalSecretCredsWithContext is the same as NewExternalSecretCreds but allows the Kubernetes and Vault login calls
+// to be cancelled via the given context
+func NewExternalSecretCredsWithContext(ctx context.Context, client *api.Client, kubeClient kubernetes.Interface) (VaultCreds, error) {
+	token, err := getTokenForExternalVault(ctx, client, kubeClient)
 	if err != nil {
 		return VaultCreds{}, fmt.Errorf("error getting client token for external vault: %w", err)
 	}
@@ -53,7 +61,7 @@ func NewExternalSecretCreds(client *api.Client, kubeClient kubernetes.Interface)
 }
 
 // Taken from https://www.vaultproject.io/docs/auth/kubernetes#code-example
-func getTokenForExternalVault(client *api.Client, kubeClient kubernetes.Interface) (string, error) {
+func getTokenForExternalVault(ctx context.Context, client *api.Client, kubeClient kubernetes.Interface) (token string, err error) {
 	vaultMountPoint := os.Getenv("JX_VAULT_MOUNT_POINT")
 	if vaultMountPoint == "" {
 		vaultMountPoint = "kubernetes"
@@ -65,7 +73,16 @@ func getTokenForExternalVault(client *api.Client, kubeClient kubernetes.Interfac
 		log.Logger().Debug("Setting vault role to jx-vault as JX_VAULT_ROLE is missing")
 	}
 
-	secrets, err := kubeClient.CoreV1().Secrets(secretNamespace).List(context.TODO(), metav1.ListOptions{})
+	ctx, span := tracing.Start(ctx, "vaultiam.getTokenForExternalVault",
+		attribute.String("vault.address", client.Address()),
+		attribute.String("vault.mount_point", vaultMountPoint),
+		attribute.String("vault.role", vaultRole),
+	)
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	secrets, err := kubeClient.CoreV1().Secrets(secretNamespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return "", fmt.Errorf("error listing secrets: %w", err)
 	}
@@ -87,7 +104,7 @@ func getTokenForExternalVault(client *api.Client, kubeClient kubernetes.Interfac
 		return "", fmt.Errorf("could not find secret with prefix %s in %s namespace", externalSecretsPrefix, secretNamespace)
 	}
 
-	secret, err := kubeClient.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	secret, err := kubeClient.CoreV1().Secrets(secretNamespace).Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
 		return "", fmt.Errorf("error getting secret %s: %w", secretName, err)
 	}
@@ -96,7 +113,7 @@ func getTokenForExternalVault(client *api.Client, kubeClient kubernetes.Interfac
 		return "", fmt.Errorf("data field in secret %s is missing", secretName)
 	}
 
-	token := string(secret.Data["token"])
+	token = string(secret.Data["token"])
 
 	if token == "" {
 		return "", fmt.Errorf("could not retrieve jwt token from secret %s", secretName)
@@ -107,7 +124,7 @@ func getTokenForExternalVault(client *api.Client, kubeClient kubernetes.Interfac
 		"role": vaultRole,
 	}
 	// log in to Vault's Kubernetes auth method
-	resp, err := client.Logical().Write("auth/"+vaultMountPoint+"/login", params)
+	resp, err := client.Logical().WriteWithContext(ctx, "auth/"+vaultMountPoint+"/login", params)
 	if err != nil {
 		return "", fmt.Errorf("unable to log in with Kubernetes auth at mount point %s using role %s: %w", vaultMountPoint, vaultRole, err)
 	}
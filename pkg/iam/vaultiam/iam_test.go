@@ -4,11 +4,23 @@
 package vaultiam_test
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
+	"github.com/hashicorp/vault/api"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/iam/vaultiam"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
 )
 
 const testToken = "token123"
@@ -48,3 +60,35 @@ func TestNewEnvironmentCreds(t *testing.T) {
 		}
 	}
 }
+
+func TestNewExternalSecretCredsCreatesSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(previous)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/auth/kubernetes/login", r.URL.Path)
+		_, _ = w.Write([]byte(`{"auth": {"client_token": "` + testToken + `"}}`))
+	}))
+	defer server.Close()
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+	kubeClient := k8sfake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubernetes-external-secrets-token-abc", Namespace: "secret-infra"},
+		Data:       map[string][]byte{"token": []byte("jwt")},
+	})
+
+	creds, err := vaultiam.NewExternalSecretCredsWithContext(context.Background(), client, kubeClient)
+
+	require.NoError(t, err)
+	assert.Equal(t, testToken, creds.Token)
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "vaultiam.getTokenForExternalVault", spans[0].Name)
+	assert.Contains(t, spans[0].Attributes, attribute.String("vault.role", "jx-vault"))
+	for _, kv := range spans[0].Attributes {
+		assert.NotContains(t, kv.Value.Emit(), testToken)
+		assert.NotContains(t, kv.Value.Emit(), "jwt")
+	}
+}
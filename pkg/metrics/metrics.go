@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Error classes used as the error_class label of the errors counter
+const (
+	ErrorClassSecretNotFound   = "secret_not_found"
+	ErrorClassKeyNotFound      = "key_not_found"
+	ErrorClassPermissionDenied = "permission_denied"
+	ErrorClassAlreadyExists    = "already_exists"
+	ErrorClassConflict         = "conflict"
+	ErrorClassTransient        = "transient"
+	ErrorClassNotSupported     = "not_supported"
+	ErrorClassReadOnly         = "read_only"
+	ErrorClassCanceled         = "canceled"
+	ErrorClassDeadlineExceeded = "deadline_exceeded"
+	ErrorClassUnknown          = "unknown"
+)
+
+// Options configures the metrics. A nil *Options uses the defaults
+type Options struct {
+	// Namespace prefixes the metric names, it defaults to secretfacade
+	Namespace string
+	// Buckets are the latency histogram buckets in seconds, they default to prometheus.DefBuckets
+	Buckets []float64
+}
+
+// Collector is a prometheus.Collector recording the calls made to secret managers decorated with its Middleware.
+// Register it with a prometheus.Registerer to expose the metrics
+type Collector struct {
+	operations *prometheus.CounterVec
+	errors     *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+}
+
+// NewCollector creates a Collector
+func NewCollector(options *Options) *Collector {
+	namespace := "secretfacade"
+	buckets := prometheus.DefBuckets
+	if options != nil {
+		if options.Namespace != "" {
+			namespace = options.Namespace
+		}
+		if len(options.Buckets) > 0 {
+			buckets = options.Buckets
+		}
+	}
+	labels := []string{"store_type", "operation"}
+	return &Collector{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "secretstore",
+			Name:      "operations_total",
+			Help:      "Number of operations made to secret stores.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "secretstore",
+			Name:      "errors_total",
+			Help:      "Number of failed operations made to secret stores by error class.",
+		}, append(labels, "error_class")),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "secretstore",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of operations made to secret stores.",
+			Buckets:   buckets,
+		}, labels),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.operations.Describe(ch)
+	c.errors.Describe(ch)
+	c.duration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.operations.Collect(ch)
+	c.errors.Collect(ch)
+	c.duration.Collect(ch)
+}
+
+// Middleware records the calls made to a secret manager of the store type. It can be passed to
+// factory.SecretManagerFactory as a secretstore.StoreMiddleware
+func (c *Collector) Middleware(storeType secretstore.Type) secretstore.Middleware {
+	return secretstore.Intercept(func(ctx context.Context, call *secretstore.Call, invoke func(ctx context.Context) error) error {
+		start := time.Now()
+		err := invoke(ctx)
+		operation := string(call.Operation)
+		c.operations.WithLabelValues(string(storeType), operation).Inc()
+		c.duration.WithLabelValues(string(storeType), operation).Observe(time.Since(start).Seconds())
+		if err != nil {
+			c.errors.WithLabelValues(string(storeType), operation, ErrorClass(err)).Inc()
+		}
+		return err
+	})
+}
+
+// ErrorClass returns the error class of an error returned by a secret manager
+func ErrorClass(err error) string {
+	switch {
+	case errors.Is(err, secretstore.ErrSecretNotFound):
+		return ErrorClassSecretNotFound
+	case errors.Is(err, secretstore.ErrKeyNotFound):
+		return ErrorClassKeyNotFound
+	case errors.Is(err, secretstore.ErrPermissionDenied):
+		return ErrorClassPermissionDenied
+	case errors.Is(err, secretstore.ErrAlreadyExists):
+		return ErrorClassAlreadyExists
+	case errors.Is(err, secretstore.ErrConflict):
+		return ErrorClassConflict
+	case errors.Is(err, secretstore.ErrTransient):
+		return ErrorClassTransient
+	case errors.Is(err, secretstore.ErrNotSupported):
+		return ErrorClassNotSupported
+	case errors.Is(err, secretstore.ErrReadOnly):
+		return ErrorClassReadOnly
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassDeadlineExceeded
+	}
+	return ErrorClassUnknown
+}
@@ -0,0 +1,58 @@
+//go:build unit
+// +build unit
+
+package metrics_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/metrics"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	collector := metrics.NewCollector(nil)
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(collector))
+	mgr := secretstore.Chain(fake.NewFakeSecretStore(), collector.Middleware(secretstore.SecretStoreTypeVault))
+
+	require.NoError(t, mgr.SetSecret("loc", "db", &secretstore.SecretValue{Value: "pwd"}))
+	_, err := mgr.GetSecret("loc", "db", "")
+	require.NoError(t, err)
+	_, err = mgr.GetSecret("loc", "missing", "")
+	require.Error(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = mgr.GetSecretWithContext(ctx, "loc", "db", "")
+	require.Error(t, err)
+
+	expected := `
+# HELP secretfacade_secretstore_errors_total Number of failed operations made to secret stores by error class.
+# TYPE secretfacade_secretstore_errors_total counter
+secretfacade_secretstore_errors_total{error_class="canceled",operation="GetSecret",store_type="vault"} 1
+secretfacade_secretstore_errors_total{error_class="secret_not_found",operation="GetSecret",store_type="vault"} 1
+# HELP secretfacade_secretstore_operations_total Number of operations made to secret stores.
+# TYPE secretfacade_secretstore_operations_total counter
+secretfacade_secretstore_operations_total{operation="GetSecret",store_type="vault"} 3
+secretfacade_secretstore_operations_total{operation="SetSecret",store_type="vault"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"secretfacade_secretstore_operations_total", "secretfacade_secretstore_errors_total"))
+	count, err := testutil.GatherAndCount(registry, "secretfacade_secretstore_operation_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, metrics.ErrorClassKeyNotFound, metrics.ErrorClass(secretstore.NewKeyNotFoundError("loc", "db", "key")))
+	assert.Equal(t, metrics.ErrorClassTransient, metrics.ErrorClass(secretstore.NewError(secretstore.ErrTransient, "loc", "db", nil)))
+	assert.Equal(t, metrics.ErrorClassDeadlineExceeded, metrics.ErrorClass(context.DeadlineExceeded))
+	assert.Equal(t, metrics.ErrorClassUnknown, metrics.ErrorClass(assert.AnError))
+}
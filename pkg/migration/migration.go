@@ -0,0 +1,309 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/dryrun"
+)
+
+// WholeValue is reported by Diff when the plain Value of a secret, rather than a property, differs
+const WholeValue = "<value>"
+
+// ErrVerificationFailed is returned for secrets whose target differs from the source after migrating them
+var ErrVerificationFailed = errors.New("target secret differs from source")
+
+// ExistingPolicy decides what happens to secrets which already exist in the target
+type ExistingPolicy string
+
+const (
+	// ExistingSkip leaves existing secrets unchanged, this is the default
+	ExistingSkip ExistingPolicy = "skip"
+	// ExistingOverwrite replaces existing secrets with the source secret, removing the properties, labels and
+	// annotations which are not in the source secret
+	ExistingOverwrite ExistingPolicy = "overwrite"
+	// ExistingFail reports existing secrets which differ from the source as ErrAlreadyExists errors
+	ExistingFail ExistingPolicy = "fail"
+)
+
+// Action is what the migration did, or would do in a dry run, to a secret
+type Action string
+
+const (
+	ActionCreate    Action = "create"
+	ActionOverwrite Action = "overwrite"
+	ActionSkip      Action = "skip"
+	ActionUnchanged Action = "unchanged"
+	ActionFailed    Action = "failed"
+)
+
+// Options configures a migration
+type Options struct {
+	// Rules select the secrets to migrate and where to. Each secret is migrated by the first rule matching it
+	Rules    []Rule
+	Existing ExistingPolicy
+	// DryRun plans the changes to the target without making them, see Report.Plan
+	DryRun bool
+	// Verify reads every secret back from the source and target once the migration is done and compares them
+	Verify bool
+	// TargetType is the store type of the target. Secrets with a plain value fail to migrate to store types which only
+	// store properties, such as Kubernetes and Vault, unless ValueKey is set
+	TargetType secretstore.Type
+	// ValueKey is the property the plain value of a secret is written to when the target only stores properties
+	ValueKey string
+}
+
+// Result is the outcome of migrating a single secret
+type Result struct {
+	SourceLocation string
+	SourceName     string
+	TargetLocation string
+	TargetName     string
+	Action         Action
+	// Differences are the properties of the target that differ from the source, found by the verification pass.
+	// Skipped secrets are compared too, but differences in them are not errors
+	Differences []string
+	Err         error
+}
+
+// Report is the outcome of a migration
+type Report struct {
+	Results []Result
+	// Plan is the changes a dry run would make to the target
+	Plan *dryrun.Plan
+}
+
+// Err joins the errors of the failed secrets
+func (r *Report) Err() error {
+	var errs []error
+	for i := range r.Results {
+		errs = append(errs, r.Results[i].Err)
+	}
+	return errors.Join(errs...)
+}
+
+// Summary counts the secrets by action, such as "2 create, 1 skip, 0 unchanged"
+func (r *Report) Summary() string {
+	counts := map[Action]int{}
+	for i := range r.Results {
+		counts[r.Results[i].Action]++
+	}
+	parts := []string{}
+	for _, action := range []Action{ActionCreate, ActionOverwrite, ActionSkip, ActionUnchanged, ActionFailed} {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[action], action))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Migrate copies secrets from source to target according to the rules. Secrets are copied whole, including property
+// values, labels, annotations and secret type, so a multi property secret keeps its layout in the target. An error is
+// returned straight away if the rules are invalid or a source location cannot be listed, otherwise the report lists
+// every secret and the returned error joins the errors of the secrets which failed
+func Migrate(ctx context.Context, source, target secretstore.Interface, options *Options) (*Report, error) {
+	if options == nil {
+		options = &Options{}
+	}
+	existing := options.Existing
+	switch existing {
+	case "":
+		existing = ExistingSkip
+	case ExistingSkip, ExistingOverwrite, ExistingFail:
+	default:
+		return nil, fmt.Errorf("unknown existing secret policy %q", existing)
+	}
+	rules := make([]*compiledRule, 0, len(options.Rules))
+	for i := range options.Rules {
+		rule, err := compileRule(&options.Rules[i])
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	results, err := plan(ctx, source, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	var dryRun *dryrun.SecretStore
+	if options.DryRun {
+		dryRun = dryrun.NewSecretStore(target)
+		target = dryRun
+	}
+	report := &Report{Results: results}
+	for i := range report.Results {
+		result := &report.Results[i]
+		if result.Err == nil {
+			migrate(ctx, source, target, options, existing, result)
+		}
+		if result.Err != nil {
+			result.Action = ActionFailed
+		}
+	}
+	if dryRun != nil {
+		report.Plan = dryRun.Plan()
+	} else if options.Verify {
+		for i := range report.Results {
+			verify(ctx, source, target, options, &report.Results[i])
+		}
+	}
+	return report, report.Err()
+}
+
+// plan lists the source locations and maps every secret to its target
+func plan(ctx context.Context, source secretstore.Interface, rules []*compiledRule) ([]Result, error) {
+	var results []Result
+	sources := map[string]bool{}
+	targets := map[string]string{}
+	for _, rule := range rules {
+		names, err := source.ListSecrets(ctx, rule.SourceLocation, &secretstore.ListOptions{Prefix: rule.Prefix}).Names()
+		if err != nil {
+			return nil, fmt.Errorf("error listing secrets to migrate in %s: %w", rule.SourceLocation, err)
+		}
+		for _, name := range names {
+			sourceKey := rule.SourceLocation + "/" + name
+			if sources[sourceKey] {
+				continue
+			}
+			targetLocation, targetName, ok := rule.target(name)
+			if !ok {
+				continue
+			}
+			sources[sourceKey] = true
+			result := Result{
+				SourceLocation: rule.SourceLocation,
+				SourceName:     name,
+				TargetLocation: targetLocation,
+				TargetName:     targetName,
+			}
+			targetKey := targetLocation + "/" + targetName
+			if other, ok := targets[targetKey]; ok {
+				result.Err = fmt.Errorf("secrets %s and %s are both migrated to %s", other, sourceKey, targetKey)
+			}
+			targets[targetKey] = sourceKey
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func migrate(ctx context.Context, source, target secretstore.Interface, options *Options, existing ExistingPolicy, result *Result) {
+	value, err := source.GetSecretValue(ctx, result.SourceLocation, result.SourceName)
+	if err != nil {
+		result.Err = fmt.Errorf("error reading secret %s in %s: %w", result.SourceName, result.SourceLocation, err)
+		return
+	}
+	value, err = options.targetValue(value, result)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	current, err := target.GetSecretValue(ctx, result.TargetLocation, result.TargetName)
+	switch {
+	case errors.Is(err, secretstore.ErrSecretNotFound):
+		result.Action = ActionCreate
+	case err != nil:
+		result.Err = fmt.Errorf("error reading secret %s in %s: %w", result.TargetName, result.TargetLocation, err)
+		return
+	case len(Diff(value, current)) == 0:
+		result.Action = ActionUnchanged
+		return
+	case existing == ExistingSkip:
+		result.Action = ActionSkip
+		return
+	case existing == ExistingFail:
+		result.Err = secretstore.NewError(secretstore.ErrAlreadyExists, result.TargetLocation, result.TargetName,
+			fmt.Errorf("secret %s already exists in %s with a different value", result.TargetName, result.TargetLocation))
+		return
+	default:
+		result.Action = ActionOverwrite
+	}
+
+	value.Version = ""
+	value.ExpectedVersion = ""
+	value.Overwrite = true
+	err = target.SetSecretWithContext(ctx, result.TargetLocation, result.TargetName, value)
+	if err != nil {
+		result.Err = fmt.Errorf("error writing secret %s to %s: %w", result.TargetName, result.TargetLocation, err)
+	}
+}
+
+// targetValue returns the value to write to the target, moving a plain value to ValueKey if the target only stores
+// properties. Without a ValueKey such secrets fail rather than being written to the target without their value
+func (o *Options) targetValue(value *secretstore.SecretValue, result *Result) (*secretstore.SecretValue, error) {
+	if value.Value == "" || !o.TargetType.PropertiesOnly() {
+		return value, nil
+	}
+	if o.ValueKey == "" {
+		return nil, secretstore.NewError(secretstore.ErrNotSupported, result.TargetLocation, result.TargetName,
+			fmt.Errorf("secret %s in %s has a plain value which %s secrets cannot store, set a value key to write it to",
+				result.SourceName, result.SourceLocation, o.TargetType))
+	}
+	value.PropertyValues = map[string]string{o.ValueKey: value.Value}
+	value.Value = ""
+	return value, nil
+}
+
+func verify(ctx context.Context, source, target secretstore.Interface, options *Options, result *Result) {
+	if result.Err != nil {
+		return
+	}
+	value, err := source.GetSecretValue(ctx, result.SourceLocation, result.SourceName)
+	if err != nil {
+		result.Err = fmt.Errorf("error reading secret %s in %s to verify it: %w", result.SourceName, result.SourceLocation, err)
+		return
+	}
+	value, err = options.targetValue(value, result)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	migrated, err := target.GetSecretValue(ctx, result.TargetLocation, result.TargetName)
+	if err != nil {
+		result.Err = fmt.Errorf("error reading secret %s in %s to verify it: %w", result.TargetName, result.TargetLocation, err)
+		return
+	}
+	result.Differences = Diff(value, migrated)
+	if len(result.Differences) > 0 && result.Action != ActionSkip {
+		result.Err = fmt.Errorf("secret %s in %s differs in %s: %w", result.TargetName, result.TargetLocation,
+			strings.Join(result.Differences, ", "), ErrVerificationFailed)
+	}
+}
+
+// Diff returns the sorted names of the properties which differ between two secret values, or WholeValue when their
+// plain values differ. Only the data is compared as not every secret store keeps labels, annotations and secret type.
+// A plain value holding a JSON object is compared as properties, as the secret stores which keep a single string per
+// secret store property values that way
+func Diff(a, b *secretstore.SecretValue) []string {
+	a, b = normalize(a), normalize(b)
+	if a.Value != "" || b.Value != "" {
+		if a.Value != b.Value {
+			return []string{WholeValue}
+		}
+		return nil
+	}
+	var keys []string
+	for k, v := range a.PropertyValues {
+		if other, ok := b.PropertyValues[k]; !ok || other != v {
+			keys = append(keys, k)
+		}
+	}
+	for k := range b.PropertyValues {
+		if _, ok := a.PropertyValues[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func normalize(value *secretstore.SecretValue) *secretstore.SecretValue {
+	if value.Value == "" {
+		return value
+	}
+	return secretstore.NewSecretValueFromString(value.Value)
+}
@@ -0,0 +1,195 @@
+//go:build unit
+// +build unit
+
+package migration_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/migration"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/dryrun"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/kubernetessecrets"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func newSource(t *testing.T) *fake.SecretStore {
+	source := fake.NewFakeSecretStore()
+	require.NoError(t, source.SetSecret("secret/jx", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin", "password": "hunter2"},
+		Labels:         map[string]string{"team": "data"},
+		SecretType:     corev1.SecretTypeBasicAuth,
+	}))
+	require.NoError(t, source.SetSecret("secret/jx", "webhook", &secretstore.SecretValue{Value: "hmac"}))
+	require.NoError(t, source.SetSecret("secret/jx", "tmp-token", &secretstore.SecretValue{Value: "token"}))
+	return source
+}
+
+var rules = []migration.Rule{{
+	SourceLocation: "secret/jx",
+	TargetLocation: "my-project",
+	Include:        "(.*)",
+	Exclude:        "tmp-.*",
+	Rename:         "jx-$1",
+}}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	source := newSource(t)
+	target := fake.NewFakeSecretStore()
+
+	report, err := migration.Migrate(ctx, source, target, &migration.Options{Rules: rules, Verify: true})
+	require.NoError(t, err)
+	assert.Equal(t, []migration.Result{
+		{SourceLocation: "secret/jx", SourceName: "db", TargetLocation: "my-project", TargetName: "jx-db", Action: migration.ActionCreate},
+		{SourceLocation: "secret/jx", SourceName: "webhook", TargetLocation: "my-project", TargetName: "jx-webhook", Action: migration.ActionCreate},
+	}, report.Results)
+	assert.Equal(t, "2 create, 0 overwrite, 0 skip, 0 unchanged, 0 failed", report.Summary())
+
+	value, err := target.GetSecretValue(ctx, "my-project", "jx-db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "hunter2"}, value.PropertyValues)
+	assert.Equal(t, map[string]string{"team": "data"}, value.Labels)
+	assert.Equal(t, corev1.SecretTypeBasicAuth, value.SecretType)
+
+	report, err = migration.Migrate(ctx, source, target, &migration.Options{Rules: rules})
+	require.NoError(t, err)
+	for _, result := range report.Results {
+		assert.Equal(t, migration.ActionUnchanged, result.Action)
+	}
+}
+
+func TestMigrateExistingSecrets(t *testing.T) {
+	ctx := context.Background()
+	source := newSource(t)
+	target := fake.NewFakeSecretStore()
+	require.NoError(t, target.SetSecret("my-project", "jx-db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin", "password": "old", "host": "db"},
+	}))
+
+	report, err := migration.Migrate(ctx, source, target, &migration.Options{Rules: rules, Verify: true})
+	require.NoError(t, err)
+	assert.Equal(t, migration.ActionSkip, report.Results[0].Action)
+	assert.Equal(t, []string{"host", "password"}, report.Results[0].Differences)
+
+	report, err = migration.Migrate(ctx, source, target, &migration.Options{Rules: rules, Existing: migration.ExistingFail})
+	assert.ErrorIs(t, err, secretstore.ErrAlreadyExists)
+	assert.Equal(t, migration.ActionFailed, report.Results[0].Action)
+	assert.Equal(t, migration.ActionUnchanged, report.Results[1].Action)
+
+	report, err = migration.Migrate(ctx, source, target, &migration.Options{Rules: rules, Existing: migration.ExistingOverwrite, Verify: true})
+	require.NoError(t, err)
+	assert.Equal(t, migration.ActionOverwrite, report.Results[0].Action)
+	assert.Empty(t, report.Results[0].Differences)
+	value, err := target.GetSecretValue(ctx, "my-project", "jx-db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "hunter2"}, value.PropertyValues)
+}
+
+func TestMigrateOverwriteRemovesExtraKeys(t *testing.T) {
+	ctx := context.Background()
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "jx-db", Namespace: "jx", Labels: map[string]string{"stale": "true"}},
+		Data:       map[string][]byte{"username": []byte("admin"), "password": []byte("old"), "host": []byte("db")},
+	}
+	target := kubernetessecrets.NewKubernetesSecretManager(k8sfake.NewSimpleClientset(existing))
+
+	report, err := migration.Migrate(ctx, newSource(t), target, &migration.Options{
+		Rules:    []migration.Rule{{SourceLocation: "secret/jx", TargetLocation: "jx", Include: "db", Rename: "jx-db"}},
+		Existing: migration.ExistingOverwrite,
+		Verify:   true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, migration.ActionOverwrite, report.Results[0].Action)
+	assert.Empty(t, report.Results[0].Differences)
+	value, err := target.GetSecretValue(ctx, "jx", "jx-db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "hunter2"}, value.PropertyValues)
+	assert.Equal(t, map[string]string{"team": "data"}, value.Labels)
+}
+
+func TestMigratePlainValueToPropertiesOnlyStore(t *testing.T) {
+	ctx := context.Background()
+	target := kubernetessecrets.NewKubernetesSecretManager(k8sfake.NewSimpleClientset())
+	options := &migration.Options{
+		Rules:      []migration.Rule{{SourceLocation: "secret/jx", TargetLocation: "jx", Include: "webhook"}},
+		Verify:     true,
+		TargetType: secretstore.SecretStoreTypeKubernetes,
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		options.DryRun = dryRun
+		report, err := migration.Migrate(ctx, newSource(t), target, options)
+		assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+		assert.Equal(t, migration.ActionFailed, report.Results[0].Action)
+		_, err = target.GetSecretValue(ctx, "jx", "webhook")
+		assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+	}
+
+	options.DryRun = false
+	options.ValueKey = "value"
+	report, err := migration.Migrate(ctx, newSource(t), target, options)
+	require.NoError(t, err)
+	assert.Equal(t, migration.ActionCreate, report.Results[0].Action)
+	assert.Empty(t, report.Results[0].Differences)
+	value, err := target.GetSecretValue(ctx, "jx", "webhook")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"value": "hmac"}, value.PropertyValues)
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	ctx := context.Background()
+	target := fake.NewFakeSecretStore()
+
+	report, err := migration.Migrate(ctx, newSource(t), target, &migration.Options{Rules: rules, DryRun: true, Verify: true})
+	require.NoError(t, err)
+	require.NotNil(t, report.Plan)
+	require.Len(t, report.Plan.Changes, 2)
+	assert.Equal(t, dryrun.ActionCreate, report.Plan.Changes[0].Action)
+	assert.Equal(t, []string{"password", "username"}, report.Plan.Changes[0].AddedKeys)
+	_, err = target.GetSecretValue(ctx, "my-project", "jx-db")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+}
+
+func TestMigrateRejectsConflictingTargets(t *testing.T) {
+	report, err := migration.Migrate(context.Background(), newSource(t), fake.NewFakeSecretStore(), &migration.Options{
+		Rules: []migration.Rule{{SourceLocation: "secret/jx", TargetLocation: "my-project", Rename: "all"}},
+	})
+	require.Error(t, err)
+	assert.Equal(t, migration.ActionCreate, report.Results[0].Action)
+	assert.Equal(t, migration.ActionFailed, report.Results[1].Action)
+	assert.Equal(t, migration.ActionFailed, report.Results[2].Action)
+
+	_, err = migration.Migrate(context.Background(), newSource(t), fake.NewFakeSecretStore(), &migration.Options{
+		Rules: []migration.Rule{{SourceLocation: "secret/jx", Include: "("}},
+	})
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	properties := &secretstore.SecretValue{PropertyValues: map[string]string{"a": "1", "b": "2"}}
+	assert.Empty(t, migration.Diff(properties, &secretstore.SecretValue{Value: `{"a":"1","b":"2"}`}))
+	assert.Equal(t, []string{"b", "c"}, migration.Diff(properties, &secretstore.SecretValue{PropertyValues: map[string]string{"a": "1", "c": "3"}}))
+	assert.Equal(t, []string{migration.WholeValue}, migration.Diff(properties, &secretstore.SecretValue{Value: "plain"}))
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`rules:
+- sourceLocation: secret/jx
+  targetLocation: my-project
+  include: "(.*)"
+  rename: jx-$1
+`), 0o600))
+	loaded, err := migration.LoadRules(path)
+	require.NoError(t, err)
+	assert.Equal(t, []migration.Rule{{SourceLocation: "secret/jx", TargetLocation: "my-project", Include: "(.*)", Rename: "jx-$1"}}, loaded)
+}
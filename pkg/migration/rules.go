@@ -0,0 +1,99 @@
+package migration
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule maps the secrets of a source location to a target location. Include, Exclude and Rename select and rename the
+// secrets, so that for example every secret in a Vault mount can be copied to a GCP project with a prefix
+type Rule struct {
+	// SourceLocation is the location the secrets are listed in
+	SourceLocation string `json:"sourceLocation" yaml:"sourceLocation"`
+	// TargetLocation is the location the secrets are written to, defaults to SourceLocation
+	TargetLocation string `json:"targetLocation,omitempty" yaml:"targetLocation,omitempty"`
+	// Prefix only lists the secrets whose name starts with the prefix, which saves listing every secret in stores
+	// with hierarchical names such as Vault
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	// Include is a regular expression matched against the whole secret name, empty includes every secret
+	Include string `json:"include,omitempty" yaml:"include,omitempty"`
+	// Exclude is a regular expression matched against the whole secret name, matching secrets are not migrated
+	Exclude string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	// Rename is the name of the target secret, which can refer to the submatches of Include as $1 or ${name}. Empty
+	// keeps the source name
+	Rename string `json:"rename,omitempty" yaml:"rename,omitempty"`
+}
+
+// Rules is the file format read by LoadRules
+type Rules struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// LoadRules reads the rules from a YAML or JSON file
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migration rules: %w", err)
+	}
+	rules := Rules{}
+	err = yaml.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing migration rules %s: %w", path, err)
+	}
+	return rules.Rules, nil
+}
+
+type compiledRule struct {
+	*Rule
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func compileRule(rule *Rule) (*compiledRule, error) {
+	if rule.SourceLocation == "" {
+		return nil, fmt.Errorf("migration rule has no source location")
+	}
+	c := &compiledRule{Rule: rule}
+	var err error
+	if rule.Include != "" {
+		c.include, err = regexp.Compile("^(?:" + rule.Include + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern of migration rule for %s: %w", rule.SourceLocation, err)
+		}
+	}
+	if rule.Exclude != "" {
+		c.exclude, err = regexp.Compile("^(?:" + rule.Exclude + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern of migration rule for %s: %w", rule.SourceLocation, err)
+		}
+	}
+	return c, nil
+}
+
+// target returns the target location and name of the secret and whether the rule matches it
+func (c *compiledRule) target(secretName string) (location, name string, ok bool) {
+	if c.exclude != nil && c.exclude.MatchString(secretName) {
+		return "", "", false
+	}
+	location = c.TargetLocation
+	if location == "" {
+		location = c.SourceLocation
+	}
+	if c.include == nil {
+		if c.Rename != "" {
+			return location, c.Rename, true
+		}
+		return location, secretName, true
+	}
+	match := c.include.FindStringSubmatchIndex(secretName)
+	if match == nil {
+		return "", "", false
+	}
+	if c.Rename == "" {
+		return location, secretName, true
+	}
+	return location, string(c.include.ExpandString(nil, c.Rename, secretName, match)), true
+}
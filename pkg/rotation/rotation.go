@@ -0,0 +1,377 @@
+package rotation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretref"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/awssecretsmanager"
+)
+
+// RotatedAtAnnotation records when a secret was last rotated, in RFC 3339 format. It is used to work out the age of
+// secrets in stores without versions, such as Kubernetes
+const RotatedAtAnnotation = "secretfacade.jenkins-x.io/rotated-at"
+
+// State describes where a secret is in its rotation
+type State string
+
+const (
+	// StateUpToDate the secret is not due for rotation
+	StateUpToDate State = "up-to-date"
+	// StateDue the secret is due for rotation
+	StateDue State = "due"
+	// StateRotated the secret was rotated
+	StateRotated State = "rotated"
+	// StateFailed rotating the secret failed, Status.Err holds the error
+	StateFailed State = "failed"
+	// StateUnknown when the secret was last rotated cannot be established, so Reconcile does not rotate it
+	StateUnknown State = "unknown"
+	// StateDiverged the new value was verified, so it may be in use, but it was not written to the secret store and
+	// was not rolled back. Status.Err holds the error
+	StateDiverged State = "diverged"
+)
+
+// ErrDiverged is returned when a verified value could not be written to the secret store and was not rolled back
+var ErrDiverged = errors.New("rotated value was verified but not written to the secret store")
+
+// Generator creates the new value of a secret. Property values are merged in to the current value of the secret, so a
+// generator only needs to return the properties it rotates
+type Generator interface {
+	Generate(ctx context.Context) (*secretstore.SecretValue, error)
+}
+
+// GeneratorFunc adapts a function to a Generator
+type GeneratorFunc func(ctx context.Context) (*secretstore.SecretValue, error)
+
+func (f GeneratorFunc) Generate(ctx context.Context) (*secretstore.SecretValue, error) {
+	return f(ctx)
+}
+
+// Policy decides when a secret is rotated and how long the previous version stays available. A secret is due for
+// rotation once either MaxAge or Schedule says so. The age of a secret is unknown if it was not written by a Rotator
+// and its secret store has no version creation times, or if the secret store keeps neither version creation times
+// nor annotations, such as AWS Parameter Store, Vault KV v1 and sops files. A secret of unknown age is only rotated by
+// Rotate, rather than by every Reconcile
+type Policy struct {
+	// MaxAge rotates the secret once it is older than MaxAge
+	MaxAge time.Duration
+	// Schedule rotates the secret at the next scheduled time after it was last rotated
+	Schedule Schedule
+	// GracePeriod is how long versions replaced by a newer version stay enabled before they are disabled, so that
+	// consumers still using the previous value keep working. Zero leaves previous versions enabled. It only applies
+	// to secret stores with versions
+	GracePeriod time.Duration
+}
+
+// Event is passed to hooks
+type Event struct {
+	Ref *secretref.Ref
+	// Previous is the value of the secret before the rotation, nil if the secret did not exist
+	Previous *secretstore.SecretValue
+	// Next is the new value of the secret, merged with the previous value. Its Version is set once it has been written
+	Next *secretstore.SecretValue
+}
+
+// Hook is called during a rotation, returning an error fails the rotation
+type Hook func(ctx context.Context, event *Event) error
+
+// Rotation describes how a secret is rotated
+type Rotation struct {
+	// Ref is the secret to rotate, its SecretKey is ignored
+	Ref       *secretref.Ref
+	Generator Generator
+	Policy    Policy
+	// Verify is called with the new value before it is written, for example to set and test a new database password.
+	// The rotation is abandoned without writing the secret if Verify fails
+	Verify Hook
+	// Rollback is called when the new value was verified but could not be written, for example because another
+	// rotation wrote the secret first, to undo the changes made by Verify such as setting a database password. Without
+	// Rollback, or if it fails, the rotation ends in StateDiverged
+	Rollback Hook
+	// Commit is called once the new value has been written, for example to restart the consumers of the secret
+	Commit Hook
+	// AllowUnconditionalWrite writes the new value unconditionally to secret stores which cannot write conditionally
+	// on the version that was read, such as sops files or Azure Key Vault when creating the secret, so concurrent
+	// rotations can both succeed. Without it rotating secrets in those stores fails
+	AllowUnconditionalWrite bool
+}
+
+// Status reports the rotation state of a secret
+type Status struct {
+	Ref   *secretref.Ref
+	State State
+	// Version is the current version of the secret where the secret store has versions
+	Version string
+	// LastRotated is when the current value was written, zero if it is not known
+	LastRotated time.Time
+	// NextRotation is when the secret is next due for rotation, zero if the policy never rotates it
+	NextRotation time.Time
+	// DisabledVersions are the previous versions disabled because their grace period had passed
+	DisabledVersions []string
+	Err              error
+}
+
+// Rotator rotates secrets in any secret store. On AWS Secrets Manager the new version is staged as AWSPENDING before
+// AWSCURRENT is moved to it, leaving the previous version as AWSPREVIOUS; GCP, Azure and Vault KV v2 keep previous
+// values as older versions
+type Rotator struct {
+	resolver *secretref.Resolver
+	now      func() time.Time
+}
+
+// NewRotator creates a Rotator which uses factory to create secret managers, typically factory.SecretManagerFactory
+func NewRotator(factory secretstore.FactoryInterface) *Rotator {
+	return &Rotator{resolver: secretref.NewResolver(factory), now: time.Now}
+}
+
+// Status reports the rotation state of the secret without changing it
+func (r *Rotator) Status(ctx context.Context, rotation *Rotation) (*Status, error) {
+	mgr, err := r.resolver.Manager(rotation.Ref.StoreType)
+	if err != nil {
+		return nil, err
+	}
+	status, _, err := r.status(ctx, mgr, rotation)
+	return status, err
+}
+
+// Reconcile rotates the secret if it is due, creating it if it does not exist, and disables previous versions whose
+// grace period has passed
+func (r *Rotator) Reconcile(ctx context.Context, rotation *Rotation) (*Status, error) {
+	return r.rotate(ctx, rotation, false)
+}
+
+// Rotate rotates the secret whether or not it is due
+func (r *Rotator) Rotate(ctx context.Context, rotation *Rotation) (*Status, error) {
+	return r.rotate(ctx, rotation, true)
+}
+
+func (r *Rotator) rotate(ctx context.Context, rotation *Rotation, force bool) (*Status, error) {
+	mgr, err := r.resolver.Manager(rotation.Ref.StoreType)
+	if err != nil {
+		return nil, err
+	}
+	status, current, err := r.status(ctx, mgr, rotation)
+	if err != nil {
+		return nil, err
+	}
+	if force || status.State == StateDue {
+		err = r.write(ctx, mgr, rotation, current, status)
+		if err != nil {
+			status.State = StateFailed
+			if errors.Is(err, ErrDiverged) {
+				status.State = StateDiverged
+			}
+			status.Err = err
+			return status, err
+		}
+	}
+	err = r.disableExpiredVersions(ctx, mgr, rotation, status)
+	if err != nil {
+		status.State = StateFailed
+		status.Err = err
+		return status, err
+	}
+	return status, nil
+}
+
+// status works out the rotation state of the secret and returns its current value, nil if it does not exist
+func (r *Rotator) status(ctx context.Context, mgr secretstore.Interface, rotation *Rotation) (*Status, *secretstore.SecretValue, error) {
+	ref := rotation.Ref
+	status := &Status{Ref: ref, State: StateDue}
+	current, err := mgr.GetSecretValue(ctx, ref.Location, ref.SecretName)
+	if errors.Is(err, secretstore.ErrSecretNotFound) {
+		status.NextRotation = r.now()
+		return status, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading secret %s to rotate: %w", ref, err)
+	}
+	status.Version = current.Version
+	status.LastRotated, err = r.lastRotated(ctx, mgr, ref, current)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.schedule(rotation.Policy, status)
+	return status, current, nil
+}
+
+// lastRotated returns when the current version was created, or when the RotatedAtAnnotation says the secret was
+// rotated for secret stores without versions
+func (r *Rotator) lastRotated(ctx context.Context, mgr secretstore.Interface, ref *secretref.Ref, current *secretstore.SecretValue) (time.Time, error) {
+	if versioned, err := secretstore.AsVersionInterface(mgr); err == nil && current.Version != "" {
+		versions, err := versioned.ListSecretVersions(ctx, ref.Location, ref.SecretName)
+		if err != nil && !errors.Is(err, secretstore.ErrNotSupported) {
+			return time.Time{}, fmt.Errorf("error listing versions of secret %s to rotate: %w", ref, err)
+		}
+		for i := range versions {
+			if versions[i].Version == current.Version && !versions[i].CreatedAt.IsZero() {
+				return versions[i].CreatedAt, nil
+			}
+		}
+	}
+	rotatedAt, err := time.Parse(time.RFC3339, current.Annotations[RotatedAtAnnotation])
+	if err != nil {
+		return time.Time{}, nil
+	}
+	return rotatedAt, nil
+}
+
+// schedule sets the next rotation time and whether the secret is due
+func (r *Rotator) schedule(policy Policy, status *Status) {
+	if status.LastRotated.IsZero() {
+		status.State = StateUnknown
+		return
+	}
+	if policy.MaxAge > 0 {
+		status.NextRotation = status.LastRotated.Add(policy.MaxAge)
+	}
+	if policy.Schedule != nil {
+		next := policy.Schedule.Next(status.LastRotated)
+		if status.NextRotation.IsZero() || next.Before(status.NextRotation) {
+			status.NextRotation = next
+		}
+	}
+	if status.NextRotation.IsZero() || r.now().Before(status.NextRotation) {
+		status.State = StateUpToDate
+	}
+}
+
+// write generates, verifies and writes the new value of the secret and then calls the commit hook. The value is
+// written conditionally on the version that was read, or only if the secret still does not exist, so that concurrent
+// rotations of the same secret do not both succeed
+func (r *Rotator) write(ctx context.Context, mgr secretstore.Interface, rotation *Rotation, current *secretstore.SecretValue, status *Status) error {
+	ref := rotation.Ref
+	if current != nil && current.Version == "" && !rotation.AllowUnconditionalWrite {
+		return fmt.Errorf("unable to rotate secret %s as its secret store cannot write it conditionally, set AllowUnconditionalWrite to write it anyway: %w",
+			ref, secretstore.ErrNotSupported)
+	}
+	generated, err := rotation.Generator.Generate(ctx)
+	if err != nil {
+		return fmt.Errorf("error generating new value of secret %s: %w", ref, err)
+	}
+	now := r.now()
+	next := generated.DeepCopy()
+	if current != nil && next.Value == "" && !next.Overwrite {
+		merged := current.DeepCopy().PropertyValues
+		if merged == nil {
+			merged = map[string]string{}
+		}
+		for k, v := range next.PropertyValues {
+			merged[k] = v
+		}
+		next.PropertyValues = merged
+	}
+	if next.Annotations == nil {
+		next.Annotations = map[string]string{}
+	}
+	next.Annotations[RotatedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	event := &Event{Ref: ref, Previous: current, Next: next}
+
+	if rotation.Verify != nil {
+		if err := rotation.Verify(ctx, event); err != nil {
+			return fmt.Errorf("error verifying new value of secret %s: %w", ref, err)
+		}
+	}
+
+	if current != nil {
+		next.ExpectedVersion = current.Version
+	} else {
+		next.CreateOnly = true
+	}
+	err = mgr.SetSecretWithContext(ctx, ref.Location, ref.SecretName, next)
+	if errors.Is(err, secretstore.ErrNotSupported) && rotation.AllowUnconditionalWrite {
+		next.ExpectedVersion = ""
+		next.CreateOnly = false
+		err = mgr.SetSecretWithContext(ctx, ref.Location, ref.SecretName, next)
+	}
+	next.ExpectedVersion = ""
+	next.CreateOnly = false
+	if err != nil {
+		err = fmt.Errorf("error writing new value of secret %s: %w", ref, err)
+		if rotation.Verify == nil {
+			return err
+		}
+		return r.rollback(ctx, rotation, event, err)
+	}
+	status.LastRotated = now
+	status.NextRotation = time.Time{}
+	r.schedule(rotation.Policy, status)
+	status.State = StateRotated
+
+	written, err := mgr.GetSecretValue(ctx, ref.Location, ref.SecretName)
+	if err != nil {
+		return fmt.Errorf("error reading new value of secret %s: %w", ref, err)
+	}
+	status.Version = written.Version
+	next.Version = written.Version
+
+	if rotation.Commit != nil {
+		if err := rotation.Commit(ctx, event); err != nil {
+			return fmt.Errorf("error committing new value of secret %s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+// rollback calls the rollback hook once a verified value could not be written, returning writeErr if the rollback
+// succeeds and an ErrDiverged error otherwise
+func (r *Rotator) rollback(ctx context.Context, rotation *Rotation, event *Event, writeErr error) error {
+	if rotation.Rollback == nil {
+		return fmt.Errorf("%w: %w", ErrDiverged, writeErr)
+	}
+	err := rotation.Rollback(ctx, event)
+	if err != nil {
+		return fmt.Errorf("%w: %w, rolling back failed: %w", ErrDiverged, writeErr, err)
+	}
+	return writeErr
+}
+
+// disableExpiredVersions disables the enabled versions which were replaced by a newer version more than the grace
+// period ago
+func (r *Rotator) disableExpiredVersions(ctx context.Context, mgr secretstore.Interface, rotation *Rotation, status *Status) error {
+	if rotation.Policy.GracePeriod <= 0 || status.Version == "" {
+		return nil
+	}
+	versioned, err := secretstore.AsVersionInterface(mgr)
+	if err != nil {
+		return nil
+	}
+	ref := rotation.Ref
+	versions, err := versioned.ListSecretVersions(ctx, ref.Location, ref.SecretName)
+	if errors.Is(err, secretstore.ErrNotSupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error listing versions of secret %s: %w", ref, err)
+	}
+	now := r.now()
+	// versions are listed newest first, each version was replaced when the version before it in the list was created
+	for i := 1; i < len(versions); i++ {
+		version := versions[i]
+		if version.Version == status.Version || version.State != secretstore.VersionStateEnabled || isStaged(version) {
+			continue
+		}
+		if now.Sub(versions[i-1].CreatedAt) < rotation.Policy.GracePeriod {
+			continue
+		}
+		err = versioned.DisableSecretVersion(ctx, ref.Location, ref.SecretName, version.Version)
+		if err != nil {
+			return fmt.Errorf("error disabling version %s of secret %s: %w", version.Version, ref, err)
+		}
+		status.DisabledVersions = append(status.DisabledVersions, version.Version)
+	}
+	return nil
+}
+
+// isStaged returns true for AWS Secrets Manager versions which are current or pending
+func isStaged(version secretstore.SecretVersion) bool {
+	for _, stage := range version.Stages {
+		if stage == awssecretsmanager.CurrentStage || stage == awssecretsmanager.PendingStage {
+			return true
+		}
+	}
+	return false
+}
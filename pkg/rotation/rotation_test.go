@@ -0,0 +1,318 @@
+//go:build unit
+// +build unit
+
+package rotation
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretref"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ref = &secretref.Ref{StoreType: secretstore.SecretStoreTypeKubernetes, Location: "jx", SecretName: "db"}
+
+// versionedStore adds a fixed list of versions to the fake secret store
+type versionedStore struct {
+	*fake.SecretStore
+	versions []secretstore.SecretVersion
+	disabled []string
+}
+
+func (v *versionedStore) NewSecretManager(secretstore.Type) (secretstore.Interface, error) {
+	return v, nil
+}
+
+func (v *versionedStore) ListSecretVersions(context.Context, string, string) ([]secretstore.SecretVersion, error) {
+	return v.versions, nil
+}
+
+func (v *versionedStore) GetSecretVersion(context.Context, string, string, string) (*secretstore.SecretValue, error) {
+	return nil, secretstore.ErrNotSupported
+}
+
+func (v *versionedStore) DisableSecretVersion(_ context.Context, _, _, version string) error {
+	v.disabled = append(v.disabled, version)
+	return nil
+}
+
+func (v *versionedStore) DestroySecretVersion(context.Context, string, string, string) error {
+	return secretstore.ErrNotSupported
+}
+
+// annotationDroppingStore drops the annotations of the secrets written to the fake secret store, as AWS Parameter
+// Store and sops files do
+type annotationDroppingStore struct {
+	*fake.SecretStore
+}
+
+func (a *annotationDroppingStore) NewSecretManager(secretstore.Type) (secretstore.Interface, error) {
+	return a, nil
+}
+
+func (a *annotationDroppingStore) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	dropped := secretValue.DeepCopy()
+	dropped.Annotations = nil
+	return a.SecretStore.SetSecretWithContext(ctx, location, secretName, dropped)
+}
+
+// unconditionalStore drops the versions of the secrets in the fake secret store and cannot write conditionally, as
+// sops files do
+type unconditionalStore struct {
+	*fake.SecretStore
+}
+
+func (u *unconditionalStore) NewSecretManager(secretstore.Type) (secretstore.Interface, error) {
+	return u, nil
+}
+
+func (u *unconditionalStore) GetSecretValue(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	value, err := u.SecretStore.GetSecretValue(ctx, location, secretName)
+	if err != nil {
+		return nil, err
+	}
+	value.Version = ""
+	return value, nil
+}
+
+func (u *unconditionalStore) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	if secretValue.ExpectedVersion != "" || secretValue.CreateOnly {
+		return secretstore.ErrNotSupported
+	}
+	return u.SecretStore.SetSecretWithContext(ctx, location, secretName, secretValue)
+}
+
+func newTestRotator(factory secretstore.FactoryInterface) (*Rotator, *time.Time) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRotator(factory)
+	r.now = func() time.Time { return now }
+	return r, &now
+}
+
+func passwordGenerator() Generator {
+	count := 0
+	return GeneratorFunc(func(context.Context) (*secretstore.SecretValue, error) {
+		count++
+		return &secretstore.SecretValue{PropertyValues: map[string]string{"password": "generated-" + strconv.Itoa(count)}}, nil
+	})
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	factory := &fake.SecretManagerFactory{}
+	r, now := newTestRotator(factory)
+	var committed []*Event
+	rotation := &Rotation{
+		Ref:       ref,
+		Generator: passwordGenerator(),
+		Policy:    Policy{MaxAge: 24 * time.Hour},
+		Commit: func(_ context.Context, event *Event) error {
+			committed = append(committed, event)
+			return nil
+		},
+	}
+
+	status, err := r.Reconcile(ctx, rotation)
+	require.NoError(t, err)
+	assert.Equal(t, StateRotated, status.State)
+	assert.Equal(t, now.Add(24*time.Hour), status.NextRotation)
+	require.Len(t, committed, 1)
+	assert.Nil(t, committed[0].Previous)
+	assert.Equal(t, status.Version, committed[0].Next.Version)
+
+	store := factory.GetSecretStore()
+	value, err := store.GetSecretValue(ctx, "jx", "db")
+	require.NoError(t, err)
+	value.PropertyValues["username"] = "admin"
+	require.NoError(t, store.SetSecret("jx", "db", value))
+
+	*now = now.Add(time.Hour)
+	status, err = r.Reconcile(ctx, rotation)
+	require.NoError(t, err)
+	assert.Equal(t, StateUpToDate, status.State)
+	assert.Len(t, committed, 1)
+
+	*now = now.Add(24 * time.Hour)
+	status, err = r.Status(ctx, rotation)
+	require.NoError(t, err)
+	assert.Equal(t, StateDue, status.State)
+	status, err = r.Reconcile(ctx, rotation)
+	require.NoError(t, err)
+	assert.Equal(t, StateRotated, status.State)
+	require.Len(t, committed, 2)
+	assert.Equal(t, "generated-1", committed[1].Previous.PropertyValues["password"])
+
+	value, err = store.GetSecretValue(ctx, "jx", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "generated-2"}, value.PropertyValues)
+	assert.Equal(t, now.Format(time.RFC3339), value.Annotations[RotatedAtAnnotation])
+}
+
+func TestRotateFailsVerification(t *testing.T) {
+	ctx := context.Background()
+	factory := &fake.SecretManagerFactory{}
+	r, _ := newTestRotator(factory)
+	failed := errors.New("new password rejected")
+	rotation := &Rotation{
+		Ref:       ref,
+		Generator: passwordGenerator(),
+		Verify: func(_ context.Context, event *Event) error {
+			assert.Equal(t, "generated-1", event.Next.PropertyValues["password"])
+			return failed
+		},
+	}
+
+	status, err := r.Rotate(ctx, rotation)
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, StateFailed, status.State)
+	assert.ErrorIs(t, status.Err, failed)
+	_, err = factory.GetSecretStore().GetSecretValue(ctx, "jx", "db")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+}
+
+func TestGracePeriodDisablesPreviousVersions(t *testing.T) {
+	ctx := context.Background()
+	store := &versionedStore{SecretStore: fake.NewFakeSecretStore()}
+	r, now := newTestRotator(store)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.SetSecret("jx", "db", &secretstore.SecretValue{Value: "pwd"}))
+	}
+	store.versions = []secretstore.SecretVersion{
+		{Version: "3", CreatedAt: now.Add(-time.Hour), State: secretstore.VersionStateEnabled},
+		{Version: "2", CreatedAt: now.Add(-2 * time.Hour), State: secretstore.VersionStateEnabled},
+		{Version: "1", CreatedAt: now.Add(-5 * 24 * time.Hour), State: secretstore.VersionStateEnabled},
+	}
+	rotation := &Rotation{
+		Ref:       ref,
+		Generator: passwordGenerator(),
+		Policy:    Policy{MaxAge: 24 * time.Hour, GracePeriod: 90 * time.Minute},
+	}
+
+	status, err := r.Reconcile(ctx, rotation)
+	require.NoError(t, err)
+	assert.Equal(t, StateUpToDate, status.State)
+	assert.Equal(t, now.Add(-time.Hour), status.LastRotated)
+	assert.Equal(t, []string{"1"}, status.DisabledVersions)
+	assert.Equal(t, []string{"1"}, store.disabled)
+}
+
+func TestSchedule(t *testing.T) {
+	daily := Daily(2, 30, nil)
+	assert.Equal(t, time.Date(2024, 3, 2, 2, 30, 0, 0, time.UTC), daily.Next(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2024, 3, 1, 2, 30, 0, 0, time.UTC), daily.Next(time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC)))
+
+	// 1st March 2024 was a Friday
+	weekly := Weekly(time.Monday, 2, 30, nil)
+	assert.Equal(t, time.Date(2024, 3, 4, 2, 30, 0, 0, time.UTC), weekly.Next(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestUnknownAgeIsNotRotatedByReconcile(t *testing.T) {
+	ctx := context.Background()
+	store := &annotationDroppingStore{SecretStore: fake.NewFakeSecretStore()}
+	r, _ := newTestRotator(store)
+	rotation := &Rotation{Ref: ref, Generator: passwordGenerator(), Policy: Policy{MaxAge: 24 * time.Hour}}
+
+	status, err := r.Reconcile(ctx, rotation)
+	require.NoError(t, err)
+	assert.Equal(t, StateRotated, status.State)
+
+	status, err = r.Reconcile(ctx, rotation)
+	require.NoError(t, err)
+	assert.Equal(t, StateUnknown, status.State)
+	assert.True(t, status.LastRotated.IsZero())
+	value, err := store.GetSecret("jx", "db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "generated-1", value)
+
+	status, err = r.Rotate(ctx, rotation)
+	require.NoError(t, err)
+	assert.Equal(t, StateRotated, status.State)
+	value, err = store.GetSecret("jx", "db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "generated-2", value)
+}
+
+func TestRotateDivergesWhenWriteConflicts(t *testing.T) {
+	ctx := context.Background()
+	store := &versionedStore{SecretStore: fake.NewFakeSecretStore()}
+	r, _ := newTestRotator(store)
+	require.NoError(t, store.SetSecret("jx", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "old"}}))
+	var rolledBack []*Event
+	rotation := &Rotation{
+		Ref:       ref,
+		Generator: passwordGenerator(),
+		// another rotation writes the secret while the new password is being verified
+		Verify: func(ctx context.Context, _ *Event) error {
+			return store.SetSecretWithContext(ctx, "jx", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "other"}})
+		},
+	}
+
+	status, err := r.Rotate(ctx, rotation)
+	assert.ErrorIs(t, err, ErrDiverged)
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	assert.Equal(t, StateDiverged, status.State)
+	value, err := store.GetSecret("jx", "db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "other", value)
+
+	rotation.Rollback = func(_ context.Context, event *Event) error {
+		rolledBack = append(rolledBack, event)
+		return nil
+	}
+	status, err = r.Rotate(ctx, rotation)
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	assert.NotErrorIs(t, err, ErrDiverged)
+	assert.Equal(t, StateFailed, status.State)
+	require.Len(t, rolledBack, 1)
+	assert.Equal(t, "generated-2", rolledBack[0].Next.PropertyValues["password"])
+
+	failed := errors.New("unable to restore password")
+	rotation.Rollback = func(context.Context, *Event) error { return failed }
+	status, err = r.Rotate(ctx, rotation)
+	assert.ErrorIs(t, err, ErrDiverged)
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, StateDiverged, status.State)
+}
+
+func TestAllowUnconditionalWrite(t *testing.T) {
+	ctx := context.Background()
+	store := &unconditionalStore{SecretStore: fake.NewFakeSecretStore()}
+	r, _ := newTestRotator(store)
+	verified := 0
+	rotation := &Rotation{
+		Ref:       ref,
+		Generator: passwordGenerator(),
+		Verify: func(context.Context, *Event) error {
+			verified++
+			return nil
+		},
+		Rollback: func(context.Context, *Event) error { return nil },
+	}
+
+	// creating the secret fails once the new value was verified, as the store cannot tell whether it exists
+	status, err := r.Rotate(ctx, rotation)
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+	assert.Equal(t, StateFailed, status.State)
+	assert.Equal(t, 1, verified)
+
+	require.NoError(t, store.SetSecret("jx", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "old"}}))
+	status, err = r.Rotate(ctx, rotation)
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+	assert.Equal(t, StateFailed, status.State)
+	assert.Equal(t, 1, verified, "secrets which cannot be written conditionally must fail before they are verified")
+
+	rotation.AllowUnconditionalWrite = true
+	status, err = r.Rotate(ctx, rotation)
+	require.NoError(t, err)
+	assert.Equal(t, StateRotated, status.State)
+	value, err := store.GetSecret("jx", "db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "generated-2", value)
+}
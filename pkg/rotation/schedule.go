@@ -0,0 +1,43 @@
+package rotation
+
+import "time"
+
+// Schedule returns the first rotation time after the secret was last rotated. It has the same method as the schedules
+// of github.com/robfig/cron so cron expressions can be used as well as the schedules in this package
+type Schedule interface {
+	Next(lastRotated time.Time) time.Time
+}
+
+// ScheduleFunc adapts a function to a Schedule
+type ScheduleFunc func(lastRotated time.Time) time.Time
+
+func (f ScheduleFunc) Next(lastRotated time.Time) time.Time {
+	return f(lastRotated)
+}
+
+// Daily rotates once a day at hour:minute in loc, UTC if loc is nil
+func Daily(hour, minute int, loc *time.Location) Schedule {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return ScheduleFunc(func(lastRotated time.Time) time.Time {
+		t := lastRotated.In(loc)
+		next := time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, loc)
+		if !next.After(t) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	})
+}
+
+// Weekly rotates once a week on day at hour:minute in loc, UTC if loc is nil
+func Weekly(day time.Weekday, hour, minute int, loc *time.Location) Schedule {
+	daily := Daily(hour, minute, loc)
+	return ScheduleFunc(func(lastRotated time.Time) time.Time {
+		next := daily.Next(lastRotated)
+		for next.Weekday() != day {
+			next = daily.Next(next)
+		}
+		return next
+	})
+}
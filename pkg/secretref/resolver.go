@@ -0,0 +1,62 @@
+package secretref
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+)
+
+// Resolver reads the values of secret references, creating a secret manager for each store type on first use
+type Resolver struct {
+	factory secretstore.FactoryInterface
+
+	lock     sync.Mutex
+	managers map[secretstore.Type]secretstore.Interface
+}
+
+// NewResolver creates a resolver which uses factory to create secret managers, typically factory.SecretManagerFactory
+func NewResolver(factory secretstore.FactoryInterface) *Resolver {
+	return &Resolver{
+		factory:  factory,
+		managers: map[secretstore.Type]secretstore.Interface{},
+	}
+}
+
+// Resolve parses the reference and returns the value of the secret
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	parsed, err := Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return r.ResolveRef(ctx, parsed)
+}
+
+// ResolveRef returns the value of the referenced secret
+func (r *Resolver) ResolveRef(ctx context.Context, ref *Ref) (string, error) {
+	mgr, err := r.Manager(ref.StoreType)
+	if err != nil {
+		return "", err
+	}
+	value, err := mgr.GetSecretWithContext(ctx, ref.Location, ref.SecretName, ref.SecretKey)
+	if err != nil {
+		return "", fmt.Errorf("error resolving secret reference %s: %w", ref, err)
+	}
+	return value, nil
+}
+
+// Manager returns the secret manager used for the store type
+func (r *Resolver) Manager(storeType secretstore.Type) (secretstore.Interface, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if mgr, ok := r.managers[storeType]; ok {
+		return mgr, nil
+	}
+	mgr, err := r.factory.NewSecretManager(storeType)
+	if err != nil {
+		return nil, fmt.Errorf("error creating secret manager for store type %s: %w", storeType, err)
+	}
+	r.managers[storeType] = mgr
+	return mgr, nil
+}
@@ -0,0 +1,171 @@
+package secretref
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+)
+
+const (
+	// SchemeGoogle references a GCP Secret Manager secret as gsm://project/name#key
+	SchemeGoogle = "gsm"
+	// SchemeVault references a Hashicorp Vault secret over https as vault://host:port/path#key
+	SchemeVault = "vault"
+	// SchemeVaultHTTP references a Hashicorp Vault secret over plain http as vault+http://host:port/path#key
+	SchemeVaultHTTP = "vault+http"
+	// SchemeAwsASM references an AWS Secrets Manager secret as asm://region/name#key
+	SchemeAwsASM = "asm"
+	// SchemeAwsSSM references an AWS Systems Manager parameter as ssm://region/name#key, hierarchical parameters such as
+	// /app/db are written as ssm://region//app/db
+	SchemeAwsSSM = "ssm"
+	// SchemeAzure references an Azure Key Vault secret as azkv://vault/name#key
+	SchemeAzure = "azkv"
+	// SchemeKubernetes references a Kubernetes Secret as k8s://namespace/name#key
+	SchemeKubernetes = "k8s"
+	// SchemeSops references a secret in a sops file, or a directory of sops files, as sops:///path/to/file/name#key
+	// or sops://relative/path/name#key. The last path segment is the secret name and the rest is the location
+	SchemeSops = "sops"
+	// SchemeAge references a secret in a directory of age encrypted files as age:///path/to/dir/name#key
+	SchemeAge = "age"
+)
+
+var schemeStoreTypes = map[string]secretstore.Type{
+	SchemeGoogle:     secretstore.SecretStoreTypeGoogle,
+	SchemeVault:      secretstore.SecretStoreTypeVault,
+	SchemeVaultHTTP:  secretstore.SecretStoreTypeVault,
+	SchemeAwsASM:     secretstore.SecretStoreTypeAwsASM,
+	SchemeAwsSSM:     secretstore.SecretStoreTypeAwsSSM,
+	SchemeAzure:      secretstore.SecretStoreTypeAzure,
+	SchemeKubernetes: secretstore.SecretStoreTypeKubernetes,
+	SchemeSops:       secretstore.SecretStoreTypeSops,
+	SchemeAge:        secretstore.SecretStoreTypeAge,
+}
+
+// pathStoreTypes are the store types whose locations are file system paths rather than a host
+var pathStoreTypes = map[secretstore.Type]bool{
+	secretstore.SecretStoreTypeSops: true,
+	secretstore.SecretStoreTypeAge:  true,
+}
+
+// Ref identifies a single secret, or a key within it, in any secret store
+type Ref struct {
+	StoreType  secretstore.Type
+	Location   string
+	SecretName string
+	// SecretKey is the property of the secret to read, empty for the whole secret
+	SecretKey string
+}
+
+// Parse parses a secret reference such as gsm://my-project/db-creds#password
+func Parse(ref string) (*Ref, error) {
+	r, err := parse(ref, true)
+	if err != nil {
+		return nil, err
+	}
+	if r.SecretName == "" {
+		return nil, fmt.Errorf("invalid secret reference %q: missing secret name", ref)
+	}
+	return r, nil
+}
+
+// ParseLocation parses a reference to a location such as gsm://my-project. The secret name is optional, it is used as
+// a prefix when listing the secrets of hierarchical stores such as vault://vault.example.com:8200/secret/jx/. The whole
+// path of file stores such as sops:///path/to/dir is the location
+func ParseLocation(ref string) (*Ref, error) {
+	return parse(ref, false)
+}
+
+// parse parses ref, named is set if the last path segment of a file store reference is the secret name
+func parse(ref string, named bool) (*Ref, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret reference %q: %w", ref, err)
+	}
+	storeType, ok := schemeStoreTypes[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("invalid secret reference %q: unknown scheme %q", ref, u.Scheme)
+	}
+	if pathStoreTypes[storeType] {
+		return parsePath(ref, storeType, u, named)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid secret reference %q: missing location", ref)
+	}
+
+	location := u.Host
+	switch u.Scheme {
+	case SchemeVault:
+		location = "https://" + u.Host
+	case SchemeVaultHTTP:
+		location = "http://" + u.Host
+	}
+	return &Ref{
+		StoreType:  storeType,
+		Location:   location,
+		SecretName: strings.TrimPrefix(u.Path, "/"),
+		SecretKey:  u.Fragment,
+	}, nil
+}
+
+// parsePath parses the reference of a file store, whose location is the path of the URL with its host
+func parsePath(ref string, storeType secretstore.Type, u *url.URL, named bool) (*Ref, error) {
+	location := u.Host + u.Path
+	secretName := ""
+	switch i := strings.LastIndex(location, "/"); {
+	case !named:
+		location = strings.TrimSuffix(location, "/")
+	case i == 0:
+		location, secretName = "/", location[1:]
+	case i > 0:
+		location, secretName = location[:i], location[i+1:]
+	}
+	if location == "" {
+		return nil, fmt.Errorf("invalid secret reference %q: missing location", ref)
+	}
+	return &Ref{
+		StoreType:  storeType,
+		Location:   location,
+		SecretName: secretName,
+		SecretKey:  u.Fragment,
+	}, nil
+}
+
+// String formats the reference so that it can be parsed again with Parse
+func (r *Ref) String() string {
+	scheme := ""
+	location := r.Location
+	for s, storeType := range schemeStoreTypes {
+		if storeType == r.StoreType && s != SchemeVaultHTTP {
+			scheme = s
+		}
+	}
+	if r.StoreType == secretstore.SecretStoreTypeVault {
+		if strings.HasPrefix(location, "http://") {
+			scheme = SchemeVaultHTTP
+		}
+		location = strings.TrimPrefix(strings.TrimPrefix(location, "https://"), "http://")
+	}
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     location,
+		Path:     "/" + r.SecretName,
+		Fragment: r.SecretKey,
+	}
+	if pathStoreTypes[r.StoreType] {
+		path := location
+		if r.SecretName != "" {
+			path = strings.TrimSuffix(path, "/") + "/" + r.SecretName
+		}
+		// the first segment of a relative path is written as the host
+		u.Host, u.Path = "", path
+		if host, rest, ok := strings.Cut(path, "/"); host != "" {
+			u.Host, u.Path = host, ""
+			if ok {
+				u.Path = "/" + rest
+			}
+		}
+	}
+	return u.String()
+}
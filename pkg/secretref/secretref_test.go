@@ -0,0 +1,111 @@
+//go:build unit
+// +build unit
+
+package secretref_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretref"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		ref      string
+		expected secretref.Ref
+	}{
+		{
+			ref:      "gsm://my-project/db-creds#password",
+			expected: secretref.Ref{StoreType: secretstore.SecretStoreTypeGoogle, Location: "my-project", SecretName: "db-creds", SecretKey: "password"},
+		},
+		{
+			ref:      "vault://vault.example.com:8200/secret/data/jx/db#password",
+			expected: secretref.Ref{StoreType: secretstore.SecretStoreTypeVault, Location: "https://vault.example.com:8200", SecretName: "secret/data/jx/db", SecretKey: "password"},
+		},
+		{
+			ref:      "vault+http://localhost:8200/secret/data/jx/db#password",
+			expected: secretref.Ref{StoreType: secretstore.SecretStoreTypeVault, Location: "http://localhost:8200", SecretName: "secret/data/jx/db", SecretKey: "password"},
+		},
+		{
+			ref:      "asm://eu-west-1/prod/db/creds#username",
+			expected: secretref.Ref{StoreType: secretstore.SecretStoreTypeAwsASM, Location: "eu-west-1", SecretName: "prod/db/creds", SecretKey: "username"},
+		},
+		{
+			ref:      "ssm://eu-west-1//app/db",
+			expected: secretref.Ref{StoreType: secretstore.SecretStoreTypeAwsSSM, Location: "eu-west-1", SecretName: "/app/db"},
+		},
+		{
+			ref:      "azkv://my-vault/db-creds#password",
+			expected: secretref.Ref{StoreType: secretstore.SecretStoreTypeAzure, Location: "my-vault", SecretName: "db-creds", SecretKey: "password"},
+		},
+		{
+			ref:      "k8s://jx/db-creds#password",
+			expected: secretref.Ref{StoreType: secretstore.SecretStoreTypeKubernetes, Location: "jx", SecretName: "db-creds", SecretKey: "password"},
+		},
+		{
+			ref:      "sops:///home/me/secrets/jx.yaml/db#password",
+			expected: secretref.Ref{StoreType: secretstore.SecretStoreTypeSops, Location: "/home/me/secrets/jx.yaml", SecretName: "db", SecretKey: "password"},
+		},
+		{
+			ref:      "sops://secrets/db#password",
+			expected: secretref.Ref{StoreType: secretstore.SecretStoreTypeSops, Location: "secrets", SecretName: "db", SecretKey: "password"},
+		},
+		{
+			ref:      "age:///home/me/.jx/secrets/db#password",
+			expected: secretref.Ref{StoreType: secretstore.SecretStoreTypeAge, Location: "/home/me/.jx/secrets", SecretName: "db", SecretKey: "password"},
+		},
+	}
+	for _, tc := range testCases {
+		ref, err := secretref.Parse(tc.ref)
+		require.NoError(t, err, tc.ref)
+		assert.Equal(t, tc.expected, *ref, tc.ref)
+		assert.Equal(t, tc.ref, ref.String())
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, ref := range []string{"", "gsm://my-project", "gsm:///name", "unknown://loc/name", "k8s://jx/", "sops://db", "sops:///db/"} {
+		_, err := secretref.Parse(ref)
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	ref, err := secretref.ParseLocation("k8s://jx")
+	require.NoError(t, err)
+	assert.Equal(t, secretref.Ref{StoreType: secretstore.SecretStoreTypeKubernetes, Location: "jx"}, *ref)
+
+	ref, err = secretref.ParseLocation("vault://vault.example.com:8200/secret/jx/")
+	require.NoError(t, err)
+	assert.Equal(t, secretref.Ref{StoreType: secretstore.SecretStoreTypeVault, Location: "https://vault.example.com:8200", SecretName: "secret/jx/"}, *ref)
+
+	ref, err = secretref.ParseLocation("sops:///home/me/secrets/")
+	require.NoError(t, err)
+	assert.Equal(t, secretref.Ref{StoreType: secretstore.SecretStoreTypeSops, Location: "/home/me/secrets"}, *ref)
+	assert.Equal(t, "sops:///home/me/secrets", ref.String())
+
+	_, err = secretref.ParseLocation("unknown://jx")
+	assert.Error(t, err)
+}
+
+func TestResolver(t *testing.T) {
+	factory := &fake.SecretManagerFactory{}
+	mgr, err := factory.NewSecretManager(secretstore.SecretStoreTypeGoogle)
+	require.NoError(t, err)
+	require.NoError(t, mgr.SetSecret("my-project", "db-creds", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"password": "pwd"},
+	}))
+
+	resolver := secretref.NewResolver(factory)
+	value, err := resolver.Resolve(context.Background(), "gsm://my-project/db-creds#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "pwd", value)
+
+	_, err = resolver.Resolve(context.Background(), "gsm://my-project/db-creds#username")
+	assert.ErrorIs(t, err, secretstore.ErrKeyNotFound)
+}
@@ -0,0 +1,323 @@
+package agesecrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/gofrs/flock"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// fileExtension is the extension of the encrypted secret files
+const fileExtension = ".age"
+
+// lockFile is the file in the location writers lock while reading and writing secrets
+const lockFile = ".lock"
+
+// lockRetryDelay is how often a writer retries taking the lock held by another writer
+const lockRetryDelay = 10 * time.Millisecond
+
+// secretFile is the plain text of a secret file
+type secretFile struct {
+	Version     int64             `json:"version"`
+	Value       string            `json:"value,omitempty"`
+	Properties  map[string]string `json:"properties,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Type        corev1.SecretType `json:"type,omitempty"`
+}
+
+// NewAgeSecretManager creates a secret manager for secrets kept in a local directory, intended for development
+// without a cloud secret store. The location is the directory and each secret is a JSON file encrypted with age to
+// the recipients, named after the secret with an .age extension. Secrets are decrypted with the identities. Writers
+// lock the directory so concurrent processes do not lose each other's updates
+func NewAgeSecretManager(identities []age.Identity, recipients []age.Recipient) secretstore.Interface {
+	return ageSecretManager{identities: identities, recipients: recipients}
+}
+
+// NewAgeSecretManagerFromKeyFile creates a secret manager using the identities of an age key file, such as the one
+// used by sops, and encrypting secrets to the recipients of those identities
+func NewAgeSecretManagerFromKeyFile(path string) (secretstore.Interface, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading age key file %s: %w", path, err)
+	}
+	defer f.Close()
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing age key file %s: %w", path, err)
+	}
+	var recipients []age.Recipient
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			recipients = append(recipients, x25519.Recipient())
+		}
+	}
+	return NewAgeSecretManager(identities, recipients), nil
+}
+
+type ageSecretManager struct {
+	identities []age.Identity
+	recipients []age.Recipient
+}
+
+func (a ageSecretManager) GetSecret(location, secretName, secretKey string) (string, error) {
+	return a.GetSecretWithContext(context.Background(), location, secretName, secretKey)
+}
+
+func (a ageSecretManager) GetSecretWithContext(ctx context.Context, location, secretName, secretKey string) (string, error) {
+	secretValue, err := a.GetSecretValue(ctx, location, secretName)
+	if err != nil {
+		return "", err
+	}
+	value, ok := secretValue.GetProperty(secretKey)
+	if !ok {
+		return "", secretstore.NewKeyNotFoundError(location, secretName, secretKey)
+	}
+	return value, nil
+}
+
+// GetSecretValue reads the secret without taking the lock as secret files are replaced atomically
+func (a ageSecretManager) GetSecretValue(_ context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	secret, err := a.read(location, secretName)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, secretstore.NewSecretNotFoundError(location, secretName)
+	}
+	return &secretstore.SecretValue{
+		Value:          secret.Value,
+		PropertyValues: secret.Properties,
+		Labels:         secret.Labels,
+		Annotations:    secret.Annotations,
+		SecretType:     secret.Type,
+		Version:        strconv.FormatInt(secret.Version, 10),
+	}, nil
+}
+
+func (a ageSecretManager) SetSecret(location, secretName string, secretValue *secretstore.SecretValue) error {
+	return a.SetSecretWithContext(context.Background(), location, secretName, secretValue)
+}
+
+// SetSecretWithContext merges the properties, labels and annotations with those of the existing secret unless the
+// secret value has a Value or is set to Overwrite
+func (a ageSecretManager) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	if len(a.recipients) == 0 {
+		return fmt.Errorf("unable to set secret %s in %s: no age recipients to encrypt it to", secretName, location)
+	}
+	err := os.MkdirAll(location, 0o700)
+	if err != nil {
+		return fmt.Errorf("error creating secret directory %s: %w", location, err)
+	}
+	unlock, err := lock(ctx, location)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	existing, err := a.read(location, secretName)
+	if err != nil {
+		return err
+	}
+	if secretValue.CreateOnly && existing != nil {
+		return fmt.Errorf("failed to create secret %s in %s: %w", secretName, location, secretstore.NewAlreadyExistsError(location, secretName))
+	}
+	if secretValue.ExpectedVersion != "" && (existing == nil || strconv.FormatInt(existing.Version, 10) != secretValue.ExpectedVersion) {
+		return fmt.Errorf("failed to set secret %s in %s: %w", secretName, location, secretstore.NewConflictError(location, secretName))
+	}
+
+	secret := &secretFile{
+		Version:     1,
+		Value:       secretValue.Value,
+		Properties:  secretValue.PropertyValues,
+		Labels:      secretValue.Labels,
+		Annotations: secretValue.Annotations,
+		Type:        secretValue.SecretType,
+	}
+	if existing != nil {
+		secret.Version = existing.Version + 1
+		if !secretValue.Overwrite {
+			if secretValue.Value == "" {
+				secret.Properties = merge(existing.Properties, secretValue.PropertyValues)
+			}
+			secret.Labels = merge(existing.Labels, secretValue.Labels)
+			secret.Annotations = merge(existing.Annotations, secretValue.Annotations)
+			if secret.Type == "" {
+				secret.Type = existing.Type
+			}
+		}
+	}
+	return a.write(location, secretName, secret)
+}
+
+func (a ageSecretManager) DeleteSecret(ctx context.Context, location, secretName string, _ *secretstore.DeleteOptions) error {
+	unlock, err := lock(ctx, location)
+	if errors.Is(err, os.ErrNotExist) {
+		return secretstore.NewSecretNotFoundError(location, secretName)
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = os.Remove(path(location, secretName))
+	if errors.Is(err, os.ErrNotExist) {
+		return secretstore.NewSecretNotFoundError(location, secretName)
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting secret %s in %s: %w", secretName, location, err)
+	}
+	return nil
+}
+
+// ListSecrets lists the secret files of the location, which does not need them to be decrypted
+func (a ageSecretManager) ListSecrets(ctx context.Context, location string, options *secretstore.ListOptions) *secretstore.SecretIterator {
+	return secretstore.NewSecretIterator(ctx, options.GetPrefix(), func(context.Context, string) ([]secretstore.SecretInfo, string, error) {
+		entries, err := os.ReadDir(location)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("error listing secrets in %s: %w", location, err)
+		}
+		var secrets []secretstore.SecretInfo
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), fileExtension) {
+				continue
+			}
+			name, err := url.PathUnescape(strings.TrimSuffix(entry.Name(), fileExtension))
+			if err != nil {
+				continue
+			}
+			secrets = append(secrets, secretstore.SecretInfo{Name: name})
+		}
+		sort.Slice(secrets, func(i, j int) bool {
+			return secrets[i].Name < secrets[j].Name
+		})
+		return secrets, "", nil
+	})
+}
+
+// read decrypts the secret file, returning nil if the secret does not exist
+func (a ageSecretManager) read(location, secretName string) (*secretFile, error) {
+	data, err := os.ReadFile(path(location, secretName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading secret %s in %s: %w", secretName, location, err)
+	}
+	decrypted, err := age.Decrypt(bytes.NewReader(data), a.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting secret %s in %s: %w", secretName, location, classifyError(location, secretName, err))
+	}
+	plain, err := io.ReadAll(decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting secret %s in %s: %w", secretName, location, classifyError(location, secretName, err))
+	}
+	secret := &secretFile{}
+	err = json.Unmarshal(plain, secret)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing secret %s in %s: %w", secretName, location, err)
+	}
+	return secret, nil
+}
+
+// write encrypts the secret to a temporary file which then replaces the secret file, so readers never see a partially
+// written secret
+func (a ageSecretManager) write(location, secretName string, secret *secretFile) error {
+	plain, err := json.Marshal(secret)
+	if err != nil {
+		return fmt.Errorf("error encoding secret %s: %w", secretName, err)
+	}
+	buf := &bytes.Buffer{}
+	encrypted, err := age.Encrypt(buf, a.recipients...)
+	if err != nil {
+		return fmt.Errorf("error encrypting secret %s: %w", secretName, err)
+	}
+	_, err = encrypted.Write(plain)
+	if closeErr := encrypted.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error encrypting secret %s: %w", secretName, err)
+	}
+
+	target := path(location, secretName)
+	tmp, err := os.CreateTemp(location, "."+filepath.Base(target)+"-*")
+	if err != nil {
+		return fmt.Errorf("error writing secret %s in %s: %w", secretName, location, err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing secret %s in %s: %w", secretName, location, err)
+	}
+	return nil
+}
+
+// lock takes the exclusive lock of the location, waiting for other writers until the context is done
+func lock(ctx context.Context, location string) (func(), error) {
+	if _, err := os.Stat(location); err != nil {
+		return nil, fmt.Errorf("error locking secret directory %s: %w", location, err)
+	}
+	fileLock := flock.New(filepath.Join(location, lockFile))
+	locked, err := fileLock.TryLockContext(ctx, lockRetryDelay)
+	if err != nil {
+		return nil, fmt.Errorf("error locking secret directory %s: %w", location, err)
+	}
+	if !locked {
+		return nil, fmt.Errorf("error locking secret directory %s: %w", location, ctx.Err())
+	}
+	return func() {
+		_ = fileLock.Unlock()
+	}, nil
+}
+
+// path returns the file of the secret, the name is escaped so that names containing slashes stay in the location
+func path(location, secretName string) string {
+	return filepath.Join(location, url.PathEscape(secretName)+fileExtension)
+}
+
+func classifyError(location, secretName string, err error) error {
+	var kind error
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		kind = secretstore.ErrPermissionDenied
+	}
+	return secretstore.NewError(kind, location, secretName, err)
+}
+
+func merge(existing, values map[string]string) map[string]string {
+	if len(existing) == 0 {
+		return values
+	}
+	merged := make(map[string]string, len(existing)+len(values))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,172 @@
+//go:build unit
+// +build unit
+
+package agesecrets_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/agesecrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newManager(t *testing.T) secretstore.Interface {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	return agesecrets.NewAgeSecretManager([]age.Identity{identity}, []age.Recipient{identity.Recipient()})
+}
+
+func TestSetAndGet(t *testing.T) {
+	ctx := context.Background()
+	mgr := newManager(t)
+	location := filepath.Join(t.TempDir(), "secrets")
+
+	_, err := mgr.GetSecretValue(ctx, location, "db")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+
+	require.NoError(t, mgr.SetSecret(location, "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin"},
+		Labels:         map[string]string{"team": "data"},
+		SecretType:     "kubernetes.io/basic-auth",
+	}))
+	require.NoError(t, mgr.SetSecret(location, "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"password": "hunter2"},
+		Annotations:    map[string]string{"owner": "dba"},
+	}))
+	data, err := os.ReadFile(filepath.Join(location, "db.age"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+
+	value, err := mgr.GetSecretValue(ctx, location, "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "hunter2"}, value.PropertyValues)
+	assert.Equal(t, map[string]string{"team": "data"}, value.Labels)
+	assert.Equal(t, map[string]string{"owner": "dba"}, value.Annotations)
+	assert.Equal(t, "kubernetes.io/basic-auth", string(value.SecretType))
+	assert.Equal(t, "2", value.Version)
+
+	password, err := mgr.GetSecret(location, "db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", password)
+	_, err = mgr.GetSecret(location, "db", "missing")
+	assert.ErrorIs(t, err, secretstore.ErrKeyNotFound)
+
+	require.NoError(t, mgr.SetSecret(location, "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "changed"}, Overwrite: true}))
+	value, err = mgr.GetSecretValue(ctx, location, "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "changed"}, value.PropertyValues)
+	assert.Empty(t, value.Labels)
+
+	require.NoError(t, mgr.SetSecret(location, "token", &secretstore.SecretValue{Value: "abc"}))
+	token, err := mgr.GetSecret(location, "token", "")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", token)
+}
+
+func TestExpectedVersion(t *testing.T) {
+	mgr := newManager(t)
+	location := t.TempDir()
+
+	err := mgr.SetSecret(location, "db", &secretstore.SecretValue{Value: "a", ExpectedVersion: "1"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	require.NoError(t, mgr.SetSecret(location, "db", &secretstore.SecretValue{Value: "a"}))
+	require.NoError(t, mgr.SetSecret(location, "db", &secretstore.SecretValue{Value: "b", ExpectedVersion: "1"}))
+	err = mgr.SetSecret(location, "db", &secretstore.SecretValue{Value: "c", ExpectedVersion: "1"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+
+	value, err := mgr.GetSecret(location, "db", "")
+	require.NoError(t, err)
+	assert.Equal(t, "b", value)
+}
+
+func TestCreateOnly(t *testing.T) {
+	mgr := newManager(t)
+	location := t.TempDir()
+
+	require.NoError(t, mgr.SetSecret(location, "db", &secretstore.SecretValue{Value: "a", CreateOnly: true}))
+	err := mgr.SetSecret(location, "db", &secretstore.SecretValue{Value: "b", CreateOnly: true})
+	assert.ErrorIs(t, err, secretstore.ErrAlreadyExists)
+
+	value, err := mgr.GetSecret(location, "db", "")
+	require.NoError(t, err)
+	assert.Equal(t, "a", value)
+}
+
+func TestListAndDelete(t *testing.T) {
+	ctx := context.Background()
+	mgr := newManager(t)
+	location := t.TempDir()
+
+	names, err := mgr.ListSecrets(ctx, filepath.Join(location, "missing"), nil).Names()
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	for _, name := range []string{"db", "jx/webhook", "jx/github"} {
+		require.NoError(t, mgr.SetSecret(location, name, &secretstore.SecretValue{Value: name}))
+	}
+	names, err = mgr.ListSecrets(ctx, location, &secretstore.ListOptions{Prefix: "jx/"}).Names()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"jx/github", "jx/webhook"}, names)
+
+	require.NoError(t, mgr.DeleteSecret(ctx, location, "jx/webhook", nil))
+	assert.ErrorIs(t, mgr.DeleteSecret(ctx, location, "jx/webhook", nil), secretstore.ErrSecretNotFound)
+	assert.ErrorIs(t, mgr.DeleteSecret(ctx, filepath.Join(location, "missing"), "db", nil), secretstore.ErrSecretNotFound)
+	names, err = mgr.ListSecrets(ctx, location, nil).Names()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db", "jx/github"}, names)
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	location := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// each writer has its own manager, as separate processes would
+			mgr := agesecrets.NewAgeSecretManager([]age.Identity{identity}, []age.Recipient{identity.Recipient()})
+			assert.NoError(t, mgr.SetSecret(location, "db", &secretstore.SecretValue{PropertyValues: map[string]string{fmt.Sprintf("key%d", i): "value"}}))
+		}(i)
+	}
+	wg.Wait()
+
+	mgr := agesecrets.NewAgeSecretManager([]age.Identity{identity}, nil)
+	value, err := mgr.GetSecretValue(context.Background(), location, "db")
+	require.NoError(t, err)
+	assert.Len(t, value.PropertyValues, 10)
+	assert.Equal(t, "10", value.Version)
+}
+
+func TestKeyFile(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "keys.txt")
+	require.NoError(t, os.WriteFile(keyFile, []byte("# created: today\n"+identity.String()+"\n"), 0o600))
+	location := filepath.Join(dir, "secrets")
+
+	mgr, err := agesecrets.NewAgeSecretManagerFromKeyFile(keyFile)
+	require.NoError(t, err)
+	require.NoError(t, mgr.SetSecret(location, "db", &secretstore.SecretValue{Value: "hunter2"}))
+	value, err := mgr.GetSecret(location, "db", "")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", value)
+
+	other := newManager(t)
+	_, err = other.GetSecretValue(context.Background(), location, "db")
+	assert.ErrorIs(t, err, secretstore.ErrPermissionDenied)
+
+	_, err = agesecrets.NewAgeSecretManagerFromKeyFile(filepath.Join(dir, "missing.txt"))
+	assert.Error(t, err)
+}
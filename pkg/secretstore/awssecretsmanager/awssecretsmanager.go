@@ -1,14 +1,30 @@
 package awssecretsmanager
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// CurrentStage is the staging label AWS Secrets Manager attaches to the current version of a secret
+	CurrentStage = "AWSCURRENT"
+	// PreviousStage is the staging label AWS Secrets Manager attaches to the previous version of a secret
+	PreviousStage = "AWSPREVIOUS"
+	// PendingStage is the staging label AWS Secrets Manager uses for a version being rotated in. Versions written with
+	// an expected version carry it until they are made the current version
+	PendingStage = "AWSPENDING"
 )
 
 func NewAwsSecretManager(session *session.Session) secretstore.Interface {
@@ -20,7 +36,11 @@ type awsSecretsManager struct {
 }
 
 func (a awsSecretsManager) GetSecret(location, secretName, propertyName string) (string, error) {
-	secret, err := getExistingSecret(a.session, location, secretName)
+	return a.GetSecretWithContext(context.Background(), location, secretName, propertyName)
+}
+
+func (a awsSecretsManager) GetSecretWithContext(ctx context.Context, location, secretName, propertyName string) (string, error) {
+	secret, err := getExistingSecret(ctx, a.session, location, secretName)
 	if err != nil {
 		return "", fmt.Errorf("error retrieving existing secret for aws secret manager: : %w", err)
 	}
@@ -36,82 +56,412 @@ func (a awsSecretsManager) GetSecret(location, secretName, propertyName string)
 	return *secret.SecretString, nil
 }
 
+func (a awsSecretsManager) GetSecretValue(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	secret, err := getExistingSecret(ctx, a.session, location, secretName)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving existing secret for aws secret manager: : %w", err)
+	}
+	secretValue := secretstore.NewSecretValueFromString(aws.StringValue(secret.SecretString))
+	secretValue.Version = aws.StringValue(secret.VersionId)
+
+	svc := secretsmanager.New(a.session, aws.NewConfig().WithRegion(location))
+	description, err := svc.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{SecretId: secret.ARN})
+	if err != nil {
+		return nil, fmt.Errorf("error describing secret %s in aws secret manager: %w", secretName, classifyError(location, secretName, err))
+	}
+	if len(description.Tags) > 0 {
+		secretValue.Labels = map[string]string{}
+		for _, tag := range description.Tags {
+			secretValue.Labels[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+	}
+	return secretValue, nil
+}
+
+func (a awsSecretsManager) ListSecretVersions(ctx context.Context, location, secretName string) ([]secretstore.SecretVersion, error) {
+	svc := secretsmanager.New(a.session, aws.NewConfig().WithRegion(location))
+	input := &secretsmanager.ListSecretVersionIdsInput{
+		SecretId:          aws.String(secretName),
+		IncludeDeprecated: aws.Bool(true),
+	}
+	var versions []secretstore.SecretVersion
+	err := svc.ListSecretVersionIdsPagesWithContext(ctx, input, func(output *secretsmanager.ListSecretVersionIdsOutput, _ bool) bool {
+		for _, entry := range output.Versions {
+			state := secretstore.VersionStateEnabled
+			// versions without staging labels are deprecated and will be removed by AWS
+			if len(entry.VersionStages) == 0 {
+				state = secretstore.VersionStateDisabled
+			}
+			versions = append(versions, secretstore.SecretVersion{
+				Version:   aws.StringValue(entry.VersionId),
+				CreatedAt: aws.TimeValue(entry.CreatedDate),
+				State:     state,
+				Stages:    aws.StringValueSlice(entry.VersionStages),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing versions of secret %s in aws secret manager: %w", secretName, classifyError(location, secretName, err))
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].CreatedAt.After(versions[j].CreatedAt)
+	})
+	return versions, nil
+}
+
+// GetSecretVersion reads a version by its version id or by a staging label such as AWSPREVIOUS
+func (a awsSecretsManager) GetSecretVersion(ctx context.Context, location, secretName, version string) (*secretstore.SecretValue, error) {
+	input := &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	}
+	if isVersionStage(version) {
+		input.VersionStage = aws.String(version)
+	} else {
+		input.VersionId = aws.String(version)
+	}
+	svc := secretsmanager.New(a.session, aws.NewConfig().WithRegion(location))
+	secret, err := svc.GetSecretValueWithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving version %s of secret %s from aws secret manager: %w", version, secretName,
+			classifyError(location, secretName, err))
+	}
+	secretValue := secretstore.NewSecretValueFromString(aws.StringValue(secret.SecretString))
+	secretValue.Version = aws.StringValue(secret.VersionId)
+	return secretValue, nil
+}
+
+// Watch polls the secret metadata for the version with the AWSCURRENT stage, which does not read the secret value. A
+// secret scheduled for deletion is reported as deleted
+func (a awsSecretsManager) Watch(ctx context.Context, location, secretName string, options *secretstore.WatchOptions) (<-chan secretstore.WatchEvent, error) {
+	svc := secretsmanager.New(a.session, aws.NewConfig().WithRegion(location))
+	return secretstore.PollWatch(ctx, location, secretName, options.GetPollInterval(), func(ctx context.Context) (string, error) {
+		output, err := svc.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(secretName)})
+		if err != nil {
+			return "", classifyError(location, secretName, err)
+		}
+		if output.DeletedDate != nil {
+			return "", secretstore.NewSecretNotFoundError(location, secretName)
+		}
+		for version, stages := range output.VersionIdsToStages {
+			for _, stage := range stages {
+				if aws.StringValue(stage) == CurrentStage {
+					return version, nil
+				}
+			}
+		}
+		return "", secretstore.NewSecretNotFoundError(location, secretName)
+	}), nil
+}
+
+// DisableSecretVersion removes all staging labels from the version which deprecates it. The current version cannot be
+// disabled
+func (a awsSecretsManager) DisableSecretVersion(ctx context.Context, location, secretName, version string) error {
+	versions, err := a.ListSecretVersions(ctx, location, secretName)
+	if err != nil {
+		return err
+	}
+	svc := secretsmanager.New(a.session, aws.NewConfig().WithRegion(location))
+	for i := range versions {
+		if versions[i].Version != version {
+			continue
+		}
+		for _, stage := range versions[i].Stages {
+			if stage == CurrentStage {
+				return fmt.Errorf("unable to disable version %s of secret %s as it is the %s version", version, secretName, CurrentStage)
+			}
+			_, err = svc.UpdateSecretVersionStageWithContext(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+				SecretId:            aws.String(secretName),
+				VersionStage:        aws.String(stage),
+				RemoveFromVersionId: aws.String(version),
+			})
+			if err != nil {
+				return fmt.Errorf("error removing stage %s from version %s of secret %s in aws secret manager: %w", stage, version, secretName,
+					classifyError(location, secretName, err))
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("version %s of secret %s: %w", version, secretName, secretstore.NewSecretNotFoundError(location, secretName))
+}
+
+// DestroySecretVersion is not supported as AWS removes deprecated versions itself
+func (a awsSecretsManager) DestroySecretVersion(_ context.Context, _, secretName, version string) error {
+	return fmt.Errorf("unable to destroy version %s of secret %s, disable it instead: %w", version, secretName, secretstore.ErrNotSupported)
+}
+
+// isVersionStage returns true for staging labels such as AWSCURRENT as opposed to version ids, which are UUIDs
+func isVersionStage(version string) bool {
+	return !strings.Contains(version, "-") && strings.ToUpper(version) == version
+}
+
 func getSecretProperty(s *secretsmanager.GetSecretValueOutput, propertyName string) (string, error) {
 	m, err := getSecretPropertyMap(s.SecretString)
 	if err != nil {
 		return "", fmt.Errorf("error reading property %s from secret JSON object: %w", propertyName, err)
 	}
-	return m[propertyName], nil
+	value, ok := m[propertyName]
+	if !ok {
+		return "", fmt.Errorf("property %s does not occur in secret JSON object: %w", propertyName, secretstore.ErrKeyNotFound)
+	}
+	return value, nil
 }
 
-func (a awsSecretsManager) SetSecret(location, secretName string, secretValue *secretstore.SecretValue) (err error) {
+func (a awsSecretsManager) SetSecret(location, secretName string, secretValue *secretstore.SecretValue) error {
+	return a.SetSecretWithContext(context.Background(), location, secretName, secretValue)
+}
+
+// SetSecretWithContext creates or updates the secret. Labels are stored as tags of the secret, AWS Secrets Manager has
+// nowhere to store annotations so they are not written
+func (a awsSecretsManager) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) (err error) {
+	if secretValue.ExpectedVersion != "" {
+		return a.setSecretWithExpectedVersion(ctx, location, secretName, secretValue)
+	}
+
 	// CreateSecret
-	err = createSecret(a.session, location, secretName, *secretValue)
-	if err != nil {
-		// Don't return if secret already exists.
-		if err.(awserr.Error).Code() != secretsmanager.ErrCodeResourceExistsException {
-			return fmt.Errorf("error creating new secret for aws secret manager: : %w", err)
-		}
+	err = createSecret(ctx, a.session, location, secretName, *secretValue)
+	if err == nil {
+		return nil
+	}
+	// Don't return if secret already exists, unless it must not be updated
+	if !errors.Is(err, secretstore.ErrAlreadyExists) || secretValue.CreateOnly {
+		return fmt.Errorf("error creating new secret for aws secret manager: : %w", err)
 	}
 
 	// GetSecretValue + PutSecretValue/UpdateSecret
 	// Get, Merge and Update
-	secret, err := getExistingSecret(a.session, location, secretName)
+	secret, err := getExistingSecret(ctx, a.session, location, secretName)
 	if err != nil {
 		return fmt.Errorf("error retreiving existing secret for aws secret manager: : %w", err)
 	}
 	var existingSecretProps map[string]string
 	// FIXME: If secretValue is Simple, AND then secret.SecretString is Simple.
 	// getSecretPropertyMap fails
-	if secretValue.Value == "" && secretValue.PropertyValues != nil {
+	if secretValue.Value == "" && secretValue.PropertyValues != nil && !secretValue.Overwrite {
 		existingSecretProps, err = getSecretPropertyMap(secret.SecretString)
 		if err != nil {
 			return fmt.Errorf("error parsing existing secret: : %w", err)
 		}
 	}
 
-	err = updateSecret(a.session, secret, secretValue.MergeExistingSecret(existingSecretProps), location)
+	err = updateSecret(ctx, a.session, secret, secretValue.MergeExistingSecret(existingSecretProps), location)
 	if err != nil {
 		return fmt.Errorf("error updating existing secret for aws secret manager: : %w", err)
 	}
+	return tagSecret(ctx, a.session, location, secret, secretValue)
+}
 
+// tagSecret adds the labels of the secret value to the tags of the secret. If the secret value is set to overwrite
+// the tags which are not labels are removed
+func tagSecret(ctx context.Context, session *session.Session, location string, secret *secretsmanager.GetSecretValueOutput, secretValue *secretstore.SecretValue) error {
+	secretName := aws.StringValue(secret.Name)
+	svc := secretsmanager.New(session, aws.NewConfig().WithRegion(location))
+	if secretValue.Overwrite {
+		description, err := svc.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{SecretId: secret.ARN})
+		if err != nil {
+			return fmt.Errorf("error describing secret %s in aws secret manager: %w", secretName, classifyError(location, secretName, err))
+		}
+		var remove []string
+		for _, tag := range description.Tags {
+			if _, ok := secretValue.Labels[aws.StringValue(tag.Key)]; !ok {
+				remove = append(remove, aws.StringValue(tag.Key))
+			}
+		}
+		if len(remove) > 0 {
+			_, err = svc.UntagResourceWithContext(ctx, &secretsmanager.UntagResourceInput{
+				SecretId: secret.ARN,
+				TagKeys:  aws.StringSlice(remove),
+			})
+			if err != nil {
+				return fmt.Errorf("error untagging secret %s in aws secret manager: %w", secretName, classifyError(location, secretName, err))
+			}
+		}
+	}
+	if len(secretValue.Labels) == 0 {
+		return nil
+	}
+	_, err := svc.TagResourceWithContext(ctx, &secretsmanager.TagResourceInput{
+		SecretId: secret.ARN,
+		Tags:     tags(secretValue.Labels),
+	})
+	if err != nil {
+		return fmt.Errorf("error tagging secret %s in aws secret manager: %w", secretName, classifyError(location, secretName, err))
+	}
 	return nil
 }
 
-func updateSecret(session *session.Session, secret *secretsmanager.GetSecretValueOutput, newValue, location string) (err error) {
+func tags(labels map[string]string) []*secretsmanager.Tag {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := make([]*secretsmanager.Tag, 0, len(keys))
+	for _, k := range keys {
+		tags = append(tags, &secretsmanager.Tag{Key: aws.String(k), Value: aws.String(labels[k])})
+	}
+	return tags
+}
+
+// setSecretWithExpectedVersion adds the new version without making it current and then moves the AWSCURRENT stage to
+// it from the expected version. Moving the stage fails if the expected version is no longer current, in which case the
+// new version is left without stages so AWS deprecates it
+func (a awsSecretsManager) setSecretWithExpectedVersion(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	secret, err := getExistingSecret(ctx, a.session, location, secretName)
+	if errors.Is(err, secretstore.ErrSecretNotFound) {
+		return fmt.Errorf("error updating secret %s in aws secret manager: %w", secretName, secretstore.NewConflictError(location, secretName))
+	}
+	if err != nil {
+		return fmt.Errorf("error retreiving existing secret for aws secret manager: : %w", err)
+	}
+	if aws.StringValue(secret.VersionId) != secretValue.ExpectedVersion {
+		return fmt.Errorf("error updating secret %s in aws secret manager: %w", secretName, secretstore.NewConflictError(location, secretName))
+	}
+	var existingSecretProps map[string]string
+	if secretValue.Value == "" && secretValue.PropertyValues != nil && !secretValue.Overwrite {
+		existingSecretProps, err = getSecretPropertyMap(secret.SecretString)
+		if err != nil {
+			return fmt.Errorf("error parsing existing secret: : %w", err)
+		}
+	}
+
+	svc := secretsmanager.New(a.session, aws.NewConfig().WithRegion(location))
+	output, err := svc.PutSecretValueWithContext(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:      secret.ARN,
+		SecretString:  aws.String(secretValue.MergeExistingSecret(existingSecretProps)),
+		VersionStages: aws.StringSlice([]string{PendingStage}),
+	})
+	if err != nil {
+		return fmt.Errorf("error adding version to secret %s in aws secret manager: %w", secretName, classifyError(location, secretName, err))
+	}
+	defer func() {
+		_, err := svc.UpdateSecretVersionStageWithContext(context.WithoutCancel(ctx), &secretsmanager.UpdateSecretVersionStageInput{
+			SecretId:            secret.ARN,
+			VersionStage:        aws.String(PendingStage),
+			RemoveFromVersionId: output.VersionId,
+		})
+		if err != nil {
+			logrus.WithError(err).Warnf("error removing stage %s from version %s of secret %s in aws secret manager", PendingStage,
+				aws.StringValue(output.VersionId), secretName)
+		}
+	}()
+
+	_, err = svc.UpdateSecretVersionStageWithContext(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:            secret.ARN,
+		VersionStage:        aws.String(CurrentStage),
+		MoveToVersionId:     output.VersionId,
+		RemoveFromVersionId: secret.VersionId,
+	})
+	if err != nil {
+		var aerr awserr.Error
+		// AWS rejects the move when the stage is not attached to the version it is removed from
+		if errors.As(err, &aerr) && aerr.Code() == secretsmanager.ErrCodeInvalidParameterException {
+			return fmt.Errorf("error updating secret %s in aws secret manager: %w", secretName,
+				secretstore.NewError(secretstore.ErrConflict, location, secretName, err))
+		}
+		return fmt.Errorf("error moving stage %s of secret %s in aws secret manager: %w", CurrentStage, secretName, classifyError(location, secretName, err))
+	}
+	return tagSecret(ctx, a.session, location, secret, secretValue)
+}
+
+func (a awsSecretsManager) DeleteSecret(ctx context.Context, location, secretName string, options *secretstore.DeleteOptions) error {
+	input := &secretsmanager.DeleteSecretInput{
+		SecretId: aws.String(secretName),
+	}
+	if options != nil {
+		if options.ForceDeleteWithoutRecovery {
+			input.ForceDeleteWithoutRecovery = aws.Bool(true)
+		} else if options.RecoveryWindowInDays > 0 {
+			input.RecoveryWindowInDays = aws.Int64(options.RecoveryWindowInDays)
+		}
+	}
+	svc := secretsmanager.New(a.session, aws.NewConfig().WithRegion(location))
+	_, err := svc.DeleteSecretWithContext(ctx, input)
+	if err != nil {
+		return fmt.Errorf("error deleting secret %s from aws secret manager: %w", secretName, classifyError(location, secretName, err))
+	}
+	return nil
+}
+
+func (a awsSecretsManager) ListSecrets(ctx context.Context, location string, options *secretstore.ListOptions) *secretstore.SecretIterator {
+	svc := secretsmanager.New(a.session, aws.NewConfig().WithRegion(location))
+	prefix := options.GetPrefix()
+	return secretstore.NewSecretIterator(ctx, prefix, func(ctx context.Context, pageToken string) ([]secretstore.SecretInfo, string, error) {
+		input := &secretsmanager.ListSecretsInput{}
+		if prefix != "" {
+			input.Filters = []*secretsmanager.Filter{
+				{
+					Key:    aws.String(secretsmanager.FilterNameStringTypeName),
+					Values: []*string{aws.String(prefix)},
+				},
+			}
+		}
+		if pageSize := options.GetPageSize(); pageSize > 0 {
+			input.MaxResults = aws.Int64(int64(pageSize))
+		}
+		if pageToken != "" {
+			input.NextToken = aws.String(pageToken)
+		}
+		output, err := svc.ListSecretsWithContext(ctx, input)
+		if err != nil {
+			return nil, "", fmt.Errorf("error listing secrets in aws secret manager region %s: %w", location, classifyError(location, "", err))
+		}
+		secrets := make([]secretstore.SecretInfo, 0, len(output.SecretList))
+		for _, entry := range output.SecretList {
+			info := secretstore.SecretInfo{
+				Name:      aws.StringValue(entry.Name),
+				CreatedAt: aws.TimeValue(entry.CreatedDate),
+				UpdatedAt: aws.TimeValue(entry.LastChangedDate),
+			}
+			if len(entry.Tags) > 0 {
+				info.Labels = map[string]string{}
+				for _, tag := range entry.Tags {
+					info.Labels[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+				}
+			}
+			secrets = append(secrets, info)
+		}
+		return secrets, aws.StringValue(output.NextToken), nil
+	})
+}
+
+func updateSecret(ctx context.Context, session *session.Session, secret *secretsmanager.GetSecretValueOutput, newValue, location string) (err error) {
 	input := &secretsmanager.PutSecretValueInput{
 		SecretId:     secret.ARN,
 		SecretString: aws.String(newValue),
 	}
 	svc := secretsmanager.New(session, aws.NewConfig().WithRegion(location))
-	_, err = svc.PutSecretValue(input)
+	_, err = svc.PutSecretValueWithContext(ctx, input)
 	if err != nil {
-		return fmt.Errorf("error updating existing secret: : %w", err)
+		return fmt.Errorf("error updating existing secret: : %w", classifyError(location, aws.StringValue(secret.Name), err))
 	}
 	return nil
 }
 
-func getExistingSecret(session *session.Session, location, secretName string) (secret *secretsmanager.GetSecretValueOutput, err error) {
+func getExistingSecret(ctx context.Context, session *session.Session, location, secretName string) (secret *secretsmanager.GetSecretValueOutput, err error) {
 	input := &secretsmanager.GetSecretValueInput{
 		SecretId: &secretName,
 	}
 	svc := secretsmanager.New(session, aws.NewConfig().WithRegion(location))
-	secret, err = svc.GetSecretValue(input)
+	secret, err = svc.GetSecretValueWithContext(ctx, input)
 	if err != nil {
-		return
+		return nil, classifyError(location, secretName, err)
 	}
 	return
 }
 
-func createSecret(session *session.Session, location, secretName string, secretValue secretstore.SecretValue) (err error) {
+func createSecret(ctx context.Context, session *session.Session, location, secretName string, secretValue secretstore.SecretValue) (err error) {
 	input := &secretsmanager.CreateSecretInput{
 		Name:         &secretName,
 		SecretString: aws.String(secretValue.ToString()),
 	}
+	if len(secretValue.Labels) > 0 {
+		input.Tags = tags(secretValue.Labels)
+	}
 	svc := secretsmanager.New(session, aws.NewConfig().WithRegion(location))
-	_, err = svc.CreateSecret(input)
+	_, err = svc.CreateSecretWithContext(ctx, input)
 	if err != nil {
-		return err
+		return classifyError(location, secretName, err)
 	}
 	return nil
 }
@@ -124,3 +474,25 @@ func getSecretPropertyMap(value *string) (map[string]string, error) {
 	}
 	return m, nil
 }
+
+// classifyError maps AWS error codes on to the secretstore error kinds
+func classifyError(location, secretName string, err error) error {
+	var kind error
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch aerr.Code() {
+		case secretsmanager.ErrCodeResourceNotFoundException:
+			kind = secretstore.ErrSecretNotFound
+		case secretsmanager.ErrCodeResourceExistsException:
+			kind = secretstore.ErrAlreadyExists
+		case "AccessDeniedException", "UnrecognizedClientException", "ExpiredTokenException":
+			kind = secretstore.ErrPermissionDenied
+		case secretsmanager.ErrCodeInternalServiceError:
+			kind = secretstore.ErrTransient
+		}
+	}
+	if kind == nil && (request.IsErrorThrottle(err) || request.IsErrorRetryable(err)) {
+		kind = secretstore.ErrTransient
+	}
+	return secretstore.NewError(kind, location, secretName, err)
+}
@@ -0,0 +1,105 @@
+//go:build unit
+// +build unit
+
+package awssecretsmanager_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelsAreTags(t *testing.T) {
+	ctx := context.Background()
+	mgr, fake := newFakeSecretsManager(t)
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"password": "hunter2"},
+		Labels:         map[string]string{"team": "data"},
+	}))
+	assert.Equal(t, []string{"CreateSecret"}, fake.calls)
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin"},
+		Labels:         map[string]string{"env": "prod"},
+	}))
+	assert.Equal(t, map[string]string{"team": "data", "env": "prod"}, fake.Tags("db"))
+
+	value, err := mgr.GetSecretValue(ctx, "us-east-1", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "hunter2", "username": "admin"}, value.PropertyValues)
+	assert.Equal(t, map[string]string{"team": "data", "env": "prod"}, value.Labels)
+	assert.Equal(t, versionID(2), value.Version)
+}
+
+func TestOverwrite(t *testing.T) {
+	ctx := context.Background()
+	mgr, fake := newFakeSecretsManager(t)
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin", "legacy": "old"},
+		Labels:         map[string]string{"team": "data", "stale": "true"},
+	}))
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin"},
+		Labels:         map[string]string{"team": "data"},
+		Overwrite:      true,
+	}))
+
+	value, err := mgr.GetSecretValue(ctx, "us-east-1", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin"}, value.PropertyValues)
+	assert.Equal(t, map[string]string{"team": "data"}, fake.Tags("db"))
+}
+
+func TestSetSecretWithExpectedVersion(t *testing.T) {
+	ctx := context.Background()
+	mgr, fake := newFakeSecretsManager(t)
+
+	err := mgr.SetSecretWithContext(ctx, "us-east-1", "db", &secretstore.SecretValue{Value: "a", ExpectedVersion: versionID(1)})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "db", &secretstore.SecretValue{Value: "a"}))
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "db", &secretstore.SecretValue{Value: "b", ExpectedVersion: versionID(1)}))
+	assert.Equal(t, [][]string{{"AWSPREVIOUS"}, {"AWSCURRENT"}}, fake.Stages("db"))
+
+	value, err := mgr.GetSecretValue(ctx, "us-east-1", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "b", value.Value)
+	assert.Equal(t, versionID(2), value.Version)
+
+	err = mgr.SetSecretWithContext(ctx, "us-east-1", "db", &secretstore.SecretValue{Value: "c", ExpectedVersion: versionID(1)})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	assert.Len(t, fake.Stages("db"), 2, "no version is added when the expected version is not current")
+}
+
+func TestSetSecretWithExpectedVersionRace(t *testing.T) {
+	ctx := context.Background()
+	mgr, fake := newFakeSecretsManager(t)
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "db", &secretstore.SecretValue{Value: "a"}))
+
+	// another writer makes a new version current between this writer adding its pending version and moving the stage
+	fake.beforeStageMove = func() {
+		fake.beforeStageMove = nil
+		fake.Set("db", "other")
+	}
+	err := mgr.SetSecretWithContext(ctx, "us-east-1", "db", &secretstore.SecretValue{Value: "b", ExpectedVersion: versionID(1)})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	assert.Equal(t, [][]string{{"AWSPREVIOUS"}, {}, {"AWSCURRENT"}}, fake.Stages("db"), "the pending version is left without stages")
+
+	value, err := mgr.GetSecretValue(ctx, "us-east-1", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "other", value.Value)
+}
+
+func TestSetSecretCreateOnly(t *testing.T) {
+	ctx := context.Background()
+	mgr, fake := newFakeSecretsManager(t)
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "db", &secretstore.SecretValue{Value: "a", CreateOnly: true}))
+	err := mgr.SetSecretWithContext(ctx, "us-east-1", "db", &secretstore.SecretValue{Value: "b", CreateOnly: true})
+	assert.ErrorIs(t, err, secretstore.ErrAlreadyExists)
+	assert.Equal(t, []string{"CreateSecret", "CreateSecret"}, fake.calls)
+}
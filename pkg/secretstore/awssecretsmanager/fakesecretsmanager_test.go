@@ -0,0 +1,245 @@
+//go:build unit
+// +build unit
+
+package awssecretsmanager_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/awssecretsmanager"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeVersion struct {
+	id     string
+	value  string
+	stages []string
+}
+
+type fakeSecret struct {
+	arn      string
+	tags     map[string]string
+	versions []*fakeVersion
+}
+
+// fakeSecretsManager is a minimal in memory fake of the AWS Secrets Manager JSON API
+type fakeSecretsManager struct {
+	lock    sync.Mutex
+	secrets map[string]*fakeSecret
+	// calls records the operations called
+	calls []string
+	// beforeStageMove is called before the AWSCURRENT stage is moved, as if another writer got in between
+	beforeStageMove func()
+}
+
+func newFakeSecretsManager(t *testing.T) (secretstore.Interface, *fakeSecretsManager) {
+	fake := &fakeSecretsManager{secrets: map[string]*fakeSecret{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+	return awssecretsmanager.NewAwsSecretManager(sess), fake
+}
+
+// secret returns the secret identified by its name or ARN
+func (f *fakeSecretsManager) secret(id string) *fakeSecret {
+	if secret, ok := f.secrets[id]; ok {
+		return secret
+	}
+	for _, secret := range f.secrets {
+		if secret.arn == id {
+			return secret
+		}
+	}
+	return nil
+}
+
+// put adds a version to the secret, attaching the stages to it and removing them from the other versions. A new
+// AWSCURRENT version makes the old one AWSPREVIOUS
+func (f *fakeSecretsManager) put(secret *fakeSecret, value string, stages []string) *fakeVersion {
+	version := &fakeVersion{id: versionID(len(secret.versions) + 1), value: value}
+	secret.versions = append(secret.versions, version)
+	for _, stage := range stages {
+		f.moveStage(secret, stage, version)
+	}
+	return version
+}
+
+// versionID returns the id of the nth version of a secret, AWS uses UUIDs
+func versionID(n int) string {
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", n)
+}
+
+func (f *fakeSecretsManager) moveStage(secret *fakeSecret, stage string, to *fakeVersion) {
+	for _, v := range secret.versions {
+		if slices.Contains(v.stages, stage) {
+			v.stages = slices.DeleteFunc(v.stages, func(s string) bool { return s == stage })
+			if stage == awssecretsmanager.CurrentStage {
+				for _, other := range secret.versions {
+					other.stages = slices.DeleteFunc(other.stages, func(s string) bool { return s == awssecretsmanager.PreviousStage })
+				}
+				v.stages = append(v.stages, awssecretsmanager.PreviousStage)
+			}
+		}
+	}
+	to.stages = append(to.stages, stage)
+}
+
+// Set adds a current version to a secret as another client would
+func (f *fakeSecretsManager) Set(name, value string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.put(f.secrets[name], value, []string{awssecretsmanager.CurrentStage})
+}
+
+// Stages returns the stages of each version of the secret, oldest first
+func (f *fakeSecretsManager) Stages(name string) [][]string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var stages [][]string
+	for _, v := range f.secrets[name].versions {
+		stages = append(stages, v.stages)
+	}
+	return stages
+}
+
+// Tags returns the tags of the secret
+func (f *fakeSecretsManager) Tags(name string) map[string]string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.secrets[name].tags
+}
+
+type tag struct {
+	Key   string
+	Value string
+}
+
+type request struct {
+	Name                string
+	SecretId            string
+	SecretString        string
+	VersionId           string
+	VersionStage        string
+	VersionStages       []string
+	MoveToVersionId     string
+	RemoveFromVersionId string
+	Tags                []tag
+	TagKeys             []string
+}
+
+func (f *fakeSecretsManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "secretsmanager.")
+	req := request{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if operation == "UpdateSecretVersionStage" && req.VersionStage == awssecretsmanager.CurrentStage && f.beforeStageMove != nil {
+		f.beforeStageMove()
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls = append(f.calls, operation)
+	response, code, err := f.handle(operation, &req)
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	if code != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": err})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (f *fakeSecretsManager) handle(operation string, req *request) (interface{}, string, string) {
+	if operation == "CreateSecret" {
+		if f.secrets[req.Name] != nil {
+			return nil, "ResourceExistsException", "secret already exists"
+		}
+		secret := &fakeSecret{arn: "arn:aws:secretsmanager:us-east-1:123456789012:secret:" + req.Name, tags: map[string]string{}}
+		for _, t := range req.Tags {
+			secret.tags[t.Key] = t.Value
+		}
+		f.secrets[req.Name] = secret
+		version := f.put(secret, req.SecretString, []string{awssecretsmanager.CurrentStage})
+		return map[string]string{"ARN": secret.arn, "Name": req.Name, "VersionId": version.id}, "", ""
+	}
+
+	secret := f.secret(req.SecretId)
+	if secret == nil {
+		return nil, "ResourceNotFoundException", "secret not found"
+	}
+	switch operation {
+	case "GetSecretValue":
+		stage := req.VersionStage
+		if stage == "" && req.VersionId == "" {
+			stage = awssecretsmanager.CurrentStage
+		}
+		for _, v := range secret.versions {
+			if v.id == req.VersionId || slices.Contains(v.stages, stage) {
+				return map[string]interface{}{"ARN": secret.arn, "Name": req.SecretId, "SecretString": v.value, "VersionId": v.id, "VersionStages": v.stages}, "", ""
+			}
+		}
+		return nil, "ResourceNotFoundException", "version not found"
+	case "PutSecretValue":
+		stages := req.VersionStages
+		if len(stages) == 0 {
+			stages = []string{awssecretsmanager.CurrentStage}
+		}
+		version := f.put(secret, req.SecretString, stages)
+		return map[string]interface{}{"ARN": secret.arn, "VersionId": version.id, "VersionStages": version.stages}, "", ""
+	case "UpdateSecretVersionStage":
+		var from, to *fakeVersion
+		for _, v := range secret.versions {
+			if v.id == req.RemoveFromVersionId {
+				from = v
+			}
+			if v.id == req.MoveToVersionId {
+				to = v
+			}
+		}
+		if req.RemoveFromVersionId != "" && (from == nil || !slices.Contains(from.stages, req.VersionStage)) {
+			return nil, "InvalidParameterException", "the stage is not attached to the version to remove it from"
+		}
+		if to != nil {
+			f.moveStage(secret, req.VersionStage, to)
+		} else if from != nil {
+			from.stages = slices.DeleteFunc(from.stages, func(s string) bool { return s == req.VersionStage })
+		}
+		return map[string]string{"ARN": secret.arn}, "", ""
+	case "DescribeSecret":
+		var tags []tag
+		for k, v := range secret.tags {
+			tags = append(tags, tag{Key: k, Value: v})
+		}
+		return map[string]interface{}{"ARN": secret.arn, "Tags": tags}, "", ""
+	case "TagResource":
+		for _, t := range req.Tags {
+			secret.tags[t.Key] = t.Value
+		}
+		return map[string]string{}, "", ""
+	case "UntagResource":
+		for _, k := range req.TagKeys {
+			delete(secret.tags, k)
+		}
+		return map[string]string{}, "", ""
+	}
+	return nil, "InvalidRequestException", "unexpected operation " + operation
+}
@@ -1,10 +1,15 @@
 package awssystemmanager
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
@@ -18,35 +23,165 @@ type awsSystemManager struct {
 	session *session.Session
 }
 
-func (a awsSystemManager) GetSecret(location, secretName, _ string) (string, error) {
+func (a awsSystemManager) GetSecret(location, secretName, secretKey string) (string, error) {
+	return a.GetSecretWithContext(context.Background(), location, secretName, secretKey)
+}
+
+func (a awsSystemManager) GetSecretWithContext(ctx context.Context, location, secretName, secretKey string) (string, error) {
+	parameter, err := a.getParameter(ctx, location, secretName)
+	if err != nil {
+		return "", err
+	}
+	if secretKey == "" {
+		return aws.StringValue(parameter.Value), nil
+	}
+	value, ok := secretstore.NewSecretValueFromString(aws.StringValue(parameter.Value)).GetProperty(secretKey)
+	if !ok {
+		return "", secretstore.NewKeyNotFoundError(location, secretName, secretKey)
+	}
+	return value, nil
+}
+
+func (a awsSystemManager) GetSecretValue(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	parameter, err := a.getParameter(ctx, location, secretName)
+	if err != nil {
+		return nil, err
+	}
+	secretValue := secretstore.NewSecretValueFromString(aws.StringValue(parameter.Value))
+	secretValue.Version = strconv.FormatInt(aws.Int64Value(parameter.Version), 10)
+	return secretValue, nil
+}
+
+func (a awsSystemManager) getParameter(ctx context.Context, location, secretName string) (*ssm.Parameter, error) {
 	input := &ssm.GetParameterInput{
-		Name: aws.String(secretName),
+		Name:           aws.String(secretName),
+		WithDecryption: aws.Bool(true),
 	}
 	mgr := ssm.New(a.session, aws.NewConfig().WithRegion(location))
 	mgr.Config.Region = &location
-	result, err := mgr.GetParameter(input)
+	result, err := mgr.GetParameterWithContext(ctx, input)
 	if err != nil {
-		return "", fmt.Errorf("error retrieving secret from aws parameter store: %w", err)
+		return nil, fmt.Errorf("error retrieving secret from aws parameter store: %w", classifyError(location, secretName, err))
 	}
-	return result.String(), nil
+	return result.Parameter, nil
 }
 
 func (a awsSystemManager) SetSecret(location, secretName string, secretValue *secretstore.SecretValue) error {
+	return a.SetSecretWithContext(context.Background(), location, secretName, secretValue)
+}
+
+// SetSecretWithContext creates the parameter, or replaces an existing parameter if Overwrite or ExpectedVersion is set
+// and CreateOnly is not. Properties are written as a JSON object, and are merged in to the properties of the existing
+// parameter when writing with an expected version unless Overwrite is set.
+// The parameter store cannot write conditionally so a write with an expected version is best effort: it fails with a
+// conflict if the current version is not the expected version, but a write made between that check and the write is
+// not detected
+func (a awsSystemManager) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	value := secretValue.ToString()
+	if secretValue.ExpectedVersion != "" {
+		parameter, err := a.getParameter(ctx, location, secretName)
+		if err != nil && !errors.Is(err, secretstore.ErrSecretNotFound) {
+			return err
+		}
+		if err != nil || strconv.FormatInt(aws.Int64Value(parameter.Version), 10) != secretValue.ExpectedVersion {
+			return fmt.Errorf("unable to set secret %s in aws parameter store: %w", secretName, secretstore.NewConflictError(location, secretName))
+		}
+		if !secretValue.Overwrite {
+			value = secretValue.MergeExistingSecret(secretstore.NewSecretValueFromString(aws.StringValue(parameter.Value)).PropertyValues)
+		}
+	}
 	input := &ssm.PutParameterInput{
-		Name:  &secretName,
-		Value: &secretValue.Value,
+		Name:      &secretName,
+		Value:     &value,
+		Overwrite: aws.Bool(!secretValue.CreateOnly && (secretValue.Overwrite || secretValue.ExpectedVersion != "")),
 	}
 	mgr := ssm.New(a.session, aws.NewConfig().WithRegion(location))
 	mgr.Config.Region = &location
 
-	_, err := mgr.PutParameter(input)
+	_, err := mgr.PutParameterWithContext(ctx, input)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() == ssm.ErrCodeParameterAlreadyExists {
-				return fmt.Errorf("Secret Already Exists: %w", err)
-			}
-			return fmt.Errorf("error setting secret for aws parameter store: %w", err)
+		err = classifyError(location, secretName, err)
+		if errors.Is(err, secretstore.ErrAlreadyExists) {
+			return fmt.Errorf("Secret Already Exists: %w", err)
 		}
+		return fmt.Errorf("error setting secret for aws parameter store: %w", err)
+	}
+	return nil
+}
+
+func (a awsSystemManager) DeleteSecret(ctx context.Context, location, secretName string, _ *secretstore.DeleteOptions) error {
+	input := &ssm.DeleteParameterInput{
+		Name: aws.String(secretName),
+	}
+	mgr := ssm.New(a.session, aws.NewConfig().WithRegion(location))
+	mgr.Config.Region = &location
+
+	_, err := mgr.DeleteParameterWithContext(ctx, input)
+	if err != nil {
+		return fmt.Errorf("error deleting secret %s from aws parameter store: %w", secretName, classifyError(location, secretName, err))
 	}
 	return nil
 }
+
+// ListSecrets lists parameters recursively beneath the hierarchy containing the prefix, e.g. a prefix of /jx/db lists
+// the path /jx and then filters on the prefix
+func (a awsSystemManager) ListSecrets(ctx context.Context, location string, options *secretstore.ListOptions) *secretstore.SecretIterator {
+	mgr := ssm.New(a.session, aws.NewConfig().WithRegion(location))
+	mgr.Config.Region = &location
+	prefix := options.GetPrefix()
+	return secretstore.NewSecretIterator(ctx, prefix, func(ctx context.Context, pageToken string) ([]secretstore.SecretInfo, string, error) {
+		input := &ssm.GetParametersByPathInput{
+			Path:      aws.String(parameterPath(prefix)),
+			Recursive: aws.Bool(true),
+		}
+		if pageSize := options.GetPageSize(); pageSize > 0 {
+			input.MaxResults = aws.Int64(int64(pageSize))
+		}
+		if pageToken != "" {
+			input.NextToken = aws.String(pageToken)
+		}
+		output, err := mgr.GetParametersByPathWithContext(ctx, input)
+		if err != nil {
+			return nil, "", fmt.Errorf("error listing secrets in aws parameter store region %s: %w", location, classifyError(location, "", err))
+		}
+		secrets := make([]secretstore.SecretInfo, 0, len(output.Parameters))
+		for _, parameter := range output.Parameters {
+			secrets = append(secrets, secretstore.SecretInfo{
+				Name:      aws.StringValue(parameter.Name),
+				UpdatedAt: aws.TimeValue(parameter.LastModifiedDate),
+			})
+		}
+		return secrets, aws.StringValue(output.NextToken), nil
+	})
+}
+
+// parameterPath returns the parameter hierarchy containing prefix, as GetParametersByPath only accepts complete paths
+func parameterPath(prefix string) string {
+	i := strings.LastIndex(prefix, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return prefix[:i]
+}
+
+// classifyError maps AWS error codes on to the secretstore error kinds
+func classifyError(location, secretName string, err error) error {
+	var kind error
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch aerr.Code() {
+		case ssm.ErrCodeParameterNotFound, ssm.ErrCodeParameterVersionNotFound:
+			kind = secretstore.ErrSecretNotFound
+		case ssm.ErrCodeParameterAlreadyExists:
+			kind = secretstore.ErrAlreadyExists
+		case "AccessDeniedException", "UnrecognizedClientException", "ExpiredTokenException":
+			kind = secretstore.ErrPermissionDenied
+		case ssm.ErrCodeInternalServerError, ssm.ErrCodeTooManyUpdates:
+			kind = secretstore.ErrTransient
+		}
+	}
+	if kind == nil && (request.IsErrorThrottle(err) || request.IsErrorRetryable(err)) {
+		kind = secretstore.ErrTransient
+	}
+	return secretstore.NewError(kind, location, secretName, err)
+}
@@ -0,0 +1,148 @@
+//go:build unit
+// +build unit
+
+package awssystemmanager_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/awssystemmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeParameter struct {
+	value   string
+	version int64
+}
+
+// fakeParameterStore is a minimal in memory fake of the GetParameter and PutParameter calls of the SSM JSON API
+type fakeParameterStore struct {
+	lock       sync.Mutex
+	parameters map[string]*fakeParameter
+}
+
+func (f *fakeParameterStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		Name      string
+		Value     string
+		Overwrite bool
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	parameter := f.parameters[req.Name]
+	switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSSM.") {
+	case "GetParameter":
+		if parameter == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ParameterNotFound","message":"not found"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"Parameter": map[string]interface{}{"Name": req.Name, "Value": parameter.value, "Version": parameter.version},
+		})
+	case "PutParameter":
+		if parameter != nil && !req.Overwrite {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ParameterAlreadyExists","message":"already exists"}`))
+			return
+		}
+		if parameter == nil {
+			parameter = &fakeParameter{}
+			f.parameters[req.Name] = parameter
+		}
+		parameter.value = req.Value
+		parameter.version++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"Version": parameter.version})
+	default:
+		http.Error(w, "unexpected operation", http.StatusBadRequest)
+	}
+}
+
+func newManager(t *testing.T) secretstore.Interface {
+	server := httptest.NewServer(&fakeParameterStore{parameters: map[string]*fakeParameter{}})
+	t.Cleanup(server.Close)
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+	return awssystemmanager.NewAwsSystemManager(sess)
+}
+
+func TestProperties(t *testing.T) {
+	ctx := context.Background()
+	mgr := newManager(t)
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "/jx/db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin", "password": "hunter2"},
+	}))
+	value, err := mgr.GetSecretValue(ctx, "us-east-1", "/jx/db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "hunter2"}, value.PropertyValues)
+	assert.Empty(t, value.Value)
+	password, err := mgr.GetSecretWithContext(ctx, "us-east-1", "/jx/db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", password)
+	_, err = mgr.GetSecretWithContext(ctx, "us-east-1", "/jx/db", "missing")
+	assert.ErrorIs(t, err, secretstore.ErrKeyNotFound)
+
+	// properties written with an expected version are merged in to the existing properties unless overwriting
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "/jx/db", &secretstore.SecretValue{
+		PropertyValues:  map[string]string{"password": "changed"},
+		ExpectedVersion: "1",
+	}))
+	value, err = mgr.GetSecretValue(ctx, "us-east-1", "/jx/db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "changed"}, value.PropertyValues)
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "/jx/db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"password": "replaced"},
+		Overwrite:      true,
+	}))
+	value, err = mgr.GetSecretValue(ctx, "us-east-1", "/jx/db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "replaced"}, value.PropertyValues)
+}
+
+func TestSetSecretWithExpectedVersion(t *testing.T) {
+	ctx := context.Background()
+	mgr := newManager(t)
+
+	err := mgr.SetSecretWithContext(ctx, "us-east-1", "/jx/token", &secretstore.SecretValue{Value: "a", ExpectedVersion: "1"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "/jx/token", &secretstore.SecretValue{Value: "a"}))
+	err = mgr.SetSecretWithContext(ctx, "us-east-1", "/jx/token", &secretstore.SecretValue{Value: "b"})
+	assert.ErrorIs(t, err, secretstore.ErrAlreadyExists)
+
+	value, err := mgr.GetSecretValue(ctx, "us-east-1", "/jx/token")
+	require.NoError(t, err)
+	assert.Equal(t, "1", value.Version)
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "/jx/token", &secretstore.SecretValue{Value: "b", ExpectedVersion: "1"}))
+	err = mgr.SetSecretWithContext(ctx, "us-east-1", "/jx/token", &secretstore.SecretValue{Value: "c", ExpectedVersion: "1"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "us-east-1", "/jx/token", &secretstore.SecretValue{Value: "c", Overwrite: true}))
+	err = mgr.SetSecretWithContext(ctx, "us-east-1", "/jx/token", &secretstore.SecretValue{Value: "d", Overwrite: true, CreateOnly: true})
+	assert.ErrorIs(t, err, secretstore.ErrAlreadyExists)
+
+	value, err = mgr.GetSecretValue(ctx, "us-east-1", "/jx/token")
+	require.NoError(t, err)
+	assert.Equal(t, "c", value.Value)
+	assert.Equal(t, "3", value.Version)
+}
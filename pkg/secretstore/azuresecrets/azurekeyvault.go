@@ -3,32 +3,51 @@ package azuresecrets
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"sort"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/iam/azureiam"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
 )
 
+// deletePollInterval is how often to check whether a soft delete has completed before purging
+const deletePollInterval = 2 * time.Second
+
 func NewAzureKeyVaultSecretManager() secretstore.Interface {
-	return &azureKeyVaultSecretManager{}
+	return &azureKeyVaultSecretManager{newClient: getSecretOpsClient}
 }
 
 type azureKeyVaultSecretManager struct {
+	// newClient creates the client for a vault, tests replace it to talk to a fake Key Vault
+	newClient func(ctx context.Context, vaultName string) (*azsecrets.Client, error)
 }
 
 func (a *azureKeyVaultSecretManager) GetSecret(vaultName, secretName, secretKey string) (string, error) {
-	keyClient, err := getSecretOpsClient(vaultName)
+	return a.GetSecretWithContext(context.Background(), vaultName, secretName, secretKey)
+}
+
+func (a *azureKeyVaultSecretManager) GetSecretWithContext(ctx context.Context, vaultName, secretName, secretKey string) (string, error) {
+	keyClient, err := a.newClient(ctx, vaultName)
 	if err != nil {
 		return "", fmt.Errorf("unable to create key ops client: %w", err)
 	}
-	bundle, err := keyClient.GetSecret(context.TODO(), secretName, "", nil)
+	bundle, err := keyClient.GetSecret(ctx, secretName, "", nil)
 	if err != nil {
-		return "", fmt.Errorf("unable to retrieve secret %s from vault %s: %w", secretName, vaultName, err)
+		return "", fmt.Errorf("unable to retrieve secret %s from vault %s: %w", secretName, vaultName, classifyError(vaultName, secretName, err))
 	}
 	if bundle.Value == nil {
-		return "", fmt.Errorf("secret is empty for secret %s in vault %s: %w", secretName, vaultName, err)
+		// a secret without a value has no keys either
+		if secretKey != "" {
+			return "", secretstore.NewKeyNotFoundError(vaultName, secretName, secretKey)
+		}
+		return "", secretstore.NewSecretNotFoundError(vaultName, secretName)
 	}
 	var secretString string
 	if secretKey != "" {
@@ -43,24 +62,283 @@ func (a *azureKeyVaultSecretManager) GetSecret(vaultName, secretName, secretKey
 	return secretString, nil
 }
 
+func (a *azureKeyVaultSecretManager) GetSecretValue(ctx context.Context, vaultName, secretName string) (*secretstore.SecretValue, error) {
+	keyClient, err := a.newClient(ctx, vaultName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create key ops client: %w", err)
+	}
+	bundle, err := keyClient.GetSecret(ctx, secretName, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve secret %s from vault %s: %w", secretName, vaultName, classifyError(vaultName, secretName, err))
+	}
+	if bundle.Value == nil {
+		return nil, secretstore.NewSecretNotFoundError(vaultName, secretName)
+	}
+	secretValue := secretstore.NewSecretValueFromString(*bundle.Value)
+	if bundle.ID != nil {
+		secretValue.Version = bundle.ID.Version()
+	}
+	if len(bundle.Tags) > 0 {
+		secretValue.Labels = map[string]string{}
+		for k, v := range bundle.Tags {
+			if v != nil {
+				secretValue.Labels[k] = *v
+			}
+		}
+	}
+	return secretValue, nil
+}
+
 func (a *azureKeyVaultSecretManager) SetSecret(vaultName, secretName string, secretValue *secretstore.SecretValue) error {
-	keyClient, err := getSecretOpsClient(vaultName)
+	return a.SetSecretWithContext(context.Background(), vaultName, secretName, secretValue)
+}
+
+// SetSecretWithContext adds a new version of the secret, merging it with the current version unless Overwrite is set.
+// Labels are stored as tags, which belong to each version, so the tags of the current version are carried over to the
+// new one. Azure Key Vault has nowhere to store annotations so they are not written. Azure Key Vault cannot add a
+// version conditionally so a write with an expected version is best effort: it fails with a conflict if the current
+// version is not the expected version, but a write made between that check and adding the version is not detected. For
+// the same reason CreateOnly is not supported
+func (a *azureKeyVaultSecretManager) SetSecretWithContext(ctx context.Context, vaultName, secretName string, secretValue *secretstore.SecretValue) error {
+	if secretValue.CreateOnly {
+		return fmt.Errorf("unable to create secret %s in vault %s only if it does not exist: %w", secretName, vaultName, secretstore.ErrNotSupported)
+	}
+	keyClient, err := a.newClient(ctx, vaultName)
 	if err != nil {
 		return fmt.Errorf("unable to create key ops client: %w", err)
 	}
-	secretString := secretValue.ToString()
+	exists := true
+	current, err := keyClient.GetSecret(ctx, secretName, "", nil)
+	if err != nil {
+		err = classifyError(vaultName, secretName, err)
+		if !errors.Is(err, secretstore.ErrSecretNotFound) {
+			return fmt.Errorf("unable to retrieve secret %s from vault %s prior to setting: %w", secretName, vaultName, err)
+		}
+		exists = false
+	}
+	if secretValue.ExpectedVersion != "" && (!exists || current.ID == nil || current.ID.Version() != secretValue.ExpectedVersion) {
+		return fmt.Errorf("unable to set secret %s in vault %s: %w", secretName, vaultName, secretstore.NewConflictError(vaultName, secretName))
+	}
+
+	var existingSecretProps map[string]string
+	tags := current.Tags
+	if secretValue.Overwrite {
+		tags = nil
+	} else if exists && current.Value != nil {
+		// a secret holding a single value has no properties to merge with, so it is replaced
+		existingSecretProps = secretstore.NewSecretValueFromString(*current.Value).PropertyValues
+	}
+	if len(secretValue.Labels) > 0 {
+		merged := make(map[string]*string, len(tags)+len(secretValue.Labels))
+		for k, v := range tags {
+			merged[k] = v
+		}
+		for k, v := range secretValue.Labels {
+			merged[k] = to.Ptr(v)
+		}
+		tags = merged
+	}
+	secretString := secretValue.MergeExistingSecret(existingSecretProps)
 	params := azsecrets.SetSecretParameters{
 		Value: &secretString,
+		Tags:  tags,
+	}
+	_, err = keyClient.SetSecret(ctx, secretName, params, nil)
+
+	if err != nil {
+		return fmt.Errorf("unable to set secret %s in vault %s: %w", secretName, vaultName, classifyError(vaultName, secretName, err))
 	}
-	_, err = keyClient.SetSecret(context.TODO(), secretName, params, nil)
 
+	return nil
+}
+
+func (a *azureKeyVaultSecretManager) ListSecretVersions(ctx context.Context, vaultName, secretName string) ([]secretstore.SecretVersion, error) {
+	keyClient, err := a.newClient(ctx, vaultName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create key ops client: %w", err)
+	}
+	var versions []secretstore.SecretVersion
+	pager := keyClient.NewListSecretPropertiesVersionsPager(secretName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list versions of secret %s in vault %s: %w", secretName, vaultName, classifyError(vaultName, secretName, err))
+		}
+		for _, props := range page.Value {
+			if props == nil || props.ID == nil {
+				continue
+			}
+			version := secretstore.SecretVersion{
+				Version: props.ID.Version(),
+				State:   secretstore.VersionStateEnabled,
+			}
+			if props.Attributes != nil {
+				if props.Attributes.Created != nil {
+					version.CreatedAt = *props.Attributes.Created
+				}
+				if props.Attributes.Enabled != nil && !*props.Attributes.Enabled {
+					version.State = secretstore.VersionStateDisabled
+				}
+			}
+			versions = append(versions, version)
+		}
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].CreatedAt.After(versions[j].CreatedAt)
+	})
+	return versions, nil
+}
+
+// Watch polls the id of the latest version of the secret
+func (a *azureKeyVaultSecretManager) Watch(ctx context.Context, vaultName, secretName string, options *secretstore.WatchOptions) (<-chan secretstore.WatchEvent, error) {
+	keyClient, err := a.newClient(ctx, vaultName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create key ops client: %w", err)
+	}
+	return secretstore.PollWatch(ctx, vaultName, secretName, options.GetPollInterval(), func(ctx context.Context) (string, error) {
+		bundle, err := keyClient.GetSecret(ctx, secretName, "", nil)
+		if err != nil {
+			return "", classifyError(vaultName, secretName, err)
+		}
+		if bundle.ID == nil {
+			return "", nil
+		}
+		return bundle.ID.Version(), nil
+	}), nil
+}
+
+func (a *azureKeyVaultSecretManager) GetSecretVersion(ctx context.Context, vaultName, secretName, version string) (*secretstore.SecretValue, error) {
+	keyClient, err := a.newClient(ctx, vaultName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create key ops client: %w", err)
+	}
+	bundle, err := keyClient.GetSecret(ctx, secretName, version, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve version %s of secret %s from vault %s: %w", version, secretName, vaultName,
+			classifyError(vaultName, secretName, err))
+	}
+	if bundle.Value == nil {
+		return nil, secretstore.NewSecretNotFoundError(vaultName, secretName)
+	}
+	secretValue := secretstore.NewSecretValueFromString(*bundle.Value)
+	secretValue.Version = version
+	return secretValue, nil
+}
+
+func (a *azureKeyVaultSecretManager) DisableSecretVersion(ctx context.Context, vaultName, secretName, version string) error {
+	keyClient, err := a.newClient(ctx, vaultName)
 	if err != nil {
 		return fmt.Errorf("unable to create key ops client: %w", err)
 	}
+	enabled := false
+	params := azsecrets.UpdateSecretPropertiesParameters{
+		SecretAttributes: &azsecrets.SecretAttributes{Enabled: &enabled},
+	}
+	_, err = keyClient.UpdateSecretProperties(ctx, secretName, version, params, nil)
+	if err != nil {
+		return fmt.Errorf("unable to disable version %s of secret %s in vault %s: %w", version, secretName, vaultName,
+			classifyError(vaultName, secretName, err))
+	}
+	return nil
+}
+
+// DestroySecretVersion is not supported as Azure Key Vault can only delete whole secrets
+func (a *azureKeyVaultSecretManager) DestroySecretVersion(_ context.Context, vaultName, secretName, version string) error {
+	return fmt.Errorf("unable to destroy version %s of secret %s in vault %s, disable it instead: %w", version, secretName, vaultName,
+		secretstore.ErrNotSupported)
+}
+
+// DeleteSecret soft deletes the secret and, if options.Purge is set, waits for the deletion to complete before
+// permanently purging it
+func (a *azureKeyVaultSecretManager) DeleteSecret(ctx context.Context, vaultName, secretName string, options *secretstore.DeleteOptions) error {
+	keyClient, err := a.newClient(ctx, vaultName)
+	if err != nil {
+		return fmt.Errorf("unable to create key ops client: %w", err)
+	}
+	_, err = keyClient.DeleteSecret(ctx, secretName, nil)
+	if err != nil {
+		return fmt.Errorf("unable to delete secret %s from vault %s: %w", secretName, vaultName, classifyError(vaultName, secretName, err))
+	}
+	if options == nil || !options.Purge {
+		return nil
+	}
 
+	err = waitForDeletedSecret(ctx, keyClient, secretName)
+	if err != nil {
+		return fmt.Errorf("error waiting for deletion of secret %s from vault %s: %w", secretName, vaultName, err)
+	}
+	_, err = keyClient.PurgeDeletedSecret(ctx, secretName, nil)
+	if err != nil {
+		return fmt.Errorf("unable to purge deleted secret %s from vault %s: %w", secretName, vaultName, classifyError(vaultName, secretName, err))
+	}
 	return nil
 }
 
+func (a *azureKeyVaultSecretManager) ListSecrets(ctx context.Context, vaultName string, options *secretstore.ListOptions) *secretstore.SecretIterator {
+	keyClient, err := a.newClient(ctx, vaultName)
+	if err != nil {
+		return secretstore.NewErrorSecretIterator(fmt.Errorf("unable to create key ops client: %w", err))
+	}
+	// the Azure pager tracks the continuation token itself so the page token only signals whether there are more pages
+	pager := keyClient.NewListSecretPropertiesPager(nil)
+	return secretstore.NewSecretIterator(ctx, options.GetPrefix(), func(ctx context.Context, _ string) ([]secretstore.SecretInfo, string, error) {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to list secrets in vault %s: %w", vaultName, classifyError(vaultName, "", err))
+		}
+		secrets := make([]secretstore.SecretInfo, 0, len(page.Value))
+		for _, props := range page.Value {
+			if props == nil || props.ID == nil {
+				continue
+			}
+			info := secretstore.SecretInfo{
+				Name: props.ID.Name(),
+			}
+			if len(props.Tags) > 0 {
+				info.Labels = map[string]string{}
+				for k, v := range props.Tags {
+					if v != nil {
+						info.Labels[k] = *v
+					}
+				}
+			}
+			if props.Attributes != nil {
+				if props.Attributes.Created != nil {
+					info.CreatedAt = *props.Attributes.Created
+				}
+				if props.Attributes.Updated != nil {
+					info.UpdatedAt = *props.Attributes.Updated
+				}
+			}
+			secrets = append(secrets, info)
+		}
+		nextPageToken := ""
+		if pager.More() {
+			nextPageToken = "more"
+		}
+		return secrets, nextPageToken, nil
+	})
+}
+
+// waitForDeletedSecret polls until a deleted secret is visible as deleted, only then can it be purged
+func waitForDeletedSecret(ctx context.Context, keyClient *azsecrets.Client, secretName string) error {
+	for {
+		_, err := keyClient.GetDeletedSecret(ctx, secretName, nil)
+		if err == nil {
+			return nil
+		}
+		var respErr *azcore.ResponseError
+		if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusNotFound {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(deletePollInterval):
+		}
+	}
+}
+
 func getSecretPropertyMap(v azsecrets.GetSecretResponse) (map[string]string, error) {
 	m := make(map[string]string)
 	secretString := *v.Value
@@ -77,10 +355,28 @@ func getSecretProperty(v azsecrets.GetSecretResponse, propertyName string) (stri
 	if err != nil {
 		return "", fmt.Errorf("error reading property %s from secret JSON object: %w", propertyName, err)
 	}
-	return m[propertyName], nil
+	value, ok := m[propertyName]
+	if !ok {
+		return "", fmt.Errorf("property %s does not occur in secret JSON object: %w", propertyName, secretstore.ErrKeyNotFound)
+	}
+	return value, nil
 }
 
-func getSecretOpsClient(vaultName string) (*azsecrets.Client, error) {
+// classifyError maps Azure Key Vault HTTP errors on to the secretstore error kinds
+func classifyError(vaultName, secretName string, err error) error {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+	return secretstore.NewError(secretstore.ErrorKindFromHTTPStatus(respErr.StatusCode), vaultName, secretName, err)
+}
+
+// getSecretOpsClient creates a client for the vault. The client authenticates lazily, fetching tokens with the context of
+// each request, so ctx cancels or times out authentication as well as the calls made with it
+func getSecretOpsClient(ctx context.Context, vaultName string) (*azsecrets.Client, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	vaultURL, err := url.Parse(fmt.Sprintf("https://%s.vault.azure.net", vaultName))
 	if err != nil {
 		return nil, fmt.Errorf("error resolving url for Azure Key Vault %s: %w", vaultName, err)
@@ -0,0 +1,113 @@
+//go:build unit
+// +build unit
+
+package azuresecrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAndSetSecret(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newFakeKeyVault(t, fakeCredential{})
+
+	_, err := mgr.GetSecretValue(ctx, "vault", "db")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "vault", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "hunter2"}}))
+	value, err := mgr.GetSecretValue(ctx, "vault", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "hunter2"}, value.PropertyValues)
+	assert.Equal(t, "v1", value.Version)
+}
+
+func TestGetSecretWithoutValue(t *testing.T) {
+	ctx := context.Background()
+	mgr, vault := newFakeKeyVault(t, fakeCredential{})
+	vault.set("db", fakeVersion{NoValue: true})
+
+	_, err := mgr.GetSecretWithContext(ctx, "vault", "db", "")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+	_, err = mgr.GetSecretWithContext(ctx, "vault", "db", "password")
+	assert.ErrorIs(t, err, secretstore.ErrKeyNotFound)
+	_, err = mgr.GetSecretValue(ctx, "vault", "db")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+}
+
+func TestContextBoundsAuthentication(t *testing.T) {
+	mgr, _ := newFakeKeyVault(t, fakeCredential{block: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := mgr.GetSecretValue(ctx, "vault", "db")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewAzureKeyVaultSecretManager().GetSecretValue(cancelled, "vault", "db")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestLabelsAreTags(t *testing.T) {
+	ctx := context.Background()
+	mgr, vault := newFakeKeyVault(t, fakeCredential{})
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "vault", "db", &secretstore.SecretValue{Value: "a", Labels: map[string]string{"team": "data"}}))
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "vault", "db", &secretstore.SecretValue{Value: "b", Labels: map[string]string{"env": "prod"}}))
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "vault", "db", &secretstore.SecretValue{Value: "c"}))
+	assert.Len(t, vault.secrets["db"], 3)
+
+	value, err := mgr.GetSecretValue(ctx, "vault", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "c", value.Value)
+	assert.Equal(t, map[string]string{"team": "data", "env": "prod"}, value.Labels)
+}
+
+func TestOverwrite(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newFakeKeyVault(t, fakeCredential{})
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "vault", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin", "legacy": "old"},
+		Labels:         map[string]string{"team": "data", "stale": "true"},
+	}))
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "vault", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin"},
+		Labels:         map[string]string{"team": "data"},
+		Overwrite:      true,
+	}))
+
+	value, err := mgr.GetSecretValue(ctx, "vault", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin"}, value.PropertyValues)
+	assert.Equal(t, map[string]string{"team": "data"}, value.Labels)
+}
+
+func TestSetSecretWithExpectedVersion(t *testing.T) {
+	ctx := context.Background()
+	mgr, vault := newFakeKeyVault(t, fakeCredential{})
+
+	err := mgr.SetSecretWithContext(ctx, "vault", "db", &secretstore.SecretValue{Value: "a", ExpectedVersion: "v1"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	err = mgr.SetSecretWithContext(ctx, "vault", "db", &secretstore.SecretValue{Value: "a", CreateOnly: true})
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "vault", "db", &secretstore.SecretValue{Value: "a"}))
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "vault", "db", &secretstore.SecretValue{Value: "b", ExpectedVersion: "v1"}))
+	value, err := mgr.GetSecretValue(ctx, "vault", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "b", value.Value)
+	assert.Equal(t, "v2", value.Version)
+
+	// another client adds a version
+	vault.set("db", fakeVersion{Value: "c"})
+	err = mgr.SetSecretWithContext(ctx, "vault", "db", &secretstore.SecretValue{Value: "d", ExpectedVersion: "v2"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	assert.Len(t, vault.secrets["db"], 3)
+}
@@ -0,0 +1,127 @@
+//go:build unit
+// +build unit
+
+package azuresecrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+)
+
+// fakeCredential issues tokens without contacting Microsoft Entra ID
+type fakeCredential struct {
+	// block makes GetToken wait until its context is done
+	block bool
+}
+
+func (c fakeCredential) GetToken(ctx context.Context, _ policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if c.block {
+		<-ctx.Done()
+		return azcore.AccessToken{}, ctx.Err()
+	}
+	return azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+type fakeVersion struct {
+	Value string            `json:"value"`
+	Tags  map[string]string `json:"tags,omitempty"`
+	// NoValue omits the value from the response
+	NoValue bool `json:"-"`
+}
+
+// fakeKeyVault is a minimal in memory fake of the Key Vault secrets API
+type fakeKeyVault struct {
+	lock    sync.Mutex
+	secrets map[string][]fakeVersion
+}
+
+func newFakeKeyVault(t *testing.T, cred azcore.TokenCredential) (*azureKeyVaultSecretManager, *fakeKeyVault) {
+	vault := &fakeKeyVault{secrets: map[string][]fakeVersion{}}
+	server := httptest.NewTLSServer(vault)
+	t.Cleanup(server.Close)
+	mgr := &azureKeyVaultSecretManager{
+		newClient: func(context.Context, string) (*azsecrets.Client, error) {
+			return azsecrets.NewClient(server.URL, cred, &azsecrets.ClientOptions{
+				ClientOptions: azcore.ClientOptions{
+					Transport: server.Client(),
+					Retry:     policy.RetryOptions{MaxRetries: -1},
+				},
+				DisableChallengeResourceVerification: true,
+			})
+		},
+	}
+	return mgr, vault
+}
+
+// set adds a version to a secret as another client would
+func (f *fakeKeyVault) set(name string, version fakeVersion) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.secrets[name] = append(f.secrets[name], version)
+}
+
+func (f *fakeKeyVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer authorization="https://login.microsoftonline.com/tenant", resource="https://vault.azure.net"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "secrets" {
+		http.NotFound(w, r)
+		return
+	}
+	name := parts[1]
+	version := ""
+	if len(parts) > 2 {
+		version = parts[2]
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		written := fakeVersion{}
+		if err := json.NewDecoder(r.Body).Decode(&written); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.set(name, written)
+		version = ""
+	case http.MethodGet:
+	default:
+		http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	versions := f.secrets[name]
+	i := len(versions)
+	if version != "" {
+		fmt.Sscanf(version, "v%d", &i)
+	}
+	if i < 1 || i > len(versions) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error":{"code":"SecretNotFound","message":"secret %s not found"}}`, name)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	resp := map[string]interface{}{
+		"id":   fmt.Sprintf("https://%s/secrets/%s/v%d", r.Host, name, i),
+		"tags": versions[i-1].Tags,
+	}
+	if !versions[i-1].NoValue {
+		resp["value"] = versions[i-1].Value
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,138 @@
+package secretstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultBatchParallelism is the number of concurrent calls made to the secret store when BatchOptions does not set
+// Parallelism
+const DefaultBatchParallelism = 8
+
+// BatchOptions configures BatchGet and BatchSet. A nil *BatchOptions uses the defaults
+type BatchOptions struct {
+	// Parallelism is the maximum number of concurrent calls to the secret store
+	Parallelism int
+}
+
+func (o *BatchOptions) parallelism() int {
+	if o == nil || o.Parallelism <= 0 {
+		return DefaultBatchParallelism
+	}
+	return o.Parallelism
+}
+
+// GetRequest identifies a secret key to read as part of a batch
+type GetRequest struct {
+	Location   string
+	SecretName string
+	SecretKey  string
+}
+
+// GetResult is the outcome of a single GetRequest
+type GetResult struct {
+	GetRequest
+	Value string
+	Err   error
+}
+
+// SetRequest is a secret to write as part of a batch
+type SetRequest struct {
+	Location    string
+	SecretName  string
+	SecretValue *SecretValue
+}
+
+// SetResult is the outcome of a single SetRequest
+type SetResult struct {
+	SetRequest
+	Err error
+}
+
+// BatchGet reads the secrets concurrently. Identical requests result in a single call to the secret store. The
+// results are in the same order as requests and the returned error joins the errors of every failed request
+func BatchGet(ctx context.Context, mgr Interface, requests []GetRequest, options *BatchOptions) ([]GetResult, error) {
+	indexes := map[GetRequest][]int{}
+	var unique []GetRequest
+	for i, req := range requests {
+		if _, ok := indexes[req]; !ok {
+			unique = append(unique, req)
+		}
+		indexes[req] = append(indexes[req], i)
+	}
+
+	results := make([]GetResult, len(requests))
+	runBatch(len(unique), options.parallelism(), func(i int) {
+		req := unique[i]
+		value, err := mgr.GetSecretWithContext(ctx, req.Location, req.SecretName, req.SecretKey)
+		if err != nil {
+			err = fmt.Errorf("failed to get key %s of secret %s at location %s: %w", req.SecretKey, req.SecretName, req.Location, err)
+		}
+		for _, j := range indexes[req] {
+			results[j] = GetResult{GetRequest: req, Value: value, Err: err}
+		}
+	})
+
+	errs := make([]error, 0, len(unique))
+	for _, req := range unique {
+		errs = append(errs, results[indexes[req][0]].Err)
+	}
+	return results, errors.Join(errs...)
+}
+
+// BatchSet writes the secrets concurrently. Requests for the same secret are applied one at a time in the order given
+// as secret managers merge new values with the existing secret. The results are in the same order as requests and the
+// returned error joins the errors of every failed request
+func BatchSet(ctx context.Context, mgr Interface, requests []SetRequest, options *BatchOptions) ([]SetResult, error) {
+	type secretID struct {
+		location   string
+		secretName string
+	}
+	groups := map[secretID][]int{}
+	var order []secretID
+	for i, req := range requests {
+		id := secretID{location: req.Location, secretName: req.SecretName}
+		if _, ok := groups[id]; !ok {
+			order = append(order, id)
+		}
+		groups[id] = append(groups[id], i)
+	}
+
+	results := make([]SetResult, len(requests))
+	runBatch(len(order), options.parallelism(), func(i int) {
+		for _, j := range groups[order[i]] {
+			req := requests[j]
+			err := mgr.SetSecretWithContext(ctx, req.Location, req.SecretName, req.SecretValue)
+			if err != nil {
+				err = fmt.Errorf("failed to set secret %s at location %s: %w", req.SecretName, req.Location, err)
+			}
+			results[j] = SetResult{SetRequest: req, Err: err}
+		}
+	})
+
+	errs := make([]error, 0, len(results))
+	for i := range results {
+		errs = append(errs, results[i].Err)
+	}
+	return results, errors.Join(errs...)
+}
+
+// runBatch calls fn for each index from 0 to n-1 with at most parallelism calls running at once
+func runBatch(n, parallelism int, fn func(i int)) {
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,97 @@
+//go:build unit
+// +build unit
+
+package secretstore_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore records the calls made and the maximum number of concurrent calls
+type countingStore struct {
+	secretstore.Interface
+	mu          sync.Mutex
+	calls       []string
+	active      int32
+	maxParallel int32
+}
+
+func (c *countingStore) track(call string) func() {
+	c.mu.Lock()
+	c.calls = append(c.calls, call)
+	c.mu.Unlock()
+	active := atomic.AddInt32(&c.active, 1)
+	for {
+		maxParallel := atomic.LoadInt32(&c.maxParallel)
+		if active <= maxParallel || atomic.CompareAndSwapInt32(&c.maxParallel, maxParallel, active) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return func() { atomic.AddInt32(&c.active, -1) }
+}
+
+func (c *countingStore) GetSecretWithContext(ctx context.Context, location, secretName, secretKey string) (string, error) {
+	defer c.track(location + "/" + secretName + "#" + secretKey)()
+	return c.Interface.GetSecretWithContext(ctx, location, secretName, secretKey)
+}
+
+func (c *countingStore) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	defer c.track(location + "/" + secretName)()
+	return c.Interface.SetSecretWithContext(ctx, location, secretName, secretValue)
+}
+
+func TestBatchGetDeduplicatesAndLimitsParallelism(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, store.SetSecret("loc", name, &secretstore.SecretValue{PropertyValues: map[string]string{"key": name + "-value"}}))
+	}
+	mgr := &countingStore{Interface: store}
+
+	requests := []secretstore.GetRequest{
+		{Location: "loc", SecretName: "a", SecretKey: "key"},
+		{Location: "loc", SecretName: "b", SecretKey: "key"},
+		{Location: "loc", SecretName: "a", SecretKey: "key"},
+		{Location: "loc", SecretName: "c", SecretKey: "key"},
+		{Location: "loc", SecretName: "d", SecretKey: "key"},
+		{Location: "loc", SecretName: "missing", SecretKey: "key"},
+	}
+	results, err := secretstore.BatchGet(context.Background(), mgr, requests, &secretstore.BatchOptions{Parallelism: 2})
+
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+	require.Len(t, results, len(requests))
+	assert.Equal(t, "a-value", results[0].Value)
+	assert.Equal(t, "b-value", results[1].Value)
+	assert.Equal(t, "a-value", results[2].Value)
+	assert.Equal(t, "d-value", results[4].Value)
+	assert.NoError(t, results[4].Err)
+	assert.ErrorIs(t, results[5].Err, secretstore.ErrSecretNotFound)
+	assert.Len(t, mgr.calls, 5)
+	assert.LessOrEqual(t, mgr.maxParallel, int32(2))
+}
+
+func TestBatchSetAppliesWritesToTheSameSecretInOrder(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+	mgr := &countingStore{Interface: store}
+
+	requests := []secretstore.SetRequest{
+		{Location: "loc", SecretName: "a", SecretValue: &secretstore.SecretValue{Value: "first"}},
+		{Location: "loc", SecretName: "b", SecretValue: &secretstore.SecretValue{Value: "b"}},
+		{Location: "loc", SecretName: "a", SecretValue: &secretstore.SecretValue{Value: "second"}},
+	}
+	results, err := secretstore.BatchSet(context.Background(), mgr, requests, nil)
+
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+	store.AssertValueEquals(t, "loc", "a", "", "second")
+	store.AssertValueEquals(t, "loc", "b", "", "b")
+}
@@ -0,0 +1,349 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultTTL is how long values are cached when Options does not set TTL
+	DefaultTTL = 5 * time.Minute
+	// DefaultMaxEntries is the maximum number of cached entries when Options does not set MaxEntries
+	DefaultMaxEntries = 1000
+)
+
+// Options configures the cache. A nil *Options uses the defaults
+type Options struct {
+	// TTL is how long a value read from the secret store is cached
+	TTL time.Duration
+	// NegativeTTL is how long secret and key not found errors are cached, zero disables negative caching
+	NegativeTTL time.Duration
+	// MaxEntries bounds the number of cached entries, the least recently used entries are evicted first
+	MaxEntries int
+	// Singleflight makes concurrent reads of the same uncached secret share a single call to the secret store
+	Singleflight bool
+}
+
+func (o *Options) ttl() time.Duration {
+	if o == nil || o.TTL <= 0 {
+		return DefaultTTL
+	}
+	return o.TTL
+}
+
+func (o *Options) negativeTTL() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.NegativeTTL
+}
+
+func (o *Options) singleflightEnabled() bool {
+	return o != nil && o.Singleflight
+}
+
+func (o *Options) maxEntries() int {
+	if o == nil || o.MaxEntries <= 0 {
+		return DefaultMaxEntries
+	}
+	return o.MaxEntries
+}
+
+// secretID identifies a secret, all cached entries of a secret are invalidated together
+type secretID struct {
+	location   string
+	secretName string
+}
+
+// entryKey identifies a cached entry, whole is set for entries cached by GetSecretValue
+type entryKey struct {
+	secretID
+	secretKey string
+	whole     bool
+}
+
+type entry struct {
+	key     entryKey
+	value   string
+	secret  *secretstore.SecretValue
+	err     error
+	expires time.Time
+}
+
+// SecretStore caches the values read from another secret manager. Writes and deletes made through the SecretStore
+// invalidate the cached values of the secret, changes made directly in the secret store are only seen once the TTL
+// expires
+type SecretStore struct {
+	secretstore.Interface
+	options *Options
+	now     func() time.Time
+	group   singleflight.Group
+
+	lock    sync.Mutex
+	lru     *list.List
+	entries map[entryKey]*list.Element
+	// generation is incremented on every invalidation so that reads started before a write don't cache stale values
+	generation uint64
+}
+
+// NewSecretStore creates a SecretStore caching the values read from mgr. The SecretStore does not implement
+// VersionInterface or WatchInterface, use Manager to get a secret manager which does when mgr does
+func NewSecretStore(mgr secretstore.Interface, options *Options) *SecretStore {
+	return &SecretStore{
+		Interface: mgr,
+		options:   options,
+		now:       time.Now,
+		lru:       list.New(),
+		entries:   map[entryKey]*list.Element{},
+	}
+}
+
+func (c *SecretStore) GetSecret(location, secretName, secretKey string) (string, error) {
+	return c.GetSecretWithContext(context.Background(), location, secretName, secretKey)
+}
+
+func (c *SecretStore) GetSecretWithContext(ctx context.Context, location, secretName, secretKey string) (string, error) {
+	key := entryKey{secretID: secretID{location: location, secretName: secretName}, secretKey: secretKey}
+	e, err := c.load(ctx, key, func(ctx context.Context) (*entry, error) {
+		value, err := c.Interface.GetSecretWithContext(ctx, location, secretName, secretKey)
+		return &entry{value: value}, err
+	})
+	if err != nil {
+		return "", err
+	}
+	return e.value, nil
+}
+
+func (c *SecretStore) GetSecretValue(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	key := entryKey{secretID: secretID{location: location, secretName: secretName}, whole: true}
+	e, err := c.load(ctx, key, func(ctx context.Context) (*entry, error) {
+		secret, err := c.Interface.GetSecretValue(ctx, location, secretName)
+		return &entry{secret: secret}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// copy the value so callers can't modify the cached value
+	return e.secret.DeepCopy(), nil
+}
+
+func (c *SecretStore) SetSecret(location, secretName string, secretValue *secretstore.SecretValue) error {
+	return c.SetSecretWithContext(context.Background(), location, secretName, secretValue)
+}
+
+func (c *SecretStore) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	defer c.Invalidate(location, secretName)
+	return c.Interface.SetSecretWithContext(ctx, location, secretName, secretValue)
+}
+
+func (c *SecretStore) DeleteSecret(ctx context.Context, location, secretName string, options *secretstore.DeleteOptions) error {
+	defer c.Invalidate(location, secretName)
+	return c.Interface.DeleteSecret(ctx, location, secretName, options)
+}
+
+// Manager returns the SecretStore as a secret manager which implements VersionInterface and WatchInterface only if the
+// secret manager it caches does
+func (c *SecretStore) Manager() secretstore.Interface {
+	_, versioned := c.Interface.(secretstore.VersionInterface)
+	_, watcher := c.Interface.(secretstore.WatchInterface)
+	switch {
+	case versioned && watcher:
+		return &cachedVersionWatchStore{SecretStore: c, cachedVersions: cachedVersions{c}, cachedWatch: cachedWatch{c}}
+	case versioned:
+		return &cachedVersions{c}
+	case watcher:
+		return &cachedWatch{c}
+	}
+	return c
+}
+
+// cachedVersions caches a secret manager implementing VersionInterface
+type cachedVersions struct {
+	*SecretStore
+}
+
+// cachedWatch caches a secret manager implementing WatchInterface
+type cachedWatch struct {
+	*SecretStore
+}
+
+// cachedVersionWatchStore caches a secret manager implementing both VersionInterface and WatchInterface
+type cachedVersionWatchStore struct {
+	*SecretStore
+	cachedVersions
+	cachedWatch
+}
+
+func (c cachedVersions) ListSecretVersions(ctx context.Context, location, secretName string) ([]secretstore.SecretVersion, error) {
+	versioned := c.Interface.(secretstore.VersionInterface)
+	return versioned.ListSecretVersions(ctx, location, secretName)
+}
+
+func (c cachedVersions) GetSecretVersion(ctx context.Context, location, secretName, version string) (*secretstore.SecretValue, error) {
+	versioned := c.Interface.(secretstore.VersionInterface)
+	return versioned.GetSecretVersion(ctx, location, secretName, version)
+}
+
+func (c cachedVersions) DisableSecretVersion(ctx context.Context, location, secretName, version string) error {
+	versioned := c.Interface.(secretstore.VersionInterface)
+	defer c.Invalidate(location, secretName)
+	return versioned.DisableSecretVersion(ctx, location, secretName, version)
+}
+
+func (c cachedVersions) DestroySecretVersion(ctx context.Context, location, secretName, version string) error {
+	versioned := c.Interface.(secretstore.VersionInterface)
+	defer c.Invalidate(location, secretName)
+	return versioned.DestroySecretVersion(ctx, location, secretName, version)
+}
+
+// Watch invalidates the cached values of the secret on each event before passing the event on, so reading the secret
+// in response to an event returns the new value
+func (c cachedWatch) Watch(ctx context.Context, location, secretName string, options *secretstore.WatchOptions) (<-chan secretstore.WatchEvent, error) {
+	events, err := c.Interface.(secretstore.WatchInterface).Watch(ctx, location, secretName, options)
+	if err != nil {
+		return nil, err
+	}
+	sink := secretstore.NewWatchSink(ctx)
+	go func() {
+		defer sink.Close()
+		for event := range events {
+			if event.Type != secretstore.WatchEventError {
+				c.Invalidate(location, secretName)
+			}
+			sink.Send(event)
+		}
+	}()
+	return sink.Events(), nil
+}
+
+// Invalidate removes the cached values of a secret
+func (c *SecretStore) Invalidate(location, secretName string) {
+	id := secretID{location: location, secretName: secretName}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	for key, elem := range c.entries {
+		if key.secretID == id {
+			c.lru.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Purge removes every cached value
+func (c *SecretStore) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	c.lru.Init()
+	c.entries = map[entryKey]*list.Element{}
+}
+
+// Len returns the number of cached entries, including expired entries which have not yet been evicted
+func (c *SecretStore) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lru.Len()
+}
+
+// load returns the cached entry for key or calls fetch and caches its result
+func (c *SecretStore) load(ctx context.Context, key entryKey, fetch func(ctx context.Context) (*entry, error)) (*entry, error) {
+	if e, ok := c.get(key); ok {
+		return e, e.err
+	}
+	if !c.options.singleflightEnabled() {
+		return c.fetch(ctx, key, fetch)
+	}
+
+	// the shared call must not fail for every caller when the caller which started it gives up, each caller waits
+	// for the result until its own context is done
+	ch := c.group.DoChan(key.String(), func() (interface{}, error) {
+		return c.fetch(context.WithoutCancel(ctx), key, fetch)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*entry), nil
+	}
+}
+
+func (c *SecretStore) fetch(ctx context.Context, key entryKey, fetch func(ctx context.Context) (*entry, error)) (*entry, error) {
+	c.lock.Lock()
+	generation := c.generation
+	c.lock.Unlock()
+
+	e, err := fetch(ctx)
+	e.key = key
+	e.err = err
+	ttl := c.options.ttl()
+	if err != nil {
+		if !errors.Is(err, secretstore.ErrSecretNotFound) && !errors.Is(err, secretstore.ErrKeyNotFound) {
+			return nil, err
+		}
+		ttl = c.options.negativeTTL()
+	}
+	if ttl > 0 {
+		e.expires = c.now().Add(ttl)
+		c.put(e, generation)
+	}
+	return e, err
+}
+
+func (c *SecretStore) get(key entryKey) (*entry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	if !c.now().Before(e.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return e, true
+}
+
+// put caches e unless the cache was invalidated since generation
+func (c *SecretStore) put(e *entry, generation uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if elem, ok := c.entries[e.key]; ok {
+		c.lru.Remove(elem)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.options.maxEntries() {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+}
+
+func (k entryKey) String() string {
+	if k.whole {
+		return k.location + "\x00" + k.secretName
+	}
+	return k.location + "\x00" + k.secretName + "\x00" + k.secretKey + "\x00key"
+}
+
+// Middleware returns a secretstore.Middleware caching the values read from the secret manager it decorates
+func Middleware(options *Options) secretstore.Middleware {
+	return func(next secretstore.Interface) secretstore.Interface {
+		return NewSecretStore(next, options).Manager()
+	}
+}
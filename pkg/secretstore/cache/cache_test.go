@@ -0,0 +1,184 @@
+//go:build unit
+// +build unit
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore counts the reads made from the underlying secret store
+type countingStore struct {
+	secretstore.Interface
+	gets  int32
+	delay time.Duration
+}
+
+func (c *countingStore) GetSecretWithContext(ctx context.Context, location, secretName, secretKey string) (string, error) {
+	atomic.AddInt32(&c.gets, 1)
+	time.Sleep(c.delay)
+	return c.Interface.GetSecretWithContext(ctx, location, secretName, secretKey)
+}
+
+func (c *countingStore) GetSecretValue(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	atomic.AddInt32(&c.gets, 1)
+	return c.Interface.GetSecretValue(ctx, location, secretName)
+}
+
+func newTestStore(t *testing.T, options *Options) (*SecretStore, *countingStore, *time.Time) {
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "pwd"}}))
+	counting := &countingStore{Interface: store}
+	c := NewSecretStore(counting, options)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, counting, &now
+}
+
+func TestCacheExpiresAfterTTL(t *testing.T) {
+	c, counting, now := newTestStore(t, &Options{TTL: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		value, err := c.GetSecret("loc", "db", "password")
+		require.NoError(t, err)
+		assert.Equal(t, "pwd", value)
+	}
+	assert.EqualValues(t, 1, counting.gets)
+
+	*now = now.Add(time.Minute)
+	_, err := c.GetSecret("loc", "db", "password")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, counting.gets)
+}
+
+func TestCacheInvalidatedBySetAndDelete(t *testing.T) {
+	c, counting, _ := newTestStore(t, nil)
+	ctx := context.Background()
+
+	secret, err := c.GetSecretValue(ctx, "loc", "db")
+	require.NoError(t, err)
+	secret.PropertyValues["password"] = "modified"
+	secret, err = c.GetSecretValue(ctx, "loc", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "pwd", secret.PropertyValues["password"], "callers must not be able to modify cached values")
+
+	require.NoError(t, c.SetSecret("loc", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "new"}}))
+	value, err := c.GetSecret("loc", "db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "new", value)
+
+	require.NoError(t, c.DeleteSecret(ctx, "loc", "db", nil))
+	_, err = c.GetSecret("loc", "db", "password")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+	assert.EqualValues(t, 3, counting.gets)
+}
+
+func TestCacheNegativeCaching(t *testing.T) {
+	c, counting, now := newTestStore(t, &Options{NegativeTTL: 10 * time.Second})
+
+	for i := 0; i < 2; i++ {
+		_, err := c.GetSecret("loc", "missing", "")
+		assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+		_, err = c.GetSecret("loc", "db", "missing")
+		assert.ErrorIs(t, err, secretstore.ErrKeyNotFound)
+	}
+	assert.EqualValues(t, 2, counting.gets)
+
+	*now = now.Add(10 * time.Second)
+	_, err := c.GetSecret("loc", "missing", "")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+	assert.EqualValues(t, 3, counting.gets)
+}
+
+func TestCacheWithoutNegativeCaching(t *testing.T) {
+	c, counting, _ := newTestStore(t, nil)
+
+	for i := 0; i < 2; i++ {
+		_, err := c.GetSecret("loc", "missing", "")
+		assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+	}
+	assert.EqualValues(t, 2, counting.gets)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c, counting, _ := newTestStore(t, &Options{MaxEntries: 2, NegativeTTL: time.Minute})
+
+	_, _ = c.GetSecret("loc", "a", "")
+	_, _ = c.GetSecret("loc", "b", "")
+	_, _ = c.GetSecret("loc", "a", "")
+	_, _ = c.GetSecret("loc", "c", "")
+	assert.Equal(t, 2, c.Len())
+	assert.EqualValues(t, 3, counting.gets)
+
+	// b was evicted as it was the least recently used
+	_, _ = c.GetSecret("loc", "a", "")
+	assert.EqualValues(t, 3, counting.gets)
+	_, _ = c.GetSecret("loc", "b", "")
+	assert.EqualValues(t, 4, counting.gets)
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	c, counting, _ := newTestStore(t, &Options{Singleflight: true})
+	counting.delay = 20 * time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := c.GetSecret("loc", "db", "password")
+			assert.NoError(t, err)
+			assert.Equal(t, "pwd", value)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, counting.gets)
+}
+
+func TestCacheInvalidatedByWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{Value: "pwd"}))
+	c := NewSecretStore(store, nil)
+	watcher, err := secretstore.AsWatchInterface(c.Manager())
+	require.NoError(t, err)
+	events, err := watcher.Watch(ctx, "loc", "db", nil)
+	require.NoError(t, err)
+	assert.Equal(t, secretstore.WatchEventAdded, (<-events).Type)
+
+	value, err := c.GetSecret("loc", "db", "")
+	require.NoError(t, err)
+	assert.Equal(t, "pwd", value)
+	// changed behind the back of the cache
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{Value: "new"}))
+	assert.Equal(t, secretstore.WatchEventModified, (<-events).Type)
+
+	value, err = c.GetSecret("loc", "db", "")
+	require.NoError(t, err)
+	assert.Equal(t, "new", value)
+}
+
+func TestMiddlewareKeepsOptionalInterfaces(t *testing.T) {
+	mgr := Middleware(nil)(fake.NewFakeSecretStore())
+	_, err := secretstore.AsWatchInterface(mgr)
+	assert.NoError(t, err)
+	_, err = secretstore.AsVersionInterface(mgr)
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+
+	mgr = Middleware(nil)(&countingStore{Interface: fake.NewFakeSecretStore()})
+	_, err = secretstore.AsWatchInterface(mgr)
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+	_, err = secretstore.AsVersionInterface(mgr)
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+}
@@ -0,0 +1,122 @@
+package dryrun
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+)
+
+// SecretStore records the changes that would be made to another secret manager instead of making them. Reads are
+// passed through to the secret manager, so they do not see the planned changes
+type SecretStore struct {
+	secretstore.Interface
+
+	lock sync.Mutex
+	plan Plan
+}
+
+// NewSecretStore creates a dry run SecretStore planning the changes to mgr
+func NewSecretStore(mgr secretstore.Interface) *SecretStore {
+	return &SecretStore{Interface: mgr}
+}
+
+// Plan returns a copy of the changes planned so far
+func (d *SecretStore) Plan() *Plan {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return &Plan{Changes: append([]Change{}, d.plan.Changes...)}
+}
+
+func (d *SecretStore) record(change Change) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.plan.Changes = append(d.plan.Changes, change)
+}
+
+// current returns the current value of the secret or nil if it does not exist
+func (d *SecretStore) current(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	current, err := d.Interface.GetSecretValue(ctx, location, secretName)
+	if errors.Is(err, secretstore.ErrSecretNotFound) {
+		return nil, nil
+	}
+	return current, err
+}
+
+func (d *SecretStore) SetSecret(location, secretName string, secretValue *secretstore.SecretValue) error {
+	return d.SetSecretWithContext(context.Background(), location, secretName, secretValue)
+}
+
+func (d *SecretStore) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	current, err := d.current(ctx, location, secretName)
+	if err != nil {
+		return err
+	}
+	if secretValue.CreateOnly && current != nil {
+		return secretstore.NewAlreadyExistsError(location, secretName)
+	}
+	if secretValue.ExpectedVersion != "" && (current == nil || current.Version != secretValue.ExpectedVersion) {
+		return secretstore.NewConflictError(location, secretName)
+	}
+	d.record(diff(location, secretName, current, secretValue))
+	return nil
+}
+
+func (d *SecretStore) DeleteSecret(ctx context.Context, location, secretName string, _ *secretstore.DeleteOptions) error {
+	current, err := d.current(ctx, location, secretName)
+	if err != nil {
+		return err
+	}
+	change := Change{Action: ActionNoChange, Location: location, SecretName: secretName}
+	if current != nil {
+		change.Action = ActionDelete
+		for k := range current.PropertyValues {
+			change.RemovedKeys = append(change.RemovedKeys, k)
+		}
+		sort.Strings(change.RemovedKeys)
+	}
+	d.record(change)
+	return nil
+}
+
+func (d *SecretStore) ListSecretVersions(ctx context.Context, location, secretName string) ([]secretstore.SecretVersion, error) {
+	versioned, err := secretstore.AsVersionInterface(d.Interface)
+	if err != nil {
+		return nil, err
+	}
+	return versioned.ListSecretVersions(ctx, location, secretName)
+}
+
+func (d *SecretStore) GetSecretVersion(ctx context.Context, location, secretName, version string) (*secretstore.SecretValue, error) {
+	versioned, err := secretstore.AsVersionInterface(d.Interface)
+	if err != nil {
+		return nil, err
+	}
+	return versioned.GetSecretVersion(ctx, location, secretName, version)
+}
+
+func (d *SecretStore) DisableSecretVersion(_ context.Context, location, secretName, version string) error {
+	if _, err := secretstore.AsVersionInterface(d.Interface); err != nil {
+		return err
+	}
+	d.record(Change{Action: ActionDisableVersion, Location: location, SecretName: secretName, Version: version})
+	return nil
+}
+
+func (d *SecretStore) DestroySecretVersion(_ context.Context, location, secretName, version string) error {
+	if _, err := secretstore.AsVersionInterface(d.Interface); err != nil {
+		return err
+	}
+	d.record(Change{Action: ActionDestroyVersion, Location: location, SecretName: secretName, Version: version})
+	return nil
+}
+
+func (d *SecretStore) Watch(ctx context.Context, location, secretName string, options *secretstore.WatchOptions) (<-chan secretstore.WatchEvent, error) {
+	watcher, err := secretstore.AsWatchInterface(d.Interface)
+	if err != nil {
+		return nil, err
+	}
+	return watcher.Watch(ctx, location, secretName, options)
+}
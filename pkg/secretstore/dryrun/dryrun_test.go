@@ -0,0 +1,128 @@
+//go:build unit
+// +build unit
+
+package dryrun_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/dryrun"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin", "password": "old-password", "host": "db"},
+		Labels:         map[string]string{"env": "dev", "team": "a"},
+		Annotations:    map[string]string{"owner": "dba"},
+	}))
+	require.NoError(t, store.SetSecret("loc", "same", &secretstore.SecretValue{PropertyValues: map[string]string{"k": "v"}}))
+	require.NoError(t, store.SetSecret("loc", "old", &secretstore.SecretValue{PropertyValues: map[string]string{"k": "v"}}))
+	d := dryrun.NewSecretStore(store)
+	ctx := context.Background()
+
+	require.NoError(t, d.SetSecret("loc", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin", "password": "new-password", "port": "5432"},
+		Labels:         map[string]string{"env": "prod", "team": "a"},
+		Annotations:    map[string]string{"owner": "platform", "rotated": "true"},
+		Overwrite:      true,
+	}))
+	require.NoError(t, d.SetSecret("loc", "same", &secretstore.SecretValue{PropertyValues: map[string]string{"k": "v"}}))
+	require.NoError(t, d.SetSecret("loc", "new", &secretstore.SecretValue{Value: "token-value"}))
+	require.NoError(t, d.DeleteSecret(ctx, "loc", "old", nil))
+
+	value, err := store.GetSecret("loc", "db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "old-password", value, "the secret store must not be modified")
+	_, err = store.GetSecret("loc", "new", "")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+
+	plan := d.Plan()
+	assert.True(t, plan.HasChanges())
+	assert.Equal(t, `~ update loc/db
+    + key port
+    ~ key password
+    - key host
+    ~ label env: dev -> prod
+    + annotation rotated=true
+    ~ annotation owner: dba -> platform
+= no changes to loc/same
++ create loc/new
+    ~ value
+- delete loc/old
+    - key k
+Plan: 1 to create, 1 to update, 1 to delete, 1 unchanged.
+`, plan.Text())
+
+	data, err := plan.JSON()
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "new-password")
+	assert.NotContains(t, string(data), "token-value")
+	parsed := dryrun.Plan{}
+	require.NoError(t, json.Unmarshal(data, &parsed))
+	assert.Equal(t, plan, &parsed)
+}
+
+func TestPlanMergesWithoutOverwrite(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"a": "1", "b": "2"}}))
+	d := dryrun.NewSecretStore(store)
+
+	require.NoError(t, d.SetSecret("loc", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"b": "2"}}))
+
+	plan := d.Plan()
+	assert.False(t, plan.HasChanges())
+	assert.Equal(t, dryrun.ActionNoChange, plan.Changes[0].Action)
+}
+
+func TestPlanExpectedVersion(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"a": "1"}}))
+	d := dryrun.NewSecretStore(store)
+
+	err := d.SetSecret("loc", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"a": "2"}, ExpectedVersion: "2"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	err = d.SetSecret("loc", "missing", &secretstore.SecretValue{PropertyValues: map[string]string{"a": "2"}, ExpectedVersion: "1"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	require.NoError(t, d.SetSecret("loc", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"a": "2"}, ExpectedVersion: "1"}))
+
+	plan := d.Plan()
+	require.Len(t, plan.Changes, 1)
+	assert.Equal(t, []string{"a"}, plan.Changes[0].ChangedKeys)
+}
+
+func TestPlanAnnotationsWithoutOverwrite(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"a": "1"},
+		Annotations:    map[string]string{"owner": "dba"},
+	}))
+	d := dryrun.NewSecretStore(store)
+
+	require.NoError(t, d.SetSecret("loc", "db", &secretstore.SecretValue{Annotations: map[string]string{"owner": "dba"}}))
+	require.NoError(t, d.SetSecret("loc", "db", &secretstore.SecretValue{Annotations: map[string]string{"rotated": "true"}}))
+
+	plan := d.Plan()
+	assert.Equal(t, dryrun.ActionNoChange, plan.Changes[0].Action)
+	assert.Equal(t, dryrun.ActionUpdate, plan.Changes[1].Action)
+	assert.Equal(t, []dryrun.LabelChange{{Key: "rotated", New: "true"}}, plan.Changes[1].Annotations)
+}
+
+func TestPlanValueReplacesProperties(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"a": "1", "b": "2"}}))
+	d := dryrun.NewSecretStore(store)
+
+	require.NoError(t, d.SetSecret("loc", "db", &secretstore.SecretValue{Value: "token"}))
+
+	change := d.Plan().Changes[0]
+	assert.Equal(t, dryrun.ActionUpdate, change.Action)
+	assert.True(t, change.ValueChanged)
+	assert.Equal(t, []string{"a", "b"}, change.RemovedKeys)
+}
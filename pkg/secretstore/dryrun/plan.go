@@ -0,0 +1,193 @@
+package dryrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+)
+
+// Action is the kind of change planned for a secret
+type Action string
+
+const (
+	ActionCreate         Action = "create"
+	ActionUpdate         Action = "update"
+	ActionDelete         Action = "delete"
+	ActionNoChange       Action = "no-change"
+	ActionDisableVersion Action = "disable-version"
+	ActionDestroyVersion Action = "destroy-version"
+)
+
+// LabelChange is a change to a label or annotation of a secret. Labels and annotations are not secret so their values
+// are included
+type LabelChange struct {
+	Key string `json:"key"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// Change is a planned change to a secret. It is redacted, only the names of the keys which change are included
+type Change struct {
+	Action     Action `json:"action"`
+	Location   string `json:"location"`
+	SecretName string `json:"secretName"`
+	// Version is set for the version actions
+	Version     string   `json:"version,omitempty"`
+	AddedKeys   []string `json:"addedKeys,omitempty"`
+	ChangedKeys []string `json:"changedKeys,omitempty"`
+	RemovedKeys []string `json:"removedKeys,omitempty"`
+	// ValueChanged is set when the plain Value of the secret, rather than a key, changes
+	ValueChanged bool          `json:"valueChanged,omitempty"`
+	Labels       []LabelChange `json:"labels,omitempty"`
+	Annotations  []LabelChange `json:"annotations,omitempty"`
+}
+
+// Plan lists the changes a dry run would have made in the order they were requested
+type Plan struct {
+	Changes []Change `json:"changes"`
+}
+
+// HasChanges returns true if any change other than ActionNoChange is planned
+func (p *Plan) HasChanges() bool {
+	for i := range p.Changes {
+		if p.Changes[i].Action != ActionNoChange {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON renders the plan as indented JSON
+func (p *Plan) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal plan: %w", err)
+	}
+	return data, nil
+}
+
+// Text renders the plan for people to review
+func (p *Plan) Text() string {
+	var sb strings.Builder
+	counts := map[Action]int{}
+	for i := range p.Changes {
+		c := &p.Changes[i]
+		counts[c.Action]++
+		switch c.Action {
+		case ActionCreate:
+			fmt.Fprintf(&sb, "+ create %s/%s\n", c.Location, c.SecretName)
+		case ActionUpdate:
+			fmt.Fprintf(&sb, "~ update %s/%s\n", c.Location, c.SecretName)
+		case ActionDelete:
+			fmt.Fprintf(&sb, "- delete %s/%s\n", c.Location, c.SecretName)
+		case ActionNoChange:
+			fmt.Fprintf(&sb, "= no changes to %s/%s\n", c.Location, c.SecretName)
+		default:
+			fmt.Fprintf(&sb, "! %s %s of %s/%s\n", c.Action, c.Version, c.Location, c.SecretName)
+		}
+		if c.ValueChanged {
+			sb.WriteString("    ~ value\n")
+		}
+		for _, k := range c.AddedKeys {
+			fmt.Fprintf(&sb, "    + key %s\n", k)
+		}
+		for _, k := range c.ChangedKeys {
+			fmt.Fprintf(&sb, "    ~ key %s\n", k)
+		}
+		for _, k := range c.RemovedKeys {
+			fmt.Fprintf(&sb, "    - key %s\n", k)
+		}
+		writeLabelChanges(&sb, "label", c.Labels)
+		writeLabelChanges(&sb, "annotation", c.Annotations)
+	}
+	fmt.Fprintf(&sb, "Plan: %d to create, %d to update, %d to delete, %d unchanged",
+		counts[ActionCreate], counts[ActionUpdate], counts[ActionDelete], counts[ActionNoChange])
+	if versions := counts[ActionDisableVersion] + counts[ActionDestroyVersion]; versions > 0 {
+		fmt.Fprintf(&sb, ", %d version changes", versions)
+	}
+	sb.WriteString(".\n")
+	return sb.String()
+}
+
+func writeLabelChanges(sb *strings.Builder, kind string, changes []LabelChange) {
+	for _, l := range changes {
+		switch {
+		case l.Old == "":
+			fmt.Fprintf(sb, "    + %s %s=%s\n", kind, l.Key, l.New)
+		case l.New == "":
+			fmt.Fprintf(sb, "    - %s %s=%s\n", kind, l.Key, l.Old)
+		default:
+			fmt.Fprintf(sb, "    ~ %s %s: %s -> %s\n", kind, l.Key, l.Old, l.New)
+		}
+	}
+}
+
+// diff returns the change setting desired would make to current, which is nil if the secret does not exist. Property
+// values, labels and annotations are merged in to the current secret, unless desired.Overwrite is set in which case those missing
+// from desired are removed. A plain Value replaces all the properties of the current secret
+func diff(location, secretName string, current, desired *secretstore.SecretValue) Change {
+	change := Change{Action: ActionUpdate, Location: location, SecretName: secretName}
+	if current == nil {
+		change.Action = ActionCreate
+		current = &secretstore.SecretValue{}
+	}
+	change.ValueChanged = desired.Value != "" && desired.Value != current.Value
+
+	if desired.Value == "" {
+		change.AddedKeys, change.ChangedKeys, change.RemovedKeys = diffMaps(current.PropertyValues, desired.PropertyValues, desired.Overwrite)
+	} else {
+		_, _, change.RemovedKeys = diffMaps(current.PropertyValues, nil, true)
+	}
+	change.Labels = diffLabels(current.Labels, desired.Labels, desired.Overwrite)
+	change.Annotations = diffLabels(current.Annotations, desired.Annotations, desired.Overwrite)
+
+	if change.Action == ActionUpdate && !change.ValueChanged && len(change.AddedKeys)+len(change.ChangedKeys)+
+		len(change.RemovedKeys)+len(change.Labels)+len(change.Annotations) == 0 {
+		change.Action = ActionNoChange
+	}
+	return change
+}
+
+// diffLabels returns the changes applying the desired labels or annotations to the current ones makes
+func diffLabels(current, desired map[string]string, overwrite bool) []LabelChange {
+	var changes []LabelChange
+	added, changed, removed := diffMaps(current, desired, overwrite)
+	for _, k := range added {
+		changes = append(changes, LabelChange{Key: k, New: desired[k]})
+	}
+	for _, k := range changed {
+		changes = append(changes, LabelChange{Key: k, Old: current[k], New: desired[k]})
+	}
+	for _, k := range removed {
+		changes = append(changes, LabelChange{Key: k, Old: current[k]})
+	}
+	return changes
+}
+
+// diffMaps returns the sorted keys added, changed and removed by applying desired to current. Keys are only removed
+// when overwriting
+func diffMaps(current, desired map[string]string, overwrite bool) (added, changed, removed []string) {
+	for k, v := range desired {
+		old, ok := current[k]
+		switch {
+		case !ok:
+			added = append(added, k)
+		case old != v:
+			changed = append(changed, k)
+		}
+	}
+	if overwrite {
+		for k := range current {
+			if _, ok := desired[k]; !ok {
+				removed = append(removed, k)
+			}
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return added, changed, removed
+}
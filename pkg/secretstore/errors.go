@@ -0,0 +1,108 @@
+package secretstore
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrSecretNotFound is returned when the secret does not exist in the location
+	ErrSecretNotFound = errors.New("secret not found")
+	// ErrKeyNotFound is returned when the secret exists but does not contain the requested key
+	ErrKeyNotFound = errors.New("secret key not found")
+	// ErrPermissionDenied is returned when the caller is not authenticated or authorised for the operation
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrAlreadyExists is returned when creating a secret which already exists
+	ErrAlreadyExists = errors.New("secret already exists")
+	// ErrTransient is returned for errors which may succeed if retried, such as throttling or unavailability
+	ErrTransient = errors.New("transient secret store error")
+	// ErrNotSupported is returned when the secret store does not support an operation
+	ErrNotSupported = errors.New("operation not supported by secret store")
+	// ErrConflict is returned when a secret was changed since it was read, i.e. SecretValue.ExpectedVersion does not
+	// match the current version of the secret
+	ErrConflict = errors.New("secret was modified concurrently")
+	// ErrReadOnly is returned when writing through a secret manager which only allows reads
+	ErrReadOnly = errors.New("secret store is read only")
+)
+
+// Error classifies an error returned by a secret store as one of the Err* sentinel errors so callers can use
+// errors.Is(err, secretstore.ErrSecretNotFound) regardless of the backend, or errors.As to get the details
+type Error struct {
+	// Kind is one of the Err* sentinel errors
+	Kind       error
+	Location   string
+	SecretName string
+	SecretKey  string
+	// Err is the underlying error from the secret store, nil if the error was detected by the secret manager itself
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+	}
+	if e.SecretKey != "" {
+		return fmt.Sprintf("%s: key %s in secret %s at location %s", e.Kind, e.SecretKey, e.SecretName, e.Location)
+	}
+	return fmt.Sprintf("%s: secret %s at location %s", e.Kind, e.SecretName, e.Location)
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// NewError classifies err as kind. If kind is nil err is returned unchanged so backends can pass the result of their
+// classification straight through
+func NewError(kind error, location, secretName string, err error) error {
+	if kind == nil {
+		return err
+	}
+	return &Error{Kind: kind, Location: location, SecretName: secretName, Err: err}
+}
+
+// NewSecretNotFoundError is returned when the secret store reports success but no secret
+func NewSecretNotFoundError(location, secretName string) error {
+	return &Error{Kind: ErrSecretNotFound, Location: location, SecretName: secretName}
+}
+
+// NewKeyNotFoundError is returned when a secret does not contain the requested key
+func NewKeyNotFoundError(location, secretName, secretKey string) error {
+	return &Error{Kind: ErrKeyNotFound, Location: location, SecretName: secretName, SecretKey: secretKey}
+}
+
+// NewConflictError is returned when a secret is not written because its current version does not match the expected
+// version
+func NewConflictError(location, secretName string) error {
+	return &Error{Kind: ErrConflict, Location: location, SecretName: secretName}
+}
+
+// NewAlreadyExistsError is returned when a secret is not created because it already exists
+func NewAlreadyExistsError(location, secretName string) error {
+	return &Error{Kind: ErrAlreadyExists, Location: location, SecretName: secretName}
+}
+
+// ErrorKindFromHTTPStatus maps the status code of a failed HTTP call to the matching Err* sentinel error or nil if the
+// status code does not map to one
+func ErrorKindFromHTTPStatus(statusCode int) error {
+	switch statusCode {
+	case http.StatusNotFound:
+		return ErrSecretNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrPermissionDenied
+	case http.StatusConflict:
+		return ErrAlreadyExists
+	case http.StatusTooManyRequests, http.StatusRequestTimeout, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrTransient
+	}
+	return nil
+}
+
+// IsTransient returns true if err may succeed if retried
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrTransient)
+}
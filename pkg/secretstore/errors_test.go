@@ -0,0 +1,55 @@
+//go:build unit
+// +build unit
+
+package secretstore_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorMatchesKindAndCause(t *testing.T) {
+	cause := fmt.Errorf("rpc error: code = NotFound")
+	err := fmt.Errorf("error getting secret: %w", secretstore.NewError(secretstore.ErrSecretNotFound, "my-project", "db", cause))
+
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+	assert.ErrorIs(t, err, cause)
+	assert.False(t, errors.Is(err, secretstore.ErrPermissionDenied))
+
+	var storeErr *secretstore.Error
+	assert.True(t, errors.As(err, &storeErr))
+	assert.Equal(t, "my-project", storeErr.Location)
+	assert.Equal(t, "db", storeErr.SecretName)
+}
+
+func TestNewErrorWithoutKindReturnsCause(t *testing.T) {
+	cause := fmt.Errorf("boom")
+	assert.Equal(t, cause, secretstore.NewError(nil, "loc", "name", cause))
+}
+
+func TestKeyNotFoundError(t *testing.T) {
+	err := secretstore.NewKeyNotFoundError("ns", "db", "password")
+
+	assert.ErrorIs(t, err, secretstore.ErrKeyNotFound)
+	assert.EqualError(t, err, "secret key not found: key password in secret db at location ns")
+}
+
+func TestErrorKindFromHTTPStatus(t *testing.T) {
+	testCases := map[int]error{
+		http.StatusNotFound:           secretstore.ErrSecretNotFound,
+		http.StatusForbidden:          secretstore.ErrPermissionDenied,
+		http.StatusUnauthorized:       secretstore.ErrPermissionDenied,
+		http.StatusConflict:           secretstore.ErrAlreadyExists,
+		http.StatusTooManyRequests:    secretstore.ErrTransient,
+		http.StatusServiceUnavailable: secretstore.ErrTransient,
+		http.StatusBadRequest:         nil,
+	}
+	for statusCode, expected := range testCases {
+		assert.Equal(t, expected, secretstore.ErrorKindFromHTTPStatus(statusCode), "status code %d", statusCode)
+	}
+}
@@ -3,6 +3,7 @@ package factory
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/hashicorp/vault/api"
@@ -10,17 +11,38 @@ import (
 	"github.com/jenkins-x-plugins/secretfacade/pkg/iam/kubernetesiam"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/iam/vaultiam"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/agesecrets"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/awssecretsmanager"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/awssystemmanager"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/azuresecrets"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/gcpsecretsmanager"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/kubernetessecrets"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/sopssecrets"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/vaultsecrets"
 )
 
-type SecretManagerFactory struct{}
+type SecretManagerFactory struct {
+	// Middleware decorates every secret manager created by the factory, see secretstore.Chain
+	Middleware []secretstore.Middleware
+	// StoreMiddleware decorates every secret manager created by the factory with middleware created for its store
+	// type. It is applied inside Middleware so that it sees the calls made to the secret store itself. Tracing and
+	// metrics are only recorded when tracing.Middleware and metrics.Collector.Middleware are added here
+	StoreMiddleware []secretstore.StoreMiddleware
+}
 
 func (smf SecretManagerFactory) NewSecretManager(storeType secretstore.Type) (secretstore.Interface, error) {
+	mgr, err := newSecretManager(storeType)
+	if err != nil {
+		return nil, err
+	}
+	middleware := append([]secretstore.Middleware{}, smf.Middleware...)
+	for _, storeMiddleware := range smf.StoreMiddleware {
+		middleware = append(middleware, storeMiddleware(storeType))
+	}
+	return secretstore.Chain(mgr, middleware...), nil
+}
+
+func newSecretManager(storeType secretstore.Type) (secretstore.Interface, error) {
 	switch storeType {
 	case secretstore.SecretStoreTypeAzure:
 		return azuresecrets.NewAzureKeyVaultSecretManager(), nil
@@ -84,6 +106,26 @@ func (smf SecretManagerFactory) NewSecretManager(storeType secretstore.Type) (se
 			return nil, fmt.Errorf("error getting AWS creds when attempting to create secret manager via factory: %w", err)
 		}
 		return awssystemmanager.NewAwsSystemManager(sess), nil
+	case secretstore.SecretStoreTypeSops:
+		return sopssecrets.NewSopsSecretManager(sopssecrets.Options{Binary: os.Getenv("SOPS_BINARY")}), nil
+	case secretstore.SecretStoreTypeAge:
+		keyFile, err := ageKeyFile()
+		if err != nil {
+			return nil, err
+		}
+		return agesecrets.NewAgeSecretManagerFromKeyFile(keyFile)
 	}
 	return nil, fmt.Errorf("unable to create manager for storeType %s", string(storeType))
 }
+
+// ageKeyFile returns the age key file used by sops, $SOPS_AGE_KEY_FILE or keys.txt in the sops user config directory
+func ageKeyFile() (string, error) {
+	if path := os.Getenv("SOPS_AGE_KEY_FILE"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding the age key file, set SOPS_AGE_KEY_FILE: %w", err)
+	}
+	return filepath.Join(dir, "sops", "age", "keys.txt"), nil
+}
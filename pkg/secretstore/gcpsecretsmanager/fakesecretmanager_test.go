@@ -0,0 +1,175 @@
+//go:build unit
+// +build unit
+
+package gcpsecretsmanager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeSecretManager is a minimal in memory fake of the GCP Secret Manager gRPC API
+type fakeSecretManager struct {
+	secretmanagerpb.UnimplementedSecretManagerServiceServer
+
+	lock     sync.Mutex
+	secrets  map[string]*secretmanagerpb.Secret
+	versions map[string][][]byte
+	etags    int
+	// beforeUpdate is called before each UpdateSecret is applied, as if another writer got in between a read and the
+	// update
+	beforeUpdate func()
+}
+
+func newFakeSecretManager(t *testing.T) (*gcpSecretsManager, *fakeSecretManager) {
+	fake := &fakeSecretManager{secrets: map[string]*secretmanagerpb.Secret{}, versions: map[string][][]byte{}}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	secretmanagerpb.RegisterSecretManagerServiceServer(server, fake)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	client, err := secretmanager.NewClient(context.Background(),
+		option.WithEndpoint(listener.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return &gcpSecretsManager{client: client}, fake
+}
+
+func (f *fakeSecretManager) nextEtag() string {
+	f.etags++
+	return strconv.Itoa(f.etags)
+}
+
+func (f *fakeSecretManager) CreateSecret(_ context.Context, req *secretmanagerpb.CreateSecretRequest) (*secretmanagerpb.Secret, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	name := req.Parent + "/secrets/" + req.SecretId
+	if _, ok := f.secrets[name]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "secret %s already exists", name)
+	}
+	secret := proto.Clone(req.Secret).(*secretmanagerpb.Secret)
+	secret.Name = name
+	secret.Etag = f.nextEtag()
+	f.secrets[name] = secret
+	return proto.Clone(secret).(*secretmanagerpb.Secret), nil
+}
+
+func (f *fakeSecretManager) GetSecret(_ context.Context, req *secretmanagerpb.GetSecretRequest) (*secretmanagerpb.Secret, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	secret, ok := f.secrets[req.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Name)
+	}
+	return proto.Clone(secret).(*secretmanagerpb.Secret), nil
+}
+
+func (f *fakeSecretManager) UpdateSecret(_ context.Context, req *secretmanagerpb.UpdateSecretRequest) (*secretmanagerpb.Secret, error) {
+	if f.beforeUpdate != nil {
+		f.beforeUpdate()
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	secret, ok := f.secrets[req.Secret.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Secret.Name)
+	}
+	if req.Secret.Etag != "" && req.Secret.Etag != secret.Etag {
+		return nil, status.Errorf(codes.Aborted, "etag %s does not match %s", req.Secret.Etag, secret.Etag)
+	}
+	for _, field := range req.UpdateMask.GetPaths() {
+		switch field {
+		case "labels":
+			secret.Labels = req.Secret.Labels
+		case "annotations":
+			secret.Annotations = req.Secret.Annotations
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unexpected update mask path %s", field)
+		}
+	}
+	secret.Etag = f.nextEtag()
+	return proto.Clone(secret).(*secretmanagerpb.Secret), nil
+}
+
+func (f *fakeSecretManager) AddSecretVersion(_ context.Context, req *secretmanagerpb.AddSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.secrets[req.Parent]; !ok {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Parent)
+	}
+	f.versions[req.Parent] = append(f.versions[req.Parent], req.Payload.Data)
+	return &secretmanagerpb.SecretVersion{Name: fmt.Sprintf("%s/versions/%d", req.Parent, len(f.versions[req.Parent]))}, nil
+}
+
+// addVersion adds a version to a secret as another client would
+func (f *fakeSecretManager) addVersion(projectID, secretName, data string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	name := fmt.Sprintf("projects/%s/secrets/%s", projectID, secretName)
+	f.versions[name] = append(f.versions[name], []byte(data))
+}
+
+// version resolves a version name, which may use the latest alias, returning the secret name and version number
+func (f *fakeSecretManager) version(name string) (string, int, error) {
+	secretName, version := path.Dir(path.Dir(name)), path.Base(name)
+	versions := f.versions[secretName]
+	i := len(versions)
+	if version != latestVersion {
+		i, _ = strconv.Atoi(version)
+	}
+	if i < 1 || i > len(versions) {
+		return "", 0, status.Errorf(codes.NotFound, "version %s not found", name)
+	}
+	return secretName, i, nil
+}
+
+func (f *fakeSecretManager) GetSecretVersion(_ context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	secretName, i, err := f.version(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &secretmanagerpb.SecretVersion{Name: fmt.Sprintf("%s/versions/%d", secretName, i)}, nil
+}
+
+func (f *fakeSecretManager) AccessSecretVersion(_ context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !strings.Contains(req.Name, "/versions/") {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid version name %s", req.Name)
+	}
+	secretName, i, err := f.version(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &secretmanagerpb.AccessSecretVersionResponse{
+		Name:    fmt.Sprintf("%s/versions/%d", secretName, i),
+		Payload: &secretmanagerpb.SecretPayload{Data: f.versions[secretName][i-1]},
+	}, nil
+}
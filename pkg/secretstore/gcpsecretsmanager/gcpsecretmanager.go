@@ -3,7 +3,14 @@ package gcpsecretsmanager
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/iam/gcpiam"
@@ -11,43 +18,119 @@ import (
 
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/oauth"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+const (
+	// latestVersion is the alias GCP Secret Manager uses for the most recently added version of a secret
+	latestVersion = "latest"
+
+	// casClaimAnnotation is set on a secret by writes with an expected version. GCP Secret Manager cannot add a version
+	// conditionally so a writer claims the version it replaces by updating the secret with its etag, which fails if
+	// another writer updated the secret first
+	casClaimAnnotation = "secretfacade-cas-claim"
+	// casClaimTimeout is how long a claim is honoured, so a writer which fails after claiming does not block others
+	casClaimTimeout = time.Minute
 )
 
 func NewGcpSecretsManager(creds *google.Credentials) secretstore.Interface {
-	return &gcpSecretsManager{creds}
+	return &gcpSecretsManager{creds: creds}
 }
 
 type gcpSecretsManager struct {
 	creds *google.Credentials
+
+	// client is created on first use and shared by all calls as creating a gRPC connection per call is slow
+	clientLock sync.Mutex
+	client     *secretmanager.Client
+}
+
+// getClient returns the shared client, creating it if needed
+func (g *gcpSecretsManager) getClient(ctx context.Context) (*secretmanager.Client, error) {
+	g.clientLock.Lock()
+	defer g.clientLock.Unlock()
+	if g.client != nil {
+		return g.client, nil
+	}
+	client, err := getSecretOpsClient(ctx, g.creds)
+	if err != nil {
+		return nil, err
+	}
+	g.client = client
+	return client, nil
+}
+
+// Close closes the connection to GCP Secret Manager, the next call will open a new connection
+func (g *gcpSecretsManager) Close() error {
+	g.clientLock.Lock()
+	defer g.clientLock.Unlock()
+	if g.client == nil {
+		return nil
+	}
+	err := g.client.Close()
+	g.client = nil
+	return err
 }
 
 func (g *gcpSecretsManager) SetSecret(projectID, secretName string, secretValue *secretstore.SecretValue) error {
+	return g.SetSecretWithContext(context.Background(), projectID, secretName, secretValue)
+}
 
-	client, closer, err := getSecretOpsClient()
+// SetSecretWithContext adds a new version to the secret, creating the secret if needed. A write with an expected
+// version is best effort: it fails with a conflict if the latest version is not the expected version or another write
+// with the same expected version is in progress, but writes without an expected version are not detected. A create
+// only write fails if the secret exists, even if it has no versions yet
+func (g *gcpSecretsManager) SetSecretWithContext(ctx context.Context, projectID, secretName string, secretValue *secretstore.SecretValue) error {
+	client, err := g.getClient(ctx)
 	if err != nil {
 		return fmt.Errorf("error setting GCP Secrets Manager secret %s in project %s: %w", secretName, projectID, err)
 	}
-	defer closer()
 
 	var existingSecretProps map[string]string
-	secret, err := getSecret(client, projectID, secretName)
+	secret, err := getSecret(ctx, client, projectID, secretName)
 	if err != nil {
-		secret, err = createSecret(client, projectID, secretName)
+		if !errors.Is(err, secretstore.ErrSecretNotFound) {
+			return fmt.Errorf("error getting secret %s in GCP secret manager project %s prior to setting: %w", secretName, projectID, err)
+		}
+		if secretValue.ExpectedVersion != "" {
+			return fmt.Errorf("unable to set secret %s in GCP secret manager project %s: %w", secretName, projectID,
+				secretstore.NewConflictError(projectID, secretName))
+		}
+		secret, err = createSecret(ctx, client, projectID, secretName, secretValue.Labels, secretValue.Annotations)
 		if err != nil {
 			return fmt.Errorf("error creating new secret %s in GCP secret manager project %s: %w", secretName, projectID, err)
 		}
-	} else if secretValue.Value == "" && secretValue.PropertyValues != nil {
-		sv, err := getSecretValue(client, projectID, secretName)
-		if err != nil {
-			return fmt.Errorf("error getting GCP secrets manager secret value for secret name %s in project %s: %w", secretName, projectID, err)
+	} else {
+		if secretValue.CreateOnly {
+			return fmt.Errorf("unable to create secret %s in GCP secret manager project %s: %w", secretName, projectID,
+				secretstore.NewAlreadyExistsError(projectID, secretName))
+		}
+		if secretValue.ExpectedVersion != "" {
+			secret, err = claimSecretVersion(ctx, client, projectID, secretName, secret, secretValue.ExpectedVersion)
+			if err != nil {
+				return fmt.Errorf("unable to set secret %s in GCP secret manager project %s: %w", secretName, projectID, err)
+			}
 		}
-		existingSecretProps, err = getSecretPropertyMap(sv)
+		err = updateSecretMetadata(ctx, client, projectID, secretName, secret, secretValue)
 		if err != nil {
-			return fmt.Errorf("error getting secret property map: %w", err)
+			return fmt.Errorf("unable to set labels and annotations of secret %s in GCP secret manager project %s: %w", secretName, projectID, err)
+		}
+		if secretValue.Value == "" && secretValue.PropertyValues != nil && !secretValue.Overwrite {
+			sv, err := getSecretValue(ctx, client, projectID, secretName)
+			if err != nil {
+				return fmt.Errorf("error getting GCP secrets manager secret value for secret name %s in project %s: %w", secretName, projectID, err)
+			}
+			existingSecretProps, err = getSecretPropertyMap(sv)
+			if err != nil {
+				return fmt.Errorf("error getting secret property map: %w", err)
+			}
 		}
 	}
 
@@ -57,21 +140,24 @@ func (g *gcpSecretsManager) SetSecret(projectID, secretName string, secretValue
 			Data: []byte(secretValue.MergeExistingSecret(existingSecretProps)),
 		},
 	}
-	_, err = client.AddSecretVersion(context.TODO(), req)
+	_, err = client.AddSecretVersion(ctx, req)
 	if err != nil {
-		return fmt.Errorf("unable to set secret %s in GCP secret manager project %s: %w", secretName, projectID, err)
+		return fmt.Errorf("unable to set secret %s in GCP secret manager project %s: %w", secretName, projectID, classifyError(projectID, secretName, err))
 	}
 	return nil
 }
 
 func (g *gcpSecretsManager) GetSecret(projectID, secretName, secretKey string) (string, error) {
-	client, closer, err := getSecretOpsClient()
+	return g.GetSecretWithContext(context.Background(), projectID, secretName, secretKey)
+}
+
+func (g *gcpSecretsManager) GetSecretWithContext(ctx context.Context, projectID, secretName, secretKey string) (string, error) {
+	client, err := g.getClient(ctx)
 	if err != nil {
 		return "", fmt.Errorf("error creating GCP secret manager client: %w", err)
 	}
-	defer closer()
 
-	secret, err := getSecretValue(client, projectID, secretName)
+	secret, err := getSecretValue(ctx, client, projectID, secretName)
 	if err != nil {
 		return "", fmt.Errorf("error getting secret %s for GCP secret manager in project %s: %w", secretName, projectID, err)
 	}
@@ -87,6 +173,287 @@ func (g *gcpSecretsManager) GetSecret(projectID, secretName, secretKey string) (
 	return secretString, nil
 }
 
+func (g *gcpSecretsManager) GetSecretValue(ctx context.Context, projectID, secretName string) (*secretstore.SecretValue, error) {
+	client, err := g.getClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCP secret manager client: %w", err)
+	}
+
+	secret, err := getSecret(ctx, client, projectID, secretName)
+	if err != nil {
+		return nil, err
+	}
+	version, err := accessSecretVersion(ctx, client, projectID, secretName, latestVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error getting secret %s for GCP secret manager in project %s: %w", secretName, projectID, err)
+	}
+	secretValue := secretstore.NewSecretValueFromString(string(version.Payload.Data))
+	secretValue.Labels = secret.Labels
+	secretValue.Annotations = secret.Annotations
+	if _, ok := secret.Annotations[casClaimAnnotation]; ok {
+		secretValue.Annotations = make(map[string]string, len(secret.Annotations))
+		for k, v := range secret.Annotations {
+			if k != casClaimAnnotation {
+				secretValue.Annotations[k] = v
+			}
+		}
+	}
+	secretValue.Version = path.Base(version.Name)
+	return secretValue, nil
+}
+
+// claimSecretVersion checks the latest version of the secret is expectedVersion and claims it by updating the
+// annotations of the secret conditionally on its etag, so only one writer can replace each version. It returns the
+// updated secret
+func claimSecretVersion(ctx context.Context, client *secretmanager.Client, projectID, secretName string, secret *secretmanagerpb.Secret, expectedVersion string) (*secretmanagerpb.Secret, error) {
+	latest, err := client.GetSecretVersion(ctx, &secretmanagerpb.GetSecretVersionRequest{
+		Name: versionName(projectID, secretName, latestVersion),
+	})
+	if err != nil {
+		return nil, classifyError(projectID, secretName, err)
+	}
+	if path.Base(latest.Name) != expectedVersion || isClaimed(secret.Annotations[casClaimAnnotation], expectedVersion, time.Now()) {
+		return nil, secretstore.NewConflictError(projectID, secretName)
+	}
+
+	annotations := make(map[string]string, len(secret.Annotations)+1)
+	for k, v := range secret.Annotations {
+		annotations[k] = v
+	}
+	annotations[casClaimAnnotation] = fmt.Sprintf("%s@%d", expectedVersion, time.Now().Unix())
+	claimed, err := client.UpdateSecret(ctx, &secretmanagerpb.UpdateSecretRequest{
+		Secret: &secretmanagerpb.Secret{
+			Name:        secret.Name,
+			Etag:        secret.Etag,
+			Annotations: annotations,
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"annotations"}},
+	})
+	if err != nil {
+		// the etag no longer matches so another writer updated the secret since it was read
+		if code := status.Code(err); code == codes.FailedPrecondition || code == codes.Aborted {
+			return nil, secretstore.NewError(secretstore.ErrConflict, projectID, secretName, err)
+		}
+		return nil, classifyError(projectID, secretName, err)
+	}
+	return claimed, nil
+}
+
+// updateSecretMetadata merges the labels and annotations of the secret value in to those of the secret, or replaces
+// them if the secret value is set to overwrite, updating the secret if they changed. A pending claim of the secret is
+// kept
+func updateSecretMetadata(ctx context.Context, client *secretmanager.Client, projectID, secretName string, secret *secretmanagerpb.Secret, secretValue *secretstore.SecretValue) error {
+	labels := mergeMetadata(secret.Labels, secretValue.Labels)
+	annotations := mergeMetadata(secret.Annotations, secretValue.Annotations)
+	if secretValue.Overwrite {
+		labels = secretValue.Labels
+		annotations = mergeMetadata(nil, secretValue.Annotations)
+		if claim, ok := secret.Annotations[casClaimAnnotation]; ok {
+			annotations = mergeMetadata(annotations, map[string]string{casClaimAnnotation: claim})
+		}
+	}
+	if maps.Equal(labels, secret.Labels) && maps.Equal(annotations, secret.Annotations) {
+		return nil
+	}
+	_, err := client.UpdateSecret(ctx, &secretmanagerpb.UpdateSecretRequest{
+		Secret: &secretmanagerpb.Secret{
+			Name:        secret.Name,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"labels", "annotations"}},
+	})
+	if err != nil {
+		return classifyError(projectID, secretName, err)
+	}
+	return nil
+}
+
+func mergeMetadata(existing, values map[string]string) map[string]string {
+	if len(values) == 0 {
+		return existing
+	}
+	merged := make(map[string]string, len(existing)+len(values))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	return merged
+}
+
+// isClaimed returns true if claim, the value of the casClaimAnnotation, is a claim on version which has not timed out
+func isClaimed(claim, version string, now time.Time) bool {
+	claimedVersion, claimedAt, ok := strings.Cut(claim, "@")
+	if !ok || claimedVersion != version {
+		return false
+	}
+	unix, err := strconv.ParseInt(claimedAt, 10, 64)
+	if err != nil {
+		return false
+	}
+	return now.Sub(time.Unix(unix, 0)) < casClaimTimeout
+}
+
+func (g *gcpSecretsManager) ListSecretVersions(ctx context.Context, projectID, secretName string) ([]secretstore.SecretVersion, error) {
+	client, err := g.getClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCP secret manager client: %w", err)
+	}
+
+	req := &secretmanagerpb.ListSecretVersionsRequest{
+		Parent: fmt.Sprintf("projects/%s/secrets/%s", projectID, secretName),
+	}
+	var versions []secretstore.SecretVersion
+	it := client.ListSecretVersions(ctx, req)
+	for {
+		version, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return versions, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error listing versions of secret %s in GCP secret manager project %s: %w", secretName, projectID,
+				classifyError(projectID, secretName, err))
+		}
+		versions = append(versions, secretstore.SecretVersion{
+			Version:   path.Base(version.Name),
+			CreatedAt: version.CreateTime.AsTime(),
+			State:     versionState(version.State),
+		})
+	}
+}
+
+// Watch polls the name of the latest version of the secret, which does not read its value
+func (g *gcpSecretsManager) Watch(ctx context.Context, projectID, secretName string, options *secretstore.WatchOptions) (<-chan secretstore.WatchEvent, error) {
+	client, err := g.getClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCP secret manager client: %w", err)
+	}
+	return secretstore.PollWatch(ctx, projectID, secretName, options.GetPollInterval(), func(ctx context.Context) (string, error) {
+		version, err := client.GetSecretVersion(ctx, &secretmanagerpb.GetSecretVersionRequest{
+			Name: versionName(projectID, secretName, latestVersion),
+		})
+		if err != nil {
+			return "", classifyError(projectID, secretName, err)
+		}
+		return path.Base(version.Name), nil
+	}), nil
+}
+
+func (g *gcpSecretsManager) GetSecretVersion(ctx context.Context, projectID, secretName, version string) (*secretstore.SecretValue, error) {
+	client, err := g.getClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCP secret manager client: %w", err)
+	}
+
+	resp, err := accessSecretVersion(ctx, client, projectID, secretName, version)
+	if err != nil {
+		return nil, err
+	}
+	secretValue := secretstore.NewSecretValueFromString(string(resp.Payload.Data))
+	secretValue.Version = path.Base(resp.Name)
+	return secretValue, nil
+}
+
+func (g *gcpSecretsManager) DisableSecretVersion(ctx context.Context, projectID, secretName, version string) error {
+	client, err := g.getClient(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating GCP secret manager client: %w", err)
+	}
+
+	req := &secretmanagerpb.DisableSecretVersionRequest{
+		Name: versionName(projectID, secretName, version),
+	}
+	_, err = client.DisableSecretVersion(ctx, req)
+	if err != nil {
+		return fmt.Errorf("error disabling version %s of secret %s in GCP secret manager project %s: %w", version, secretName, projectID,
+			classifyError(projectID, secretName, err))
+	}
+	return nil
+}
+
+func (g *gcpSecretsManager) DestroySecretVersion(ctx context.Context, projectID, secretName, version string) error {
+	client, err := g.getClient(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating GCP secret manager client: %w", err)
+	}
+
+	req := &secretmanagerpb.DestroySecretVersionRequest{
+		Name: versionName(projectID, secretName, version),
+	}
+	_, err = client.DestroySecretVersion(ctx, req)
+	if err != nil {
+		return fmt.Errorf("error destroying version %s of secret %s in GCP secret manager project %s: %w", version, secretName, projectID,
+			classifyError(projectID, secretName, err))
+	}
+	return nil
+}
+
+func versionState(state secretmanagerpb.SecretVersion_State) secretstore.VersionState {
+	switch state {
+	case secretmanagerpb.SecretVersion_DISABLED:
+		return secretstore.VersionStateDisabled
+	case secretmanagerpb.SecretVersion_DESTROYED:
+		return secretstore.VersionStateDestroyed
+	default:
+		return secretstore.VersionStateEnabled
+	}
+}
+
+func versionName(projectID, secretName, version string) string {
+	return fmt.Sprintf("projects/%s/secrets/%s/versions/%s", projectID, secretName, version)
+}
+
+func (g *gcpSecretsManager) DeleteSecret(ctx context.Context, projectID, secretName string, _ *secretstore.DeleteOptions) error {
+	client, err := g.getClient(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating GCP secret manager client: %w", err)
+	}
+
+	req := &secretmanagerpb.DeleteSecretRequest{
+		Name: fmt.Sprintf("projects/%s/secrets/%s", projectID, secretName),
+	}
+	err = client.DeleteSecret(ctx, req)
+	if err != nil {
+		return fmt.Errorf("unable to delete secret %s in GCP secret manager project %s: %w", secretName, projectID, classifyError(projectID, secretName, err))
+	}
+	return nil
+}
+
+func (g *gcpSecretsManager) ListSecrets(ctx context.Context, projectID string, options *secretstore.ListOptions) *secretstore.SecretIterator {
+	prefix := options.GetPrefix()
+	return secretstore.NewSecretIterator(ctx, prefix, func(ctx context.Context, pageToken string) ([]secretstore.SecretInfo, string, error) {
+		client, err := g.getClient(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("error creating GCP secret manager client: %w", err)
+		}
+
+		req := &secretmanagerpb.ListSecretsRequest{
+			Parent: fmt.Sprintf("projects/%s", projectID),
+		}
+		if prefix != "" {
+			// the name filter matches substrings, the iterator only keeps names starting with the prefix
+			req.Filter = fmt.Sprintf("name:%s", prefix)
+		}
+		var page []*secretmanagerpb.Secret
+		nextPageToken, err := iterator.NewPager(client.ListSecrets(ctx, req), options.GetPageSize(), pageToken).NextPage(&page)
+		if err != nil {
+			return nil, "", fmt.Errorf("error listing secrets in GCP secret manager project %s: %w", projectID, classifyError(projectID, "", err))
+		}
+		secrets := make([]secretstore.SecretInfo, 0, len(page))
+		for _, secret := range page {
+			secrets = append(secrets, secretstore.SecretInfo{
+				Name:        path.Base(secret.Name),
+				Labels:      secret.Labels,
+				Annotations: secret.Annotations,
+				CreatedAt:   secret.CreateTime.AsTime(),
+			})
+		}
+		return secrets, nextPageToken, nil
+	})
+}
+
 func getSecretPropertyMap(v *secretmanagerpb.SecretPayload) (map[string]string, error) {
 	m := make(map[string]string)
 	err := json.Unmarshal(v.Data, &m)
@@ -101,32 +468,42 @@ func getSecretProperty(v *secretmanagerpb.SecretPayload, propertyName string) (s
 	if err != nil {
 		return "", fmt.Errorf("error reading property %s from secret JSON object: %w", propertyName, err)
 	}
-	return m[propertyName], nil
+	value, ok := m[propertyName]
+	if !ok {
+		return "", fmt.Errorf("property %s does not occur in secret JSON object: %w", propertyName, secretstore.ErrKeyNotFound)
+	}
+	return value, nil
 }
 
-func getSecretOpsClient() (*secretmanager.Client, func(), error) {
-	creds, err := gcpiam.DefaultCredentials()
-	if err != nil {
-		return nil, nil, fmt.Errorf("error getting GCP default credentials: %w", err)
+// getSecretOpsClient creates a client using creds, or the default credentials if creds is nil. The client outlives ctx
+// so ctx is only used while creating the connection
+func getSecretOpsClient(ctx context.Context, creds *google.Credentials) (*secretmanager.Client, error) {
+	if creds == nil {
+		var err error
+		creds, err = gcpiam.DefaultCredentials()
+		if err != nil {
+			return nil, fmt.Errorf("error getting GCP default credentials: %w", err)
+		}
 	}
-	client, err := secretmanager.NewClient(context.TODO(),
+	client, err := secretmanager.NewClient(context.WithoutCancel(ctx),
 		option.WithGRPCDialOption(
 			grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(nil, "")),
 		),
 		option.WithTokenSource(oauth.TokenSource{TokenSource: creds.TokenSource}),
 	)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-
-	return client, func() { _ = client.Close() }, nil
+	return client, nil
 }
 
-func createSecret(client *secretmanager.Client, projectID, secretName string) (*secretmanagerpb.Secret, error) {
+func createSecret(ctx context.Context, client *secretmanager.Client, projectID, secretName string, labels, annotations map[string]string) (*secretmanagerpb.Secret, error) {
 	req := &secretmanagerpb.CreateSecretRequest{
 		Parent:   fmt.Sprintf("projects/%s", projectID),
 		SecretId: secretName,
 		Secret: &secretmanagerpb.Secret{
+			Labels:      labels,
+			Annotations: annotations,
 			Replication: &secretmanagerpb.Replication{
 				Replication: &secretmanagerpb.Replication_Automatic_{
 					Automatic: &secretmanagerpb.Replication_Automatic{},
@@ -134,34 +511,58 @@ func createSecret(client *secretmanager.Client, projectID, secretName string) (*
 			},
 		},
 	}
-	secret, err := client.CreateSecret(context.TODO(), req)
+	secret, err := client.CreateSecret(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("error creating secret %s in GCP secrets manager for project %s: %w", secretName, projectID, err)
+		return nil, fmt.Errorf("error creating secret %s in GCP secrets manager for project %s: %w", secretName, projectID, classifyError(projectID, secretName, err))
 	}
 	return secret, nil
 }
 
-func getSecret(client *secretmanager.Client, projectID, secretName string) (*secretmanagerpb.Secret, error) {
+func getSecret(ctx context.Context, client *secretmanager.Client, projectID, secretName string) (*secretmanagerpb.Secret, error) {
 
 	req := &secretmanagerpb.GetSecretRequest{
 		Name: fmt.Sprintf("projects/%s/secrets/%s", projectID, secretName),
 	}
-	secret, err := client.GetSecret(context.TODO(), req)
+	secret, err := client.GetSecret(ctx, req)
 
 	if err != nil {
-		return nil, fmt.Errorf("error getting secret %s for GCP secrets manager project %s: %w", secretName, projectID, err)
+		return nil, fmt.Errorf("error getting secret %s for GCP secrets manager project %s: %w", secretName, projectID, classifyError(projectID, secretName, err))
 	}
 	return secret, nil
 }
 
-func getSecretValue(client *secretmanager.Client, projectID, secretName string) (*secretmanagerpb.SecretPayload, error) {
+func getSecretValue(ctx context.Context, client *secretmanager.Client, projectID, secretName string) (*secretmanagerpb.SecretPayload, error) {
+	secret, err := accessSecretVersion(ctx, client, projectID, secretName, latestVersion)
+	if err != nil {
+		return nil, err
+	}
+	return secret.Payload, nil
+}
 
+func accessSecretVersion(ctx context.Context, client *secretmanager.Client, projectID, secretName, version string) (*secretmanagerpb.AccessSecretVersionResponse, error) {
 	req := &secretmanagerpb.AccessSecretVersionRequest{
-		Name: fmt.Sprintf("projects/%s/secrets/%s/versions/latest", projectID, secretName),
+		Name: versionName(projectID, secretName, version),
 	}
-	secret, err := client.AccessSecretVersion(context.TODO(), req)
+	secret, err := client.AccessSecretVersion(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("error getting secret value for secret %s for GCP secrets manager project %s: %w", secretName, projectID, err)
+		return nil, fmt.Errorf("error getting secret value for secret %s for GCP secrets manager project %s: %w", secretName, projectID,
+			classifyError(projectID, secretName, err))
 	}
-	return secret.Payload, nil
+	return secret, nil
+}
+
+// classifyError maps GCP gRPC status codes on to the secretstore error kinds
+func classifyError(projectID, secretName string, err error) error {
+	var kind error
+	switch status.Code(err) {
+	case codes.NotFound:
+		kind = secretstore.ErrSecretNotFound
+	case codes.PermissionDenied, codes.Unauthenticated:
+		kind = secretstore.ErrPermissionDenied
+	case codes.AlreadyExists:
+		kind = secretstore.ErrAlreadyExists
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted, codes.Internal:
+		kind = secretstore.ErrTransient
+	}
+	return secretstore.NewError(kind, projectID, secretName, err)
 }
@@ -0,0 +1,130 @@
+//go:build unit
+// +build unit
+
+package gcpsecretsmanager
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestLabelsAndAnnotations(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newFakeSecretManager(t)
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"password": "hunter2"},
+		Labels:         map[string]string{"team": "data"},
+		Annotations:    map[string]string{"owner": "dba"},
+	}))
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin"},
+		Labels:         map[string]string{"env": "prod"},
+	}))
+
+	value, err := mgr.GetSecretValue(ctx, "project", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "hunter2", "username": "admin"}, value.PropertyValues)
+	assert.Equal(t, map[string]string{"team": "data", "env": "prod"}, value.Labels)
+	assert.Equal(t, map[string]string{"owner": "dba"}, value.Annotations)
+	assert.Equal(t, "2", value.Version)
+}
+
+func TestOverwrite(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newFakeSecretManager(t)
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin", "legacy": "old"},
+		Labels:         map[string]string{"team": "data", "stale": "true"},
+		Annotations:    map[string]string{"owner": "dba"},
+	}))
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin"},
+		Labels:         map[string]string{"team": "data"},
+		Overwrite:      true,
+	}))
+
+	value, err := mgr.GetSecretValue(ctx, "project", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin"}, value.PropertyValues)
+	assert.Equal(t, map[string]string{"team": "data"}, value.Labels)
+	assert.Empty(t, value.Annotations)
+}
+
+func TestSetSecretWithExpectedVersion(t *testing.T) {
+	ctx := context.Background()
+	mgr, fake := newFakeSecretManager(t)
+
+	err := mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{Value: "a", ExpectedVersion: "1"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{Value: "a", Annotations: map[string]string{"owner": "dba"}}))
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{Value: "b", ExpectedVersion: "1"}))
+	value, err := mgr.GetSecretValue(ctx, "project", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "b", value.Value)
+	assert.Equal(t, "2", value.Version)
+	assert.Equal(t, map[string]string{"owner": "dba"}, value.Annotations, "the claim is not returned as an annotation")
+
+	// version 2 is no longer the latest version
+	fake.addVersion("project", "db", "c")
+	err = mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{Value: "d", ExpectedVersion: "2"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+
+	// version 3 was already claimed by another writer which has not added its version yet
+	err = mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{Value: "d", ExpectedVersion: "3"})
+	require.NoError(t, err)
+	fake.secrets["projects/project/secrets/db"].Annotations[casClaimAnnotation] = fmt.Sprintf("4@%d", time.Now().Unix())
+	err = mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{Value: "e", ExpectedVersion: "4"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+
+	// a claim which has timed out does not block writers
+	fake.secrets["projects/project/secrets/db"].Annotations[casClaimAnnotation] = fmt.Sprintf("4@%d", time.Now().Add(-2*casClaimTimeout).Unix())
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{Value: "e", ExpectedVersion: "4"}))
+}
+
+func TestSetSecretWithExpectedVersionRace(t *testing.T) {
+	ctx := context.Background()
+	mgr, fake := newFakeSecretManager(t)
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{Value: "a"}))
+
+	// another writer claims the version between this writer reading the secret and claiming it, changing its etag
+	fake.beforeUpdate = func() {
+		fake.beforeUpdate = nil
+		_, err := fake.UpdateSecret(ctx, &secretmanagerpb.UpdateSecretRequest{
+			Secret:     &secretmanagerpb.Secret{Name: "projects/project/secrets/db", Annotations: map[string]string{"other": "writer"}},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"annotations"}},
+		})
+		require.NoError(t, err)
+	}
+	err := mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{Value: "b", ExpectedVersion: "1"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+
+	value, err := mgr.GetSecretValue(ctx, "project", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "a", value.Value)
+	assert.Equal(t, "1", value.Version)
+}
+
+func TestSetSecretCreateOnly(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newFakeSecretManager(t)
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{Value: "a", CreateOnly: true}))
+	err := mgr.SetSecretWithContext(ctx, "project", "db", &secretstore.SecretValue{Value: "b", CreateOnly: true})
+	assert.ErrorIs(t, err, secretstore.ErrAlreadyExists)
+
+	value, err := mgr.GetSecretValue(ctx, "project", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "a", value.Value)
+	assert.Equal(t, "1", value.Version)
+}
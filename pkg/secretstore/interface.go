@@ -1,10 +1,24 @@
 package secretstore
 
+import "context"
+
 type Interface interface {
+	ContextInterface
 	GetSecret(location string, secretName string, secretKey string) (string, error)
 	SetSecret(location string, secretName string, secretValue *SecretValue) error
 }
 
+// ContextInterface is the context aware variant of Interface. The context is passed on to the underlying secret
+// store so that callers can cancel or set deadlines on calls. GetSecret and SetSecret are equivalent to calling these
+// methods with context.Background()
+type ContextInterface interface {
+	GetSecretWithContext(ctx context.Context, location string, secretName string, secretKey string) (string, error)
+	GetSecretValue(ctx context.Context, location string, secretName string) (*SecretValue, error)
+	SetSecretWithContext(ctx context.Context, location string, secretName string, secretValue *SecretValue) error
+	DeleteSecret(ctx context.Context, location string, secretName string, options *DeleteOptions) error
+	ListSecrets(ctx context.Context, location string, options *ListOptions) *SecretIterator
+}
+
 type FactoryInterface interface {
 	NewSecretManager(storeType Type) (Interface, error)
 }
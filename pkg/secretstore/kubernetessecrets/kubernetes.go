@@ -10,7 +10,11 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 )
 
 const (
@@ -27,9 +31,13 @@ type kubernetesSecretManager struct {
 }
 
 func (k kubernetesSecretManager) GetSecret(namespace, secretName, secretKey string) (string, error) {
-	secret, err := k.kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	return k.GetSecretWithContext(context.Background(), namespace, secretName, secretKey)
+}
+
+func (k kubernetesSecretManager) GetSecretWithContext(ctx context.Context, namespace, secretName, secretKey string) (string, error) {
+	secret, err := k.kubeClient.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
-		return "", fmt.Errorf("failed to get secret %s from namespace %s: %w", secretName, namespace, err)
+		return "", fmt.Errorf("failed to get secret %s from namespace %s: %w", secretName, namespace, classifyError(namespace, secretName, err))
 	}
 	secretData, ok := secret.Data[secretKey]
 	if ok {
@@ -39,16 +47,46 @@ func (k kubernetesSecretManager) GetSecret(namespace, secretName, secretKey stri
 	if ok {
 		return secretString, nil
 	}
-	return "", fmt.Errorf("failed to get secret %s from namespace %s", secretName, namespace)
+	return "", fmt.Errorf("failed to get secret %s from namespace %s: %w", secretName, namespace,
+		secretstore.NewKeyNotFoundError(namespace, secretName, secretKey))
+}
+
+func (k kubernetesSecretManager) GetSecretValue(ctx context.Context, namespace, secretName string) (*secretstore.SecretValue, error) {
+	secret, err := k.kubeClient.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s from namespace %s: %w", secretName, namespace, classifyError(namespace, secretName, err))
+	}
+	propertyValues := make(map[string]string, len(secret.Data)+len(secret.StringData))
+	for k, v := range secret.Data {
+		propertyValues[k] = string(v)
+	}
+	for k, v := range secret.StringData {
+		propertyValues[k] = v
+	}
+	return &secretstore.SecretValue{
+		PropertyValues: propertyValues,
+		Labels:         secret.Labels,
+		Annotations:    secret.Annotations,
+		SecretType:     secret.Type,
+		Version:        secret.ResourceVersion,
+	}, nil
 }
 
 func (k kubernetesSecretManager) SetSecret(namespace, secretName string, secretValue *secretstore.SecretValue) error {
+	return k.SetSecretWithContext(context.Background(), namespace, secretName, secretValue)
+}
+
+func (k kubernetesSecretManager) SetSecretWithContext(ctx context.Context, namespace, secretName string, secretValue *secretstore.SecretValue) error {
 	create := false
 	secretInterface := k.kubeClient.CoreV1().Secrets(namespace)
-	secret, err := secretInterface.Get(context.TODO(), secretName, metav1.GetOptions{})
+	secret, err := secretInterface.Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
 		if !apierrors.IsNotFound(err) {
-			return fmt.Errorf("failed to : %w", err)
+			return fmt.Errorf("failed to get Secret %s in namespace %s: %w", secretName, namespace, classifyError(namespace, secretName, err))
+		}
+		if secretValue.ExpectedVersion != "" {
+			return fmt.Errorf("failed to update Secret %s in namespace %s: %w", secretName, namespace,
+				secretstore.NewConflictError(namespace, secretName))
 		}
 		create = true
 		secret = &corev1.Secret{
@@ -59,11 +97,25 @@ func (k kubernetesSecretManager) SetSecret(namespace, secretName string, secretV
 			Type: corev1.SecretTypeOpaque,
 		}
 	}
+	if secretValue.CreateOnly && !create {
+		return fmt.Errorf("failed to create Secret %s in namespace %s: %w", secretName, namespace,
+			secretstore.NewAlreadyExistsError(namespace, secretName))
+	}
+	if secretValue.ExpectedVersion != "" {
+		// the API server rejects the update with a conflict if the resourceVersion is no longer current
+		secret.ResourceVersion = secretValue.ExpectedVersion
+	}
 
 	secret.Type = corev1.SecretTypeOpaque
 	if string(secretValue.SecretType) != "" {
 		secret.Type = secretValue.SecretType
 	}
+	if secretValue.Overwrite {
+		secret.Data = nil
+		secret.StringData = nil
+		secret.Labels = nil
+		secret.Annotations = nil
+	}
 	if secret.Data == nil {
 		secret.Data = map[string][]byte{}
 	}
@@ -90,14 +142,18 @@ func (k kubernetesSecretManager) SetSecret(namespace, secretName string, secretV
 	}
 
 	if create {
-		_, err = secretInterface.Create(context.TODO(), secret, metav1.CreateOptions{})
+		_, err = secretInterface.Create(ctx, secret, metav1.CreateOptions{})
 		if err != nil {
-			return fmt.Errorf("failed to create Secret %s in namespace %s: %w", secretName, namespace, err)
+			return fmt.Errorf("failed to create Secret %s in namespace %s: %w", secretName, namespace, classifyError(namespace, secretName, err))
 		}
 	} else {
-		_, err = secretInterface.Update(context.TODO(), secret, metav1.UpdateOptions{})
+		_, err = secretInterface.Update(ctx, secret, metav1.UpdateOptions{})
 		if err != nil {
-			return fmt.Errorf("failed to update Secret %s in namespace %s: %w", secretName, namespace, err)
+			if secretValue.ExpectedVersion != "" && apierrors.IsConflict(err) {
+				return fmt.Errorf("failed to update Secret %s in namespace %s: %w", secretName, namespace,
+					secretstore.NewError(secretstore.ErrConflict, namespace, secretName, err))
+			}
+			return fmt.Errorf("failed to update Secret %s in namespace %s: %w", secretName, namespace, classifyError(namespace, secretName, err))
 		}
 	}
 
@@ -107,7 +163,7 @@ func (k kubernetesSecretManager) SetSecret(namespace, secretName string, secretV
 		if namespaces != "" {
 			nsList := strings.Split(namespaces, ",")
 			for _, tons := range nsList {
-				err = copySecretToNamespace(k.kubeClient, tons, secret)
+				err = copySecretToNamespace(ctx, k.kubeClient, tons, secret)
 				if err != nil {
 					return fmt.Errorf("failed to replicate Secret for local backend: %w", err)
 				}
@@ -118,16 +174,114 @@ func (k kubernetesSecretManager) SetSecret(namespace, secretName string, secretV
 	return nil
 }
 
+func (k kubernetesSecretManager) DeleteSecret(ctx context.Context, namespace, secretName string, _ *secretstore.DeleteOptions) error {
+	err := k.kubeClient.CoreV1().Secrets(namespace).Delete(ctx, secretName, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete Secret %s in namespace %s: %w", secretName, namespace, classifyError(namespace, secretName, err))
+	}
+	return nil
+}
+
+func (k kubernetesSecretManager) ListSecrets(ctx context.Context, namespace string, options *secretstore.ListOptions) *secretstore.SecretIterator {
+	secretInterface := k.kubeClient.CoreV1().Secrets(namespace)
+	return secretstore.NewSecretIterator(ctx, options.GetPrefix(), func(ctx context.Context, pageToken string) ([]secretstore.SecretInfo, string, error) {
+		list, err := secretInterface.List(ctx, metav1.ListOptions{
+			Limit:    int64(options.GetPageSize()),
+			Continue: pageToken,
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to list Secrets in namespace %s: %w", namespace, classifyError(namespace, "", err))
+		}
+		secrets := make([]secretstore.SecretInfo, 0, len(list.Items))
+		for i := range list.Items {
+			secret := &list.Items[i]
+			secrets = append(secrets, secretstore.SecretInfo{
+				Name:        secret.Name,
+				Labels:      secret.Labels,
+				Annotations: secret.Annotations,
+				CreatedAt:   secret.CreationTimestamp.Time,
+			})
+		}
+		return secrets, list.Continue, nil
+	})
+}
+
+// Watch runs an informer on the Secret so changes are reported as soon as the API server sends them
+func (k kubernetesSecretManager) Watch(ctx context.Context, namespace, secretName string, _ *secretstore.WatchOptions) (<-chan secretstore.WatchEvent, error) {
+	secretInterface := k.kubeClient.CoreV1().Secrets(namespace)
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", secretName).String()
+	informer := cache.NewSharedInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return secretInterface.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return secretInterface.Watch(ctx, options)
+		},
+	}, &corev1.Secret{}, 0)
+
+	sink := secretstore.NewWatchSink(ctx)
+	send := func(eventType secretstore.WatchEventType, obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		secret, ok := obj.(*corev1.Secret)
+		if !ok || secret.Name != secretName {
+			return
+		}
+		sink.Send(secretstore.WatchEvent{
+			Type:       eventType,
+			Location:   namespace,
+			SecretName: secretName,
+			Version:    secret.ResourceVersion,
+		})
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			send(secretstore.WatchEventAdded, obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// the informer calls UpdateFunc on resyncs too, which do not change the resourceVersion
+			if oldObj.(*corev1.Secret).ResourceVersion != newObj.(*corev1.Secret).ResourceVersion {
+				send(secretstore.WatchEventModified, newObj)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			send(secretstore.WatchEventDeleted, obj)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch Secret %s in namespace %s: %w", secretName, namespace, err)
+	}
+	err = informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		sink.Send(secretstore.WatchEvent{
+			Type:       secretstore.WatchEventError,
+			Location:   namespace,
+			SecretName: secretName,
+			Err:        classifyError(namespace, secretName, err),
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch Secret %s in namespace %s: %w", secretName, namespace, err)
+	}
+	go func() {
+		informer.Run(ctx.Done())
+		sink.Close()
+	}()
+	return sink.Events(), nil
+}
+
 // copySecretToNamespace copies the given secret to the namespace
-func copySecretToNamespace(kubeClient kubernetes.Interface, ns string, fromSecret *corev1.Secret) error {
+func copySecretToNamespace(ctx context.Context, kubeClient kubernetes.Interface, ns string, fromSecret *corev1.Secret) error {
 	secretInterface := kubeClient.CoreV1().Secrets(ns)
 	name := fromSecret.Name
-	secret, err := secretInterface.Get(context.TODO(), name, metav1.GetOptions{})
+	secret, err := secretInterface.Get(ctx, name, metav1.GetOptions{})
 
 	create := false
 	if err != nil {
 		if !apierrors.IsNotFound(err) {
-			return fmt.Errorf("failed to : %w", err)
+			return fmt.Errorf("failed to get Secret %s in namespace %s: %w", name, ns, classifyError(ns, name, err))
 		}
 		create = true
 		secret = &corev1.Secret{
@@ -168,15 +322,34 @@ func copySecretToNamespace(kubeClient kubernetes.Interface, ns string, fromSecre
 	}
 
 	if create {
-		_, err = secretInterface.Create(context.TODO(), secret, metav1.CreateOptions{})
+		_, err = secretInterface.Create(ctx, secret, metav1.CreateOptions{})
 		if err != nil {
-			return fmt.Errorf("failed to create Secret %s in namespace %s: %w", name, ns, err)
+			return fmt.Errorf("failed to create Secret %s in namespace %s: %w", name, ns, classifyError(ns, name, err))
 		}
 		return nil
 	}
-	_, err = secretInterface.Update(context.TODO(), secret, metav1.UpdateOptions{})
+	_, err = secretInterface.Update(ctx, secret, metav1.UpdateOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to update Secret %s in namespace %s: %w", name, ns, err)
+		return fmt.Errorf("failed to update Secret %s in namespace %s: %w", name, ns, classifyError(ns, name, err))
 	}
 	return nil
 }
+
+// classifyError maps Kubernetes API errors on to the secretstore error kinds
+func classifyError(namespace, secretName string, err error) error {
+	var kind error
+	switch {
+	case apierrors.IsNotFound(err):
+		kind = secretstore.ErrSecretNotFound
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		kind = secretstore.ErrPermissionDenied
+	case apierrors.IsAlreadyExists(err):
+		kind = secretstore.ErrAlreadyExists
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsTooManyRequests(err),
+		apierrors.IsServiceUnavailable(err), apierrors.IsInternalError(err),
+		// a conflict means the Secret changed between reading and updating it, setting it again re-reads the Secret
+		apierrors.IsConflict(err):
+		kind = secretstore.ErrTransient
+	}
+	return secretstore.NewError(kind, namespace, secretName, err)
+}
@@ -0,0 +1,232 @@
+//go:build unit
+// +build unit
+
+package kubernetessecrets_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/kubernetessecrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const ns = "jx"
+
+func newSecret(name string, data map[string]string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+		},
+		Data: map[string][]byte{},
+	}
+	for k, v := range data {
+		secret.Data[k] = []byte(v)
+	}
+	return secret
+}
+
+func TestGetSecret(t *testing.T) {
+	mgr := kubernetessecrets.NewKubernetesSecretManager(fake.NewSimpleClientset(newSecret("db", map[string]string{"password": "pwd"})))
+
+	value, err := mgr.GetSecret(ns, "db", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "pwd", value)
+
+	_, err = mgr.GetSecret(ns, "db", "username")
+	assert.ErrorIs(t, err, secretstore.ErrKeyNotFound)
+
+	_, err = mgr.GetSecret(ns, "missing", "password")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+}
+
+func TestSetAndDeleteSecret(t *testing.T) {
+	ctx := context.Background()
+	mgr := kubernetessecrets.NewKubernetesSecretManager(fake.NewSimpleClientset())
+
+	err := mgr.SetSecret(ns, "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin"},
+		Labels:         map[string]string{"app": "db"},
+	})
+	assert.NoError(t, err)
+	err = mgr.SetSecret(ns, "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "pwd"}})
+	assert.NoError(t, err)
+
+	value, err := mgr.GetSecret(ns, "db", "username")
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", value)
+
+	err = mgr.DeleteSecret(ctx, ns, "db", nil)
+	assert.NoError(t, err)
+	err = mgr.DeleteSecret(ctx, ns, "db", nil)
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+}
+
+func TestListSecrets(t *testing.T) {
+	mgr := kubernetessecrets.NewKubernetesSecretManager(fake.NewSimpleClientset(
+		newSecret("app-db", nil),
+		newSecret("app-cache", nil),
+		newSecret("other", nil),
+	))
+
+	names, err := mgr.ListSecrets(context.Background(), ns, &secretstore.ListOptions{Prefix: "app-"}).Names()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"app-db", "app-cache"}, names)
+}
+
+func TestGetSecretValueRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	mgr := kubernetessecrets.NewKubernetesSecretManager(fake.NewSimpleClientset())
+	err := mgr.SetSecret(ns, "tls", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"tls.crt": "cert", "tls.key": "key"},
+		Labels:         map[string]string{"app": "web"},
+		Annotations:    map[string]string{"owner": "team"},
+		SecretType:     corev1.SecretTypeTLS,
+	})
+	assert.NoError(t, err)
+
+	secretValue, err := mgr.GetSecretValue(ctx, ns, "tls")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"tls.crt": "cert", "tls.key": "key"}, secretValue.PropertyValues)
+	assert.Equal(t, map[string]string{"app": "web"}, secretValue.Labels)
+	assert.Equal(t, map[string]string{"owner": "team"}, secretValue.Annotations)
+	assert.Equal(t, corev1.SecretTypeTLS, secretValue.SecretType)
+
+	secretValue.PropertyValues["tls.key"] = "rotated"
+	err = mgr.SetSecret(ns, "tls", secretValue)
+	assert.NoError(t, err)
+
+	roundTripped, err := mgr.GetSecretValue(ctx, ns, "tls")
+	assert.NoError(t, err)
+	assert.Equal(t, secretValue, roundTripped)
+}
+
+func TestSetSecretWithExpectedVersion(t *testing.T) {
+	ctx := context.Background()
+	secret := newSecret("db", map[string]string{"password": "pwd"})
+	secret.ResourceVersion = "7"
+	client := fake.NewSimpleClientset(secret)
+	// the fake clientset does not check resourceVersions so emulate the API server
+	client.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		updated := action.(k8stesting.UpdateAction).GetObject().(*corev1.Secret)
+		if updated.ResourceVersion != "" && updated.ResourceVersion != "7" {
+			return true, nil, apierrors.NewConflict(corev1.Resource("secrets"), updated.Name, assert.AnError)
+		}
+		return false, nil, nil
+	})
+	mgr := kubernetessecrets.NewKubernetesSecretManager(client)
+
+	secretValue, err := mgr.GetSecretValue(ctx, ns, "db")
+	assert.NoError(t, err)
+	assert.Equal(t, "7", secretValue.Version)
+
+	err = mgr.SetSecret(ns, "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "stale"}, ExpectedVersion: "6"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	err = mgr.SetSecret(ns, "missing", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "pwd"}, ExpectedVersion: "1"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+
+	err = mgr.SetSecret(ns, "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "new"}, ExpectedVersion: "7"})
+	assert.NoError(t, err)
+	value, err := mgr.GetSecret(ns, "db", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "new", value)
+}
+
+func TestUpdateSecretRemovesKeys(t *testing.T) {
+	ctx := context.Background()
+	secret := newSecret("db", map[string]string{"username": "admin", "password": "pwd", "legacy": "old"})
+	secret.Labels = map[string]string{"app": "db", "stale": "true"}
+	mgr := kubernetessecrets.NewKubernetesSecretManager(fake.NewSimpleClientset(secret))
+
+	err := secretstore.UpdateSecret(ctx, mgr, ns, "db", func(current *secretstore.SecretValue) (*secretstore.SecretValue, error) {
+		delete(current.PropertyValues, "legacy")
+		delete(current.Labels, "stale")
+		current.PropertyValues["password"] = "rotated"
+		return current, nil
+	}, nil)
+	require.NoError(t, err)
+
+	value, err := mgr.GetSecretValue(ctx, ns, "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "rotated"}, value.PropertyValues)
+	assert.Equal(t, map[string]string{"app": "db"}, value.Labels)
+
+	err = mgr.SetSecret(ns, "db", &secretstore.SecretValue{PropertyValues: map[string]string{"token": "abc"}})
+	require.NoError(t, err)
+	value, err = mgr.GetSecretValue(ctx, ns, "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "rotated", "token": "abc"}, value.PropertyValues)
+}
+
+func TestSetSecretCreateOnly(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(newSecret("db", map[string]string{"password": "pwd"}))
+	mgr := kubernetessecrets.NewKubernetesSecretManager(client)
+
+	err := mgr.SetSecret(ns, "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "new"}, CreateOnly: true})
+	assert.ErrorIs(t, err, secretstore.ErrAlreadyExists)
+	value, err := mgr.GetSecret(ns, "db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "pwd", value)
+
+	// another writer creates the Secret between it being read and created
+	racing := true
+	client.PrependReactor("get", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return racing, nil, apierrors.NewNotFound(corev1.Resource("secrets"), "token")
+	})
+	require.NoError(t, mgr.SetSecret(ns, "token", &secretstore.SecretValue{PropertyValues: map[string]string{"token": "a"}, CreateOnly: true}))
+	err = mgr.SetSecret(ns, "token", &secretstore.SecretValue{PropertyValues: map[string]string{"token": "b"}, CreateOnly: true})
+	assert.ErrorIs(t, err, secretstore.ErrAlreadyExists)
+	racing = false
+	secret, err := client.CoreV1().Secrets(ns).Get(ctx, "token", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(secret.Data["token"]))
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset(newSecret("db", map[string]string{"password": "pwd"}), newSecret("other", nil))
+	watcher, err := secretstore.AsWatchInterface(kubernetessecrets.NewKubernetesSecretManager(client))
+	require.NoError(t, err)
+
+	events, err := watcher.Watch(ctx, ns, "db", nil)
+	require.NoError(t, err)
+	next := func() secretstore.WatchEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(10 * time.Second):
+			require.FailNow(t, "timed out waiting for watch event")
+		}
+		return secretstore.WatchEvent{}
+	}
+
+	added := next()
+	assert.Equal(t, secretstore.WatchEventAdded, added.Type)
+	assert.Equal(t, "db", added.SecretName)
+
+	secret := newSecret("db", map[string]string{"password": "new"})
+	secret.ResourceVersion = "2"
+	_, err = client.CoreV1().Secrets(ns).Update(ctx, secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, secretstore.WatchEvent{Type: secretstore.WatchEventModified, Location: ns, SecretName: "db", Version: "2"}, next())
+
+	require.NoError(t, client.CoreV1().Secrets(ns).Delete(ctx, "other", metav1.DeleteOptions{}))
+	require.NoError(t, client.CoreV1().Secrets(ns).Delete(ctx, "db", metav1.DeleteOptions{}))
+	assert.Equal(t, secretstore.WatchEventDeleted, next().Type)
+
+	cancel()
+	for range events {
+	}
+}
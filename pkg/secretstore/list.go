@@ -0,0 +1,105 @@
+package secretstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrIteratorDone is returned by SecretIterator.Next when there are no more secrets
+var ErrIteratorDone = errors.New("no more secrets in iterator")
+
+// SecretInfo describes a secret in a location. Only the name is guaranteed to be populated, the remaining metadata is
+// filled in where the secret store returns it when listing
+type SecretInfo struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// PageFunc fetches a single page of secrets starting at pageToken, an empty pageToken being the first page. An empty
+// nextPageToken is returned once the last page has been fetched
+type PageFunc func(ctx context.Context, pageToken string) (secrets []SecretInfo, nextPageToken string, err error)
+
+// SecretIterator lazily pages through the secrets of a location
+type SecretIterator struct {
+	ctx       context.Context
+	fetch     PageFunc
+	prefix    string
+	buffer    []SecretInfo
+	pageToken string
+	lastPage  bool
+	err       error
+}
+
+// NewSecretIterator creates an iterator calling fetch for each page. Secrets not matching prefix are skipped so that
+// stores which can only filter approximately on the server still return exact results
+func NewSecretIterator(ctx context.Context, prefix string, fetch PageFunc) *SecretIterator {
+	return &SecretIterator{ctx: ctx, fetch: fetch, prefix: prefix}
+}
+
+// NewErrorSecretIterator creates an iterator that returns err from the first call to Next
+func NewErrorSecretIterator(err error) *SecretIterator {
+	return &SecretIterator{err: err}
+}
+
+// Next returns the next secret, ErrIteratorDone once all secrets have been returned or the error from fetching a page
+func (it *SecretIterator) Next() (*SecretInfo, error) {
+	for {
+		if it.err != nil {
+			return nil, it.err
+		}
+		if len(it.buffer) > 0 {
+			info := it.buffer[0]
+			it.buffer = it.buffer[1:]
+			if !strings.HasPrefix(info.Name, it.prefix) {
+				continue
+			}
+			return &info, nil
+		}
+		if it.lastPage {
+			it.err = ErrIteratorDone
+			continue
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			continue
+		}
+		secrets, nextPageToken, err := it.fetch(it.ctx, it.pageToken)
+		if err != nil {
+			it.err = err
+			continue
+		}
+		it.buffer = secrets
+		it.pageToken = nextPageToken
+		it.lastPage = nextPageToken == ""
+	}
+}
+
+// All drains the iterator returning every remaining secret
+func (it *SecretIterator) All() ([]SecretInfo, error) {
+	var secrets []SecretInfo
+	for {
+		info, err := it.Next()
+		if errors.Is(err, ErrIteratorDone) {
+			return secrets, nil
+		}
+		if err != nil {
+			return secrets, err
+		}
+		secrets = append(secrets, *info)
+	}
+}
+
+// Names drains the iterator returning the names of every remaining secret
+func (it *SecretIterator) Names() ([]string, error) {
+	secrets, err := it.All()
+	names := make([]string, 0, len(secrets))
+	for i := range secrets {
+		names = append(names, secrets[i].Name)
+	}
+	return names, err
+}
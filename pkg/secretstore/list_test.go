@@ -0,0 +1,67 @@
+//go:build unit
+// +build unit
+
+package secretstore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretIteratorPagesAndFiltersOnPrefix(t *testing.T) {
+	pages := map[string][]string{
+		"":   {"app-one", "other", "app-two"},
+		"p2": {"app-three"},
+		"p3": {},
+		"p4": {"another", "app-four"},
+	}
+	next := map[string]string{"": "p2", "p2": "p3", "p3": "p4", "p4": ""}
+	var fetched []string
+	it := secretstore.NewSecretIterator(context.Background(), "app-", func(_ context.Context, pageToken string) ([]secretstore.SecretInfo, string, error) {
+		fetched = append(fetched, pageToken)
+		var secrets []secretstore.SecretInfo
+		for _, name := range pages[pageToken] {
+			secrets = append(secrets, secretstore.SecretInfo{Name: name})
+		}
+		return secrets, next[pageToken], nil
+	})
+
+	names, err := it.Names()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app-one", "app-two", "app-three", "app-four"}, names)
+	assert.Equal(t, []string{"", "p2", "p3", "p4"}, fetched)
+
+	_, err = it.Next()
+	assert.ErrorIs(t, err, secretstore.ErrIteratorDone)
+}
+
+func TestSecretIteratorReturnsPageError(t *testing.T) {
+	pageErr := fmt.Errorf("access denied")
+	it := secretstore.NewSecretIterator(context.Background(), "", func(_ context.Context, pageToken string) ([]secretstore.SecretInfo, string, error) {
+		if pageToken == "" {
+			return []secretstore.SecretInfo{{Name: "first"}}, "next", nil
+		}
+		return nil, "", pageErr
+	})
+
+	secrets, err := it.All()
+	assert.True(t, errors.Is(err, pageErr))
+	assert.Len(t, secrets, 1)
+}
+
+func TestSecretIteratorStopsWhenContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	it := secretstore.NewSecretIterator(ctx, "", func(_ context.Context, _ string) ([]secretstore.SecretInfo, string, error) {
+		t.Fatal("page should not be fetched with a cancelled context")
+		return nil, "", nil
+	})
+
+	_, err := it.Next()
+	assert.ErrorIs(t, err, context.Canceled)
+}
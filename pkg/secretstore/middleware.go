@@ -0,0 +1,247 @@
+package secretstore
+
+import (
+	"context"
+	"errors"
+)
+
+// Middleware decorates a secret manager, for example to add logging, metrics, caching or access checks
+type Middleware func(next Interface) Interface
+
+// StoreMiddleware creates middleware for a secret manager of the store type, it is used by middleware which records
+// the store type such as tracing and metrics
+type StoreMiddleware func(storeType Type) Middleware
+
+// Chain decorates mgr with the middleware. The first middleware is the outermost so it sees each call first, i.e.
+// Chain(mgr, a, b) is a(b(mgr))
+func Chain(mgr Interface, middleware ...Middleware) Interface {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		mgr = middleware[i](mgr)
+	}
+	return mgr
+}
+
+// Operation names a call made to a secret manager
+type Operation string
+
+const (
+	OperationGetSecret            Operation = "GetSecret"
+	OperationGetSecretValue       Operation = "GetSecretValue"
+	OperationSetSecret            Operation = "SetSecret"
+	OperationDeleteSecret         Operation = "DeleteSecret"
+	OperationListSecrets          Operation = "ListSecrets"
+	OperationListSecretVersions   Operation = "ListSecretVersions"
+	OperationGetSecretVersion     Operation = "GetSecretVersion"
+	OperationDisableSecretVersion Operation = "DisableSecretVersion"
+	OperationDestroySecretVersion Operation = "DestroySecretVersion"
+	OperationWatch                Operation = "Watch"
+)
+
+// IsWrite returns true for operations which modify the secret store
+func (o Operation) IsWrite() bool {
+	switch o {
+	case OperationSetSecret, OperationDeleteSecret, OperationDisableSecretVersion, OperationDestroySecretVersion:
+		return true
+	}
+	return false
+}
+
+// Call describes a call made to a secret manager. Secret values are never included
+type Call struct {
+	Operation  Operation
+	Location   string
+	SecretName string
+	// SecretKey is set for OperationGetSecret
+	SecretKey string
+	// Version is set for the version operations
+	Version string
+}
+
+// Interceptor is called around every call made through a secret manager decorated with Intercept. It must call invoke
+// to make the call, possibly with a different context, and return its error or return an error without calling
+// invoke to reject the call
+type Interceptor func(ctx context.Context, call *Call, invoke func(ctx context.Context) error) error
+
+// defaultListPageSize is the number of secrets fetched per intercepted call when ListOptions does not set PageSize
+const defaultListPageSize = 100
+
+// Intercept creates a middleware calling interceptor around every call. Listing secrets is intercepted once per
+// page of secrets fetched so the secrets are still fetched lazily. A page continues from where the previous page
+// stopped, so an interceptor cannot retry a page by calling invoke again. The decorated secret manager implements
+// VersionInterface and WatchInterface only if the one it decorates does
+func Intercept(interceptor Interceptor) Middleware {
+	return func(next Interface) Interface {
+		store := &interceptedStore{next: next, interceptor: interceptor}
+		_, versioned := next.(VersionInterface)
+		_, watcher := next.(WatchInterface)
+		switch {
+		case versioned && watcher:
+			return &interceptedVersionWatchStore{interceptedStore: store, interceptedVersions: interceptedVersions{store}, interceptedWatch: interceptedWatch{store}}
+		case versioned:
+			return &interceptedVersions{store}
+		case watcher:
+			return &interceptedWatch{store}
+		}
+		return store
+	}
+}
+
+type interceptedStore struct {
+	next        Interface
+	interceptor Interceptor
+}
+
+// interceptedVersions intercepts the calls of a secret manager implementing VersionInterface
+type interceptedVersions struct {
+	*interceptedStore
+}
+
+// interceptedWatch intercepts the calls of a secret manager implementing WatchInterface
+type interceptedWatch struct {
+	*interceptedStore
+}
+
+// interceptedVersionWatchStore intercepts the calls of a secret manager implementing both VersionInterface and
+// WatchInterface
+type interceptedVersionWatchStore struct {
+	*interceptedStore
+	interceptedVersions
+	interceptedWatch
+}
+
+func (s *interceptedStore) GetSecret(location, secretName, secretKey string) (string, error) {
+	return s.GetSecretWithContext(context.Background(), location, secretName, secretKey)
+}
+
+func (s *interceptedStore) GetSecretWithContext(ctx context.Context, location, secretName, secretKey string) (string, error) {
+	call := &Call{Operation: OperationGetSecret, Location: location, SecretName: secretName, SecretKey: secretKey}
+	var value string
+	err := s.interceptor(ctx, call, func(ctx context.Context) error {
+		var err error
+		value, err = s.next.GetSecretWithContext(ctx, location, secretName, secretKey)
+		return err
+	})
+	return value, err
+}
+
+func (s *interceptedStore) GetSecretValue(ctx context.Context, location, secretName string) (*SecretValue, error) {
+	call := &Call{Operation: OperationGetSecretValue, Location: location, SecretName: secretName}
+	var value *SecretValue
+	err := s.interceptor(ctx, call, func(ctx context.Context) error {
+		var err error
+		value, err = s.next.GetSecretValue(ctx, location, secretName)
+		return err
+	})
+	return value, err
+}
+
+func (s *interceptedStore) SetSecret(location, secretName string, secretValue *SecretValue) error {
+	return s.SetSecretWithContext(context.Background(), location, secretName, secretValue)
+}
+
+func (s *interceptedStore) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *SecretValue) error {
+	call := &Call{Operation: OperationSetSecret, Location: location, SecretName: secretName}
+	return s.interceptor(ctx, call, func(ctx context.Context) error {
+		return s.next.SetSecretWithContext(ctx, location, secretName, secretValue)
+	})
+}
+
+func (s *interceptedStore) DeleteSecret(ctx context.Context, location, secretName string, options *DeleteOptions) error {
+	call := &Call{Operation: OperationDeleteSecret, Location: location, SecretName: secretName}
+	return s.interceptor(ctx, call, func(ctx context.Context) error {
+		return s.next.DeleteSecret(ctx, location, secretName, options)
+	})
+}
+
+func (s *interceptedStore) ListSecrets(ctx context.Context, location string, options *ListOptions) *SecretIterator {
+	pageSize := options.GetPageSize()
+	if pageSize <= 0 {
+		pageSize = defaultListPageSize
+	}
+	call := &Call{Operation: OperationListSecrets, Location: location}
+	var it *SecretIterator
+	return NewSecretIterator(ctx, "", func(pageCtx context.Context, _ string) ([]SecretInfo, string, error) {
+		var page []SecretInfo
+		more := false
+		err := s.interceptor(pageCtx, call, func(context.Context) error {
+			page = nil
+			more = false
+			// the underlying iterator keeps the context it is created with for every page, so it is created with the
+			// context of the iterator rather than one an interceptor may cancel once the page is fetched
+			if it == nil {
+				it = s.next.ListSecrets(ctx, location, options)
+			}
+			for len(page) < pageSize {
+				info, err := it.Next()
+				if errors.Is(err, ErrIteratorDone) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				page = append(page, *info)
+			}
+			more = true
+			return nil
+		})
+		if err != nil || !more {
+			return page, "", err
+		}
+		return page, "more", nil
+	})
+}
+
+func (s interceptedVersions) ListSecretVersions(ctx context.Context, location, secretName string) ([]SecretVersion, error) {
+	versioned := s.next.(VersionInterface)
+	call := &Call{Operation: OperationListSecretVersions, Location: location, SecretName: secretName}
+	var versions []SecretVersion
+	err := s.interceptor(ctx, call, func(ctx context.Context) error {
+		var err error
+		versions, err = versioned.ListSecretVersions(ctx, location, secretName)
+		return err
+	})
+	return versions, err
+}
+
+func (s interceptedVersions) GetSecretVersion(ctx context.Context, location, secretName, version string) (*SecretValue, error) {
+	versioned := s.next.(VersionInterface)
+	call := &Call{Operation: OperationGetSecretVersion, Location: location, SecretName: secretName, Version: version}
+	var value *SecretValue
+	err := s.interceptor(ctx, call, func(ctx context.Context) error {
+		var err error
+		value, err = versioned.GetSecretVersion(ctx, location, secretName, version)
+		return err
+	})
+	return value, err
+}
+
+func (s interceptedVersions) DisableSecretVersion(ctx context.Context, location, secretName, version string) error {
+	versioned := s.next.(VersionInterface)
+	call := &Call{Operation: OperationDisableSecretVersion, Location: location, SecretName: secretName, Version: version}
+	return s.interceptor(ctx, call, func(ctx context.Context) error {
+		return versioned.DisableSecretVersion(ctx, location, secretName, version)
+	})
+}
+
+func (s interceptedVersions) DestroySecretVersion(ctx context.Context, location, secretName, version string) error {
+	versioned := s.next.(VersionInterface)
+	call := &Call{Operation: OperationDestroySecretVersion, Location: location, SecretName: secretName, Version: version}
+	return s.interceptor(ctx, call, func(ctx context.Context) error {
+		return versioned.DestroySecretVersion(ctx, location, secretName, version)
+	})
+}
+
+// Watch intercepts starting the watch, the events it sends are not intercepted
+func (s interceptedWatch) Watch(ctx context.Context, location, secretName string, options *WatchOptions) (<-chan WatchEvent, error) {
+	watcher := s.next.(WatchInterface)
+	call := &Call{Operation: OperationWatch, Location: location, SecretName: secretName}
+	var events <-chan WatchEvent
+	err := s.interceptor(ctx, call, func(context.Context) error {
+		// the watch outlives the call so it is started with the context of the caller rather than one an interceptor
+		// may cancel once the call returns
+		var err error
+		events, err = watcher.Watch(ctx, location, secretName, options)
+		return err
+	})
+	return events, err
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/sirupsen/logrus"
+)
+
+// Logging logs every call made to the secret manager at debug level and failed calls at warn level. Secret values
+// are never logged
+func Logging(logger logrus.FieldLogger) secretstore.Middleware {
+	return secretstore.Intercept(func(ctx context.Context, call *secretstore.Call, invoke func(ctx context.Context) error) error {
+		start := time.Now()
+		err := invoke(ctx)
+		entry := logger.WithFields(logrus.Fields{
+			"operation": call.Operation,
+			"location":  call.Location,
+			"duration":  time.Since(start),
+		})
+		if call.SecretName != "" {
+			entry = entry.WithField("secret", call.SecretName)
+		}
+		if call.SecretKey != "" {
+			entry = entry.WithField("key", call.SecretKey)
+		}
+		if call.Version != "" {
+			entry = entry.WithField("version", call.Version)
+		}
+		if err != nil {
+			entry.WithError(err).Warnf("secret store call %s failed", call.Operation)
+			return err
+		}
+		entry.Debugf("secret store call %s succeeded", call.Operation)
+		return nil
+	})
+}
+
+// AccessControl rejects calls for which allow returns false with a secretstore.ErrPermissionDenied error without
+// calling the secret store
+func AccessControl(allow func(ctx context.Context, call *secretstore.Call) bool) secretstore.Middleware {
+	return secretstore.Intercept(func(ctx context.Context, call *secretstore.Call, invoke func(ctx context.Context) error) error {
+		if !allow(ctx, call) {
+			return secretstore.NewError(secretstore.ErrPermissionDenied, call.Location, call.SecretName,
+				fmt.Errorf("%s denied by access control", call.Operation))
+		}
+		return invoke(ctx)
+	})
+}
+
+// AllowLocations returns an allow function for AccessControl which only permits calls to the locations
+func AllowLocations(locations ...string) func(ctx context.Context, call *secretstore.Call) bool {
+	allowed := map[string]bool{}
+	for _, location := range locations {
+		allowed[location] = true
+	}
+	return func(_ context.Context, call *secretstore.Call) bool {
+		return allowed[call.Location]
+	}
+}
+
+// ReadOnly rejects every call which would modify the secret store with a secretstore.ErrReadOnly error
+func ReadOnly() secretstore.Middleware {
+	return secretstore.Intercept(func(ctx context.Context, call *secretstore.Call, invoke func(ctx context.Context) error) error {
+		if call.Operation.IsWrite() {
+			return secretstore.NewError(secretstore.ErrReadOnly, call.Location, call.SecretName,
+				fmt.Errorf("%s rejected", call.Operation))
+		}
+		return invoke(ctx)
+	})
+}
+
+// Timeout limits the duration of every call made to the secret store
+func Timeout(timeout time.Duration) secretstore.Middleware {
+	return secretstore.Intercept(func(ctx context.Context, _ *secretstore.Call, invoke func(ctx context.Context) error) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return invoke(ctx)
+	})
+}
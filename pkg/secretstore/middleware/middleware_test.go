@@ -0,0 +1,88 @@
+//go:build unit
+// +build unit
+
+package middleware_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/middleware"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogging(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	mgr := secretstore.Chain(fake.NewFakeSecretStore(), middleware.Logging(logger))
+
+	require.NoError(t, mgr.SetSecret("loc", "db", &secretstore.SecretValue{Value: "super-secret"}))
+	_, err := mgr.GetSecret("loc", "missing", "key")
+	require.Error(t, err)
+
+	require.Len(t, hook.AllEntries(), 2)
+	set := hook.AllEntries()[0]
+	assert.Equal(t, logrus.DebugLevel, set.Level)
+	assert.Equal(t, secretstore.OperationSetSecret, set.Data["operation"])
+	assert.Equal(t, "db", set.Data["secret"])
+	failed := hook.LastEntry()
+	assert.Equal(t, logrus.WarnLevel, failed.Level)
+	assert.Equal(t, "key", failed.Data["key"])
+	for _, entry := range hook.AllEntries() {
+		line, err := entry.String()
+		require.NoError(t, err)
+		assert.NotContains(t, line, "super-secret")
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("allowed", "db", &secretstore.SecretValue{Value: "pwd"}))
+	require.NoError(t, store.SetSecret("denied", "db", &secretstore.SecretValue{Value: "pwd"}))
+	mgr := secretstore.Chain(store, middleware.AccessControl(middleware.AllowLocations("allowed")))
+
+	value, err := mgr.GetSecret("allowed", "db", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "pwd", value)
+	_, err = mgr.GetSecret("denied", "db", "")
+	assert.ErrorIs(t, err, secretstore.ErrPermissionDenied)
+}
+
+func TestTimeout(t *testing.T) {
+	var deadline time.Time
+	var hasDeadline bool
+	probe := secretstore.Intercept(func(ctx context.Context, _ *secretstore.Call, invoke func(ctx context.Context) error) error {
+		deadline, hasDeadline = ctx.Deadline()
+		return invoke(ctx)
+	})
+	mgr := secretstore.Chain(fake.NewFakeSecretStore(), middleware.Timeout(time.Minute), probe)
+
+	require.NoError(t, mgr.SetSecret("loc", "db", &secretstore.SecretValue{Value: "pwd"}))
+
+	assert.True(t, hasDeadline)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+}
+
+func TestReadOnly(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{Value: "pwd"}))
+	mgr := secretstore.Chain(store, middleware.ReadOnly())
+
+	value, err := mgr.GetSecret("loc", "db", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "pwd", value)
+	err = mgr.SetSecret("loc", "db", &secretstore.SecretValue{Value: "changed"})
+	assert.ErrorIs(t, err, secretstore.ErrReadOnly)
+	err = mgr.DeleteSecret(context.Background(), "loc", "db", nil)
+	assert.ErrorIs(t, err, secretstore.ErrReadOnly)
+
+	value, err = store.GetSecret("loc", "db", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "pwd", value)
+}
@@ -0,0 +1,139 @@
+//go:build unit
+// +build unit
+
+package secretstore_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingInterceptor records the calls it sees, prefixed with name
+func recordingInterceptor(name string, calls *[]string) secretstore.Middleware {
+	return secretstore.Intercept(func(ctx context.Context, call *secretstore.Call, invoke func(ctx context.Context) error) error {
+		*calls = append(*calls, fmt.Sprintf("%s:%s %s/%s", name, call.Operation, call.Location, call.SecretName))
+		return invoke(ctx)
+	})
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	mgr := secretstore.Chain(fake.NewFakeSecretStore(), recordingInterceptor("outer", &calls), recordingInterceptor("inner", &calls))
+
+	require.NoError(t, mgr.SetSecret("loc", "db", &secretstore.SecretValue{Value: "pwd"}))
+	value, err := mgr.GetSecret("loc", "db", "")
+	require.NoError(t, err)
+	assert.Equal(t, "pwd", value)
+
+	assert.Equal(t, []string{
+		"outer:SetSecret loc/db",
+		"inner:SetSecret loc/db",
+		"outer:GetSecret loc/db",
+		"inner:GetSecret loc/db",
+	}, calls)
+}
+
+func TestInterceptorCanRejectCalls(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+	readOnly := secretstore.Intercept(func(ctx context.Context, call *secretstore.Call, invoke func(ctx context.Context) error) error {
+		if call.Operation.IsWrite() {
+			return secretstore.NewError(secretstore.ErrPermissionDenied, call.Location, call.SecretName, nil)
+		}
+		return invoke(ctx)
+	})
+	mgr := secretstore.Chain(store, readOnly)
+
+	err := mgr.SetSecret("loc", "db", &secretstore.SecretValue{Value: "pwd"})
+
+	assert.ErrorIs(t, err, secretstore.ErrPermissionDenied)
+	_, err = store.GetSecret("loc", "db", "")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+}
+
+func TestInterceptListSecretsPerPage(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, store.SetSecret("loc", name, &secretstore.SecretValue{Value: name}))
+	}
+	var calls []string
+	mgr := secretstore.Chain(store, recordingInterceptor("mw", &calls))
+
+	names, err := mgr.ListSecrets(context.Background(), "loc", &secretstore.ListOptions{PageSize: 2}).Names()
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, names)
+	assert.Len(t, calls, 3)
+}
+
+// versionedStore adds fixed versions to a secret manager, hiding its Watch method
+type versionedStore struct {
+	secretstore.Interface
+}
+
+func (versionedStore) ListSecretVersions(context.Context, string, string) ([]secretstore.SecretVersion, error) {
+	return []secretstore.SecretVersion{{Version: "1"}}, nil
+}
+
+func (versionedStore) GetSecretVersion(context.Context, string, string, string) (*secretstore.SecretValue, error) {
+	return &secretstore.SecretValue{Version: "1"}, nil
+}
+
+func (versionedStore) DisableSecretVersion(context.Context, string, string, string) error {
+	return nil
+}
+
+func (versionedStore) DestroySecretVersion(context.Context, string, string, string) error {
+	return nil
+}
+
+func TestInterceptKeepsOptionalInterfaces(t *testing.T) {
+	var calls []string
+	mgr := secretstore.Chain(fake.NewFakeSecretStore(), recordingInterceptor("mw", &calls))
+	_, err := secretstore.AsVersionInterface(mgr)
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+	_, err = secretstore.AsWatchInterface(mgr)
+	assert.NoError(t, err)
+
+	mgr = secretstore.Chain(versionedStore{fake.NewFakeSecretStore()}, recordingInterceptor("mw", &calls))
+	_, err = secretstore.AsWatchInterface(mgr)
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+	versioned, err := secretstore.AsVersionInterface(mgr)
+	require.NoError(t, err)
+	versions, err := versioned.ListSecretVersions(context.Background(), "loc", "db")
+	require.NoError(t, err)
+	assert.Len(t, versions, 1)
+	assert.Equal(t, []string{"mw:ListSecretVersions loc/db"}, calls)
+
+	mgr = secretstore.Chain(struct {
+		versionedStore
+		secretstore.WatchInterface
+	}{versionedStore{fake.NewFakeSecretStore()}, fake.NewFakeSecretStore()}, recordingInterceptor("mw", &calls))
+	_, err = secretstore.AsVersionInterface(mgr)
+	assert.NoError(t, err)
+	_, err = secretstore.AsWatchInterface(mgr)
+	assert.NoError(t, err)
+}
+
+func TestInterceptListSecretsPageRetry(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, store.SetSecret("loc", name, &secretstore.SecretValue{Value: name}))
+	}
+	// invoke continues from where the previous call stopped, so calling it again skips rather than repeats secrets
+	twice := secretstore.Intercept(func(ctx context.Context, _ *secretstore.Call, invoke func(ctx context.Context) error) error {
+		_ = invoke(ctx)
+		return invoke(ctx)
+	})
+	mgr := secretstore.Chain(store, twice)
+
+	names, err := mgr.ListSecrets(context.Background(), "loc", &secretstore.ListOptions{PageSize: 2}).Names()
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, names)
+}
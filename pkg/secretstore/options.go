@@ -0,0 +1,38 @@
+package secretstore
+
+// DeleteOptions controls how a secret is deleted. A nil *DeleteOptions uses the defaults of the secret store and
+// options which do not apply to a secret store are ignored
+type DeleteOptions struct {
+	// RecoveryWindowInDays is the number of days AWS Secrets Manager waits before permanently deleting the secret,
+	// zero uses the AWS default of 30 days
+	RecoveryWindowInDays int64
+	// ForceDeleteWithoutRecovery deletes an AWS Secrets Manager secret immediately without a recovery window
+	ForceDeleteWithoutRecovery bool
+	// Purge permanently removes the secret rather than soft deleting it. For Azure Key Vault the deleted secret is
+	// purged and for Hashicorp Vault KV v2 all versions and metadata of the secret are removed
+	Purge bool
+}
+
+// ListOptions filters the secrets returned by ListSecrets. A nil *ListOptions lists every secret in the location
+type ListOptions struct {
+	// Prefix only returns secrets whose name starts with the prefix
+	Prefix string
+	// PageSize is the number of secrets requested per call to the secret store, zero uses the store default
+	PageSize int
+}
+
+// GetPrefix returns the prefix, handling nil options
+func (o *ListOptions) GetPrefix() string {
+	if o == nil {
+		return ""
+	}
+	return o.Prefix
+}
+
+// GetPageSize returns the page size, handling nil options
+func (o *ListOptions) GetPageSize() int {
+	if o == nil {
+		return 0
+	}
+	return o.PageSize
+}
@@ -0,0 +1,313 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+)
+
+const (
+	// DefaultMaxAttempts is the number of attempts made when Options does not set MaxAttempts
+	DefaultMaxAttempts = 5
+	// DefaultInitialInterval is the delay before the first retry when Options does not set InitialInterval
+	DefaultInitialInterval = 100 * time.Millisecond
+	// DefaultMaxInterval is the maximum delay between attempts when Options does not set MaxInterval
+	DefaultMaxInterval = 10 * time.Second
+	// DefaultMultiplier is the factor the delay grows by after each attempt when Options does not set Multiplier
+	DefaultMultiplier = 2.0
+	// DefaultJitter is the fraction of the delay randomised when Options does not set Jitter
+	DefaultJitter = 0.2
+)
+
+// Options configures the retries. A nil *Options uses the defaults
+type Options struct {
+	// MaxAttempts is the maximum number of attempts including the first one
+	MaxAttempts int
+	// InitialInterval is the delay before the first retry
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between attempts
+	MaxInterval time.Duration
+	// Multiplier is the factor the delay grows by after each attempt
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, of each delay which is randomised so that clients retrying at the same
+	// time spread out. Set it to a negative value to disable jitter
+	Jitter float64
+	// Retryable decides whether an error is retried, it defaults to IsRetryable
+	Retryable func(err error) bool
+	// OnRetry is called before waiting to retry a failed attempt, attempt is the number of the attempt which failed
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+func (o *Options) maxAttempts() int {
+	if o == nil || o.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return o.MaxAttempts
+}
+
+func (o *Options) retryable(err error) bool {
+	if o == nil || o.Retryable == nil {
+		return IsRetryable(err)
+	}
+	return o.Retryable(err)
+}
+
+// delay returns the delay after the attempt failed
+func (o *Options) delay(attempt int) time.Duration {
+	initial, maxInterval, multiplier, jitter := DefaultInitialInterval, DefaultMaxInterval, DefaultMultiplier, DefaultJitter
+	if o != nil {
+		if o.InitialInterval > 0 {
+			initial = o.InitialInterval
+		}
+		if o.MaxInterval > 0 {
+			maxInterval = o.MaxInterval
+		}
+		if o.Multiplier > 0 {
+			multiplier = o.Multiplier
+		}
+		if o.Jitter != 0 {
+			jitter = o.Jitter
+		}
+	}
+
+	delay := float64(initial)
+	for i := 1; i < attempt && delay < float64(maxInterval); i++ {
+		delay *= multiplier
+	}
+	if delay > float64(maxInterval) {
+		delay = float64(maxInterval)
+	}
+	if jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		delay += delay * jitter * (2*rand.Float64() - 1) //nolint:gosec
+	}
+	return time.Duration(delay)
+}
+
+// IsRetryable returns true for errors the secret managers classify as secretstore.ErrTransient and for network
+// timeouts which the secret managers do not classify
+func IsRetryable(err error) bool {
+	if secretstore.IsTransient(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// ExhaustedError is returned when every attempt failed with a retryable error
+type ExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("giving up after %d attempts: %s", e.Attempts, e.Err)
+}
+
+func (e *ExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// Do calls fn until it succeeds, returns an error which is not retryable, the attempts are exhausted or ctx is done.
+// It returns the number of attempts made
+func Do(ctx context.Context, options *Options, fn func(ctx context.Context) error) (int, error) {
+	return do(ctx, options, sleep, fn)
+}
+
+func do(ctx context.Context, options *Options, sleep func(ctx context.Context, d time.Duration) error, fn func(ctx context.Context) error) (int, error) {
+	maxAttempts := options.maxAttempts()
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !options.retryable(err) {
+			return attempt, err
+		}
+		if attempt >= maxAttempts {
+			return attempt, &ExhaustedError{Attempts: attempt, Err: err}
+		}
+		delay := options.delay(attempt)
+		if options != nil && options.OnRetry != nil {
+			options.OnRetry(attempt, err, delay)
+		}
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return attempt, fmt.Errorf("%w: last error: %w", sleepErr, err)
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// SecretStore retries the calls made to another secret manager which fail with a retryable error. ListSecrets is not
+// retried as the iterator fetches its pages lazily
+type SecretStore struct {
+	secretstore.Interface
+	options *Options
+	sleep   func(ctx context.Context, d time.Duration) error
+	retries uint64
+}
+
+// NewSecretStore creates a SecretStore retrying the calls made to mgr. The SecretStore does not implement
+// VersionInterface or WatchInterface, use Manager to get a secret manager which does when mgr does
+func NewSecretStore(mgr secretstore.Interface, options *Options) *SecretStore {
+	return &SecretStore{
+		Interface: mgr,
+		options:   options,
+		sleep:     sleep,
+	}
+}
+
+// Retries returns the total number of retries made by the SecretStore
+func (r *SecretStore) Retries() uint64 {
+	return atomic.LoadUint64(&r.retries)
+}
+
+func (r *SecretStore) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	attempts, err := do(ctx, r.options, r.sleep, fn)
+	atomic.AddUint64(&r.retries, uint64(attempts-1))
+	return err
+}
+
+func (r *SecretStore) GetSecret(location, secretName, secretKey string) (string, error) {
+	return r.GetSecretWithContext(context.Background(), location, secretName, secretKey)
+}
+
+func (r *SecretStore) GetSecretWithContext(ctx context.Context, location, secretName, secretKey string) (string, error) {
+	var value string
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		value, err = r.Interface.GetSecretWithContext(ctx, location, secretName, secretKey)
+		return err
+	})
+	return value, err
+}
+
+func (r *SecretStore) GetSecretValue(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	var value *secretstore.SecretValue
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		value, err = r.Interface.GetSecretValue(ctx, location, secretName)
+		return err
+	})
+	return value, err
+}
+
+func (r *SecretStore) SetSecret(location, secretName string, secretValue *secretstore.SecretValue) error {
+	return r.SetSecretWithContext(context.Background(), location, secretName, secretValue)
+}
+
+func (r *SecretStore) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	return r.do(ctx, func(ctx context.Context) error {
+		return r.Interface.SetSecretWithContext(ctx, location, secretName, secretValue)
+	})
+}
+
+func (r *SecretStore) DeleteSecret(ctx context.Context, location, secretName string, options *secretstore.DeleteOptions) error {
+	return r.do(ctx, func(ctx context.Context) error {
+		return r.Interface.DeleteSecret(ctx, location, secretName, options)
+	})
+}
+
+// Manager returns the SecretStore as a secret manager which implements VersionInterface and WatchInterface only if the
+// secret manager it retries does
+func (r *SecretStore) Manager() secretstore.Interface {
+	_, versioned := r.Interface.(secretstore.VersionInterface)
+	_, watcher := r.Interface.(secretstore.WatchInterface)
+	switch {
+	case versioned && watcher:
+		return &retriedVersionWatchStore{SecretStore: r, retriedVersions: retriedVersions{r}, retriedWatch: retriedWatch{r}}
+	case versioned:
+		return &retriedVersions{r}
+	case watcher:
+		return &retriedWatch{r}
+	}
+	return r
+}
+
+// retriedVersions retries the calls made to a secret manager implementing VersionInterface
+type retriedVersions struct {
+	*SecretStore
+}
+
+// retriedWatch retries the calls made to a secret manager implementing WatchInterface
+type retriedWatch struct {
+	*SecretStore
+}
+
+// retriedVersionWatchStore retries the calls made to a secret manager implementing both VersionInterface and
+// WatchInterface
+type retriedVersionWatchStore struct {
+	*SecretStore
+	retriedVersions
+	retriedWatch
+}
+
+func (r retriedVersions) ListSecretVersions(ctx context.Context, location, secretName string) ([]secretstore.SecretVersion, error) {
+	versioned := r.Interface.(secretstore.VersionInterface)
+	var versions []secretstore.SecretVersion
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		versions, err = versioned.ListSecretVersions(ctx, location, secretName)
+		return err
+	})
+	return versions, err
+}
+
+func (r retriedVersions) GetSecretVersion(ctx context.Context, location, secretName, version string) (*secretstore.SecretValue, error) {
+	versioned := r.Interface.(secretstore.VersionInterface)
+	var value *secretstore.SecretValue
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		value, err = versioned.GetSecretVersion(ctx, location, secretName, version)
+		return err
+	})
+	return value, err
+}
+
+func (r retriedVersions) DisableSecretVersion(ctx context.Context, location, secretName, version string) error {
+	versioned := r.Interface.(secretstore.VersionInterface)
+	return r.do(ctx, func(ctx context.Context) error {
+		return versioned.DisableSecretVersion(ctx, location, secretName, version)
+	})
+}
+
+func (r retriedVersions) DestroySecretVersion(ctx context.Context, location, secretName, version string) error {
+	versioned := r.Interface.(secretstore.VersionInterface)
+	return r.do(ctx, func(ctx context.Context) error {
+		return versioned.DestroySecretVersion(ctx, location, secretName, version)
+	})
+}
+
+// Middleware returns a secretstore.Middleware retrying the calls made to the secret manager it decorates
+func Middleware(options *Options) secretstore.Middleware {
+	return func(next secretstore.Interface) secretstore.Interface {
+		return NewSecretStore(next, options).Manager()
+	}
+}
+
+func (r retriedWatch) Watch(ctx context.Context, location, secretName string, options *secretstore.WatchOptions) (<-chan secretstore.WatchEvent, error) {
+	watcher := r.Interface.(secretstore.WatchInterface)
+	var events <-chan secretstore.WatchEvent
+	err := r.do(ctx, func(context.Context) error {
+		// the watch outlives the attempt so it is started with the context of the caller
+		var err error
+		events, err = watcher.Watch(ctx, location, secretName, options)
+		return err
+	})
+	return events, err
+}
@@ -0,0 +1,130 @@
+//go:build unit
+// +build unit
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStore fails the first failures calls to GetSecretWithContext with err
+type flakyStore struct {
+	secretstore.Interface
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyStore) GetSecretWithContext(ctx context.Context, location, secretName, secretKey string) (string, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return "", f.err
+	}
+	return f.Interface.GetSecretWithContext(ctx, location, secretName, secretKey)
+}
+
+func newTestStore(t *testing.T, failures int, err error, options *Options) (*SecretStore, *flakyStore, *[]time.Duration) {
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "pwd"}}))
+	flaky := &flakyStore{Interface: store, failures: failures, err: err}
+	r := NewSecretStore(flaky, options)
+	var delays []time.Duration
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+	return r, flaky, &delays
+}
+
+func TestRetriesTransientErrors(t *testing.T) {
+	transient := secretstore.NewError(secretstore.ErrTransient, "loc", "db", errors.New("throttled"))
+	var retried []int
+	r, flaky, delays := newTestStore(t, 3, transient, &Options{
+		InitialInterval: time.Second,
+		Jitter:          -1,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			retried = append(retried, attempt)
+		},
+	})
+
+	value, err := r.GetSecret("loc", "db", "password")
+
+	require.NoError(t, err)
+	assert.Equal(t, "pwd", value)
+	assert.Equal(t, 4, flaky.calls)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, *delays)
+	assert.Equal(t, []int{1, 2, 3}, retried)
+	assert.EqualValues(t, 3, r.Retries())
+}
+
+func TestDoesNotRetryPermanentErrors(t *testing.T) {
+	r, flaky, _ := newTestStore(t, 0, nil, nil)
+
+	_, err := r.GetSecret("loc", "missing", "")
+
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+	assert.Equal(t, 1, flaky.calls)
+	assert.EqualValues(t, 0, r.Retries())
+}
+
+func TestGivesUpAfterMaxAttempts(t *testing.T) {
+	transient := secretstore.NewError(secretstore.ErrTransient, "loc", "db", errors.New("unavailable"))
+	r, flaky, _ := newTestStore(t, 10, transient, &Options{MaxAttempts: 3})
+
+	_, err := r.GetSecret("loc", "db", "password")
+
+	var exhausted *ExhaustedError
+	require.True(t, errors.As(err, &exhausted))
+	assert.Equal(t, 3, exhausted.Attempts)
+	assert.ErrorIs(t, err, secretstore.ErrTransient)
+	assert.Equal(t, 3, flaky.calls)
+}
+
+func TestStopsWhenContextDone(t *testing.T) {
+	transient := secretstore.NewError(secretstore.ErrTransient, "loc", "db", errors.New("unavailable"))
+	r, flaky, _ := newTestStore(t, 10, transient, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := r.GetSecretWithContext(ctx, "loc", "db", "password")
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, secretstore.ErrTransient)
+	assert.Equal(t, 1, flaky.calls)
+}
+
+func TestDelay(t *testing.T) {
+	options := &Options{InitialInterval: time.Second, MaxInterval: 5 * time.Second, Multiplier: 3, Jitter: -1}
+	assert.Equal(t, time.Second, options.delay(1))
+	assert.Equal(t, 3*time.Second, options.delay(2))
+	assert.Equal(t, 5*time.Second, options.delay(3))
+	assert.Equal(t, 5*time.Second, options.delay(10))
+
+	options.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := options.delay(1)
+		assert.True(t, delay >= 500*time.Millisecond && delay <= 1500*time.Millisecond, delay)
+	}
+}
+
+func TestMiddlewareKeepsOptionalInterfaces(t *testing.T) {
+	mgr := Middleware(nil)(fake.NewFakeSecretStore())
+	_, err := secretstore.AsWatchInterface(mgr)
+	assert.NoError(t, err)
+	_, err = secretstore.AsVersionInterface(mgr)
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+
+	mgr = Middleware(nil)(&flakyStore{Interface: fake.NewFakeSecretStore()})
+	_, err = secretstore.AsWatchInterface(mgr)
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+	_, err = secretstore.AsVersionInterface(mgr)
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+}
@@ -11,13 +11,72 @@ import (
 type SecretValue struct {
 	Value          string
 	PropertyValues map[string]string
-	Annotations    map[string]string
-	Labels         map[string]string
+	// Annotations and Labels are read and written as the annotations and labels of Kubernetes and GCP secrets and are
+	// kept by the age store. AWS Secrets Manager and Azure Key Vault keep Labels as tags but have nowhere to keep
+	// Annotations, and the other stores keep neither
+	Annotations map[string]string
+	Labels      map[string]string
 
 	// SecretType is only really needed when using local secrets so that we
 	// can populate the Secret resource with the correct type
 	SecretType corev1.SecretType
-	Overwrite  bool
+	// Overwrite replaces the existing secret, including any properties, labels and annotations which are not in the
+	// new value. Otherwise PropertyValues, Labels and Annotations are merged in to those of the existing secret
+	Overwrite bool
+
+	// Version is the version of the secret that was read where the secret store supports versions. It is ignored when
+	// setting secrets
+	Version string
+	// ExpectedVersion makes setting the secret conditional on the secret not having changed since it was read. When
+	// set, the secret is only written if its current version, as returned in Version by GetSecretValue, matches and
+	// otherwise an ErrConflict error is returned. Secret stores which cannot write conditionally return ErrNotSupported
+	ExpectedVersion string
+	// CreateOnly makes setting the secret fail with an ErrAlreadyExists error, leaving the secret unchanged, if the
+	// secret already exists. Secret stores which cannot create secrets atomically return ErrNotSupported
+	CreateOnly bool
+}
+
+// NewSecretValueFromString parses a secret stored as a single string. A JSON object of strings, as written by SetSecret
+// for PropertyValues, populates PropertyValues and anything else populates Value
+func NewSecretValueFromString(s string) *SecretValue {
+	m := map[string]string{}
+	err := json.Unmarshal([]byte(s), &m)
+	if err != nil {
+		return &SecretValue{Value: s}
+	}
+	return &SecretValue{PropertyValues: m}
+}
+
+// GetProperty returns the value of the key, or Value if key is empty, and whether it was present
+func (sv *SecretValue) GetProperty(key string) (string, bool) {
+	if key == "" {
+		return sv.ToString(), true
+	}
+	v, ok := sv.PropertyValues[key]
+	return v, ok
+}
+
+// DeepCopy returns a copy of the secret value which shares no maps with the original
+func (sv *SecretValue) DeepCopy() *SecretValue {
+	if sv == nil {
+		return nil
+	}
+	c := *sv
+	c.PropertyValues = copyMap(sv.PropertyValues)
+	c.Annotations = copyMap(sv.Annotations)
+	c.Labels = copyMap(sv.Labels)
+	return &c
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
 }
 
 func (sv *SecretValue) ToString() string {
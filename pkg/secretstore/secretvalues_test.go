@@ -0,0 +1,54 @@
+//go:build unit
+// +build unit
+
+package secretstore_test
+
+import (
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSecretValueFromString(t *testing.T) {
+	testCases := []struct {
+		description string
+		stored      string
+		expected    *secretstore.SecretValue
+	}{
+		{
+			description: "plain value",
+			stored:      "supersecret",
+			expected:    &secretstore.SecretValue{Value: "supersecret"},
+		},
+		{
+			description: "property values",
+			stored:      `{"password":"pwd","username":"admin"}`,
+			expected:    &secretstore.SecretValue{PropertyValues: map[string]string{"username": "admin", "password": "pwd"}},
+		},
+		{
+			description: "JSON which is not an object of strings",
+			stored:      `{"port":5432}`,
+			expected:    &secretstore.SecretValue{Value: `{"port":5432}`},
+		},
+	}
+	for _, tc := range testCases {
+		secretValue := secretstore.NewSecretValueFromString(tc.stored)
+		assert.Equal(t, tc.expected, secretValue, tc.description)
+		assert.Equal(t, tc.stored, secretValue.ToString(), tc.description)
+	}
+}
+
+func TestDeepCopy(t *testing.T) {
+	original := &secretstore.SecretValue{
+		PropertyValues: map[string]string{"key": "value"},
+		Labels:         map[string]string{"app": "db"},
+	}
+	c := original.DeepCopy()
+	c.PropertyValues["key"] = "changed"
+	c.Labels["app"] = "changed"
+
+	assert.Equal(t, "value", original.PropertyValues["key"])
+	assert.Equal(t, "db", original.Labels["app"])
+	assert.Nil(t, c.Annotations)
+}
@@ -0,0 +1,444 @@
+package sopssecrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"gopkg.in/yaml.v3"
+)
+
+// metadataKey is the top level key sops keeps its metadata in
+const metadataKey = "sops"
+
+// exitCodeCouldNotRetrieveKey is the exit code of sops when none of the keys of a file can be used to decrypt it
+const exitCodeCouldNotRetrieveKey = 128
+
+// Runner runs sops with the arguments, passing stdin to it and returning what it writes to stdout
+type Runner func(ctx context.Context, stdin []byte, args ...string) ([]byte, error)
+
+// Options configures the sops secret manager
+type Options struct {
+	// Binary is the path of sops, defaults to sops on the PATH
+	Binary string
+	// AgeRecipients and PGPFingerprints are the keys new files are encrypted to. When neither is set sops uses the
+	// creation rules of the .sops.yaml file or the SOPS_AGE_RECIPIENTS and SOPS_PGP_FP environment variables. Existing
+	// files stay encrypted to their own keys
+	AgeRecipients   []string
+	PGPFingerprints []string
+	// Runner runs sops, defaults to running Binary
+	Runner Runner
+}
+
+// NewSopsSecretManager creates a secret manager for secrets in sops encrypted YAML or JSON files. The location is a
+// file, or a directory of files, and each top level key of a file is a secret. A secret holding a string has a Value
+// and a secret holding a map has PropertyValues. Labels, annotations and secret types are not stored. New secrets in a
+// directory are written to a file named after the secret
+func NewSopsSecretManager(options Options) secretstore.Interface {
+	if options.Binary == "" {
+		options.Binary = "sops"
+	}
+	if options.Runner == nil {
+		options.Runner = execRunner(options.Binary)
+	}
+	return sopsSecretManager{options}
+}
+
+type sopsSecretManager struct {
+	options Options
+}
+
+func (s sopsSecretManager) GetSecret(location, secretName, secretKey string) (string, error) {
+	return s.GetSecretWithContext(context.Background(), location, secretName, secretKey)
+}
+
+func (s sopsSecretManager) GetSecretWithContext(ctx context.Context, location, secretName, secretKey string) (string, error) {
+	secretValue, err := s.GetSecretValue(ctx, location, secretName)
+	if err != nil {
+		return "", err
+	}
+	value, ok := secretValue.GetProperty(secretKey)
+	if !ok {
+		return "", secretstore.NewKeyNotFoundError(location, secretName, secretKey)
+	}
+	return value, nil
+}
+
+func (s sopsSecretManager) GetSecretValue(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	path, exists, err := s.file(location, secretName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, secretstore.NewSecretNotFoundError(location, secretName)
+	}
+	secrets, err := s.decrypt(ctx, location, path)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := secrets[secretName]
+	if !ok {
+		return nil, secretstore.NewSecretNotFoundError(location, secretName)
+	}
+	return toSecretValue(value), nil
+}
+
+func (s sopsSecretManager) SetSecret(location, secretName string, secretValue *secretstore.SecretValue) error {
+	return s.SetSecretWithContext(context.Background(), location, secretName, secretValue)
+}
+
+func (s sopsSecretManager) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	if secretValue.ExpectedVersion != "" {
+		return fmt.Errorf("unable to set secret %s with an expected version in sops files: %w", secretName, secretstore.ErrNotSupported)
+	}
+	if secretValue.CreateOnly {
+		return fmt.Errorf("unable to create secret %s only if it does not exist in sops files: %w", secretName, secretstore.ErrNotSupported)
+	}
+	if secretName == metadataKey {
+		return fmt.Errorf("unable to set secret %s in %s as sops keeps its metadata in that key", secretName, location)
+	}
+	path, exists, err := s.file(location, secretName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return s.encrypt(ctx, location, path, map[string]interface{}{secretName: fromSecretValue(secretValue)})
+	}
+
+	value := fromSecretValue(secretValue)
+	if secretValue.Value == "" && !secretValue.Overwrite {
+		secrets, err := s.decrypt(ctx, location, path)
+		if err != nil {
+			return err
+		}
+		if existing, ok := secrets[secretName].(map[string]interface{}); ok {
+			value = mergeProperties(existing, secretValue.PropertyValues)
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error encoding secret %s: %w", secretName, err)
+	}
+	// the value is passed on stdin as arguments can be read by other users of the machine
+	_, err = s.run(ctx, location, secretName, data, "set", "--value-stdin", path, treePath(secretName))
+	if err != nil {
+		return fmt.Errorf("error setting secret %s in sops file %s: %w", secretName, path, err)
+	}
+	return nil
+}
+
+func (s sopsSecretManager) DeleteSecret(ctx context.Context, location, secretName string, _ *secretstore.DeleteOptions) error {
+	path, exists, err := s.file(location, secretName)
+	if err != nil {
+		return err
+	}
+	if exists {
+		keys, err := topLevelKeys(path)
+		if err != nil {
+			return err
+		}
+		exists = slices.Contains(keys, secretName)
+	}
+	if !exists {
+		return secretstore.NewSecretNotFoundError(location, secretName)
+	}
+	_, err = s.run(ctx, location, secretName, nil, "unset", path, treePath(secretName))
+	if err != nil {
+		return fmt.Errorf("error deleting secret %s from sops file %s: %w", secretName, path, err)
+	}
+	return nil
+}
+
+// ListSecrets lists the top level keys of the files of the location. The keys of sops files are not encrypted so
+// listing does not need to decrypt them
+func (s sopsSecretManager) ListSecrets(ctx context.Context, location string, options *secretstore.ListOptions) *secretstore.SecretIterator {
+	return secretstore.NewSecretIterator(ctx, options.GetPrefix(), func(context.Context, string) ([]secretstore.SecretInfo, string, error) {
+		files, err := s.files(location)
+		if err != nil {
+			return nil, "", err
+		}
+		var secrets []secretstore.SecretInfo
+		for _, path := range files {
+			keys, err := topLevelKeys(path)
+			if err != nil {
+				return nil, "", err
+			}
+			for _, key := range keys {
+				secrets = append(secrets, secretstore.SecretInfo{Name: key})
+			}
+		}
+		sort.Slice(secrets, func(i, j int) bool {
+			return secrets[i].Name < secrets[j].Name
+		})
+		return secrets, "", nil
+	})
+}
+
+// file returns the file holding the secret and whether the file exists. Secrets which do not exist in a directory
+// location are placed in a new file named after the secret
+func (s sopsSecretManager) file(location, secretName string) (string, bool, error) {
+	info, err := os.Stat(location)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if isSopsFile(location) {
+			return location, false, nil
+		}
+		path, err := secretFile(location, secretName)
+		return path, false, err
+	case err != nil:
+		return "", false, fmt.Errorf("error reading sops location %s: %w", location, err)
+	case !info.IsDir():
+		return location, true, nil
+	}
+
+	files, err := s.files(location)
+	if err != nil {
+		return "", false, err
+	}
+	for _, path := range files {
+		keys, err := topLevelKeys(path)
+		if err != nil {
+			return "", false, err
+		}
+		if slices.Contains(keys, secretName) {
+			return path, true, nil
+		}
+	}
+	path, err := secretFile(location, secretName)
+	if err != nil {
+		return "", false, err
+	}
+	_, err = os.Stat(path)
+	return path, err == nil, nil
+}
+
+// secretFile returns the file named after the secret in a directory location, rejecting names which would place the
+// file outside of the directory
+func secretFile(location, secretName string) (string, error) {
+	if strings.ContainsAny(secretName, `/\`) || strings.Contains(secretName, "..") {
+		return "", fmt.Errorf("invalid sops secret name %q, names cannot contain path separators or ..", secretName)
+	}
+	return filepath.Join(location, secretName+".yaml"), nil
+}
+
+// files returns the sops files of the location
+func (s sopsSecretManager) files(location string) ([]string, error) {
+	info, err := os.Stat(location)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading sops location %s: %w", location, err)
+	}
+	if !info.IsDir() {
+		return []string{location}, nil
+	}
+	entries, err := os.ReadDir(location)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sops location %s: %w", location, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isSopsFile(entry.Name()) {
+			files = append(files, filepath.Join(location, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// decrypt returns the decrypted top level keys of the file
+func (s sopsSecretManager) decrypt(ctx context.Context, location, path string) (map[string]interface{}, error) {
+	out, err := s.run(ctx, location, "", nil, "--decrypt", "--output-type", "json", path)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting sops file %s: %w", path, err)
+	}
+	// numbers are decoded as json.Number so that large integers are not rounded to a float64
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	decoder.UseNumber()
+	secrets := map[string]interface{}{}
+	err = decoder.Decode(&secrets)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing decrypted sops file %s: %w", path, err)
+	}
+	return secrets, nil
+}
+
+// encrypt creates a new sops file, the plain text is passed to sops on stdin so that it is never written to disk
+func (s sopsSecretManager) encrypt(ctx context.Context, location, path string, secrets map[string]interface{}) error {
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("error encoding sops file %s: %w", path, err)
+	}
+	args := []string{"--encrypt", "--input-type", "json", "--output-type", fileType(path), "--filename-override", path}
+	if len(s.options.AgeRecipients) > 0 {
+		args = append(args, "--age", strings.Join(s.options.AgeRecipients, ","))
+	}
+	if len(s.options.PGPFingerprints) > 0 {
+		args = append(args, "--pgp", strings.Join(s.options.PGPFingerprints, ","))
+	}
+	args = append(args, "/dev/stdin")
+	out, err := s.run(ctx, location, "", data, args...)
+	if err != nil {
+		return fmt.Errorf("error encrypting sops file %s: %w", path, err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return fmt.Errorf("error creating directory of sops file %s: %w", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("error writing sops file %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(out)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing sops file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s sopsSecretManager) run(ctx context.Context, location, secretName string, stdin []byte, args ...string) ([]byte, error) {
+	out, err := s.options.Runner(ctx, stdin, args...)
+	if err != nil {
+		return nil, classifyError(location, secretName, err)
+	}
+	return out, nil
+}
+
+func execRunner(binary string) Runner {
+	return func(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		cmd := exec.CommandContext(ctx, binary, args...)
+		cmd.Stdin = bytes.NewReader(stdin)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		err := cmd.Run()
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %s: %w", binary, args[0], strings.TrimSpace(stderr.String()), err)
+		}
+		return stdout.Bytes(), nil
+	}
+}
+
+func classifyError(location, secretName string, err error) error {
+	var kind error
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == exitCodeCouldNotRetrieveKey {
+		kind = secretstore.ErrPermissionDenied
+	}
+	return secretstore.NewError(kind, location, secretName, err)
+}
+
+// topLevelKeys returns the names of the secrets in a sops file, without decrypting it
+func topLevelKeys(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sops file %s: %w", path, err)
+	}
+	// JSON is valid YAML so both kinds of file can be parsed as YAML
+	m := map[string]interface{}{}
+	err = yaml.Unmarshal(data, &m)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sops file %s: %w", path, err)
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if k != metadataKey {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func toSecretValue(value interface{}) *secretstore.SecretValue {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return &secretstore.SecretValue{Value: toString(value)}
+	}
+	properties := make(map[string]string, len(m))
+	for k, v := range m {
+		properties[k] = toString(v)
+	}
+	return &secretstore.SecretValue{PropertyValues: properties}
+}
+
+// toString converts a decrypted value to a string, values which are not scalars are encoded as JSON
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func fromSecretValue(secretValue *secretstore.SecretValue) interface{} {
+	if secretValue.Value != "" {
+		return secretValue.Value
+	}
+	properties := make(map[string]interface{}, len(secretValue.PropertyValues))
+	for k, v := range secretValue.PropertyValues {
+		properties[k] = v
+	}
+	return properties
+}
+
+func mergeProperties(existing map[string]interface{}, properties map[string]string) map[string]interface{} {
+	merged := make(map[string]interface{}, len(existing)+len(properties))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range properties {
+		merged[k] = v
+	}
+	return merged
+}
+
+// treePath returns the sops tree path of a top level key, such as ["db-creds"]
+func treePath(key string) string {
+	data, _ := json.Marshal(key)
+	return "[" + string(data) + "]"
+}
+
+func isSopsFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+func fileType(path string) string {
+	if filepath.Ext(path) == ".json" {
+		return "json"
+	}
+	return "yaml"
+}
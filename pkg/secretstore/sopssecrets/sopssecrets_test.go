@@ -0,0 +1,181 @@
+//go:build unit
+// +build unit
+
+package sopssecrets_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/sopssecrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// fakeSops emulates the sops commands used by the secret manager, files are kept in plain text with a sops key
+// recording the recipients they were encrypted to
+type fakeSops struct {
+	t        *testing.T
+	commands []string
+	// args are the arguments of the set and unset commands
+	args []string
+}
+
+func (f *fakeSops) run(_ context.Context, stdin []byte, args ...string) ([]byte, error) {
+	f.commands = append(f.commands, args[0])
+	switch args[0] {
+	case "--decrypt":
+		m := f.read(args[len(args)-1])
+		delete(m, "sops")
+		return json.Marshal(m)
+	case "--encrypt":
+		m := map[string]interface{}{}
+		require.NoError(f.t, json.Unmarshal(stdin, &m))
+		recipients := ""
+		for i, arg := range args {
+			if arg == "--age" {
+				recipients = args[i+1]
+			}
+		}
+		m["sops"] = map[string]interface{}{"age": recipients}
+		if args[4] == "json" {
+			return json.Marshal(m)
+		}
+		return yaml.Marshal(m)
+	case "set", "unset":
+		f.args = append(f.args, args...)
+		if args[0] == "set" {
+			require.Equal(f.t, "--value-stdin", args[1], "the value is passed on stdin")
+			require.Len(f.t, args, 4)
+			args = args[1:]
+		}
+		path := args[1]
+		var tree []string
+		require.NoError(f.t, json.Unmarshal([]byte(args[2]), &tree))
+		m := f.read(path)
+		if args[0] == "unset" {
+			delete(m, tree[0])
+		} else {
+			var value interface{}
+			require.NoError(f.t, json.Unmarshal(stdin, &value))
+			m[tree[0]] = value
+		}
+		data, err := yaml.Marshal(m)
+		require.NoError(f.t, err)
+		return nil, os.WriteFile(path, data, 0o600)
+	}
+	f.t.Fatalf("unexpected sops command %v", args)
+	return nil, nil
+}
+
+func (f *fakeSops) read(path string) map[string]interface{} {
+	data, err := os.ReadFile(path)
+	require.NoError(f.t, err)
+	m := map[string]interface{}{}
+	require.NoError(f.t, yaml.Unmarshal(data, &m))
+	return m
+}
+
+func newManager(t *testing.T) (secretstore.Interface, *fakeSops) {
+	sops := &fakeSops{t: t}
+	return sopssecrets.NewSopsSecretManager(sopssecrets.Options{
+		AgeRecipients: []string{"age1example"},
+		Runner:        sops.run,
+	}), sops
+}
+
+func TestFileLocation(t *testing.T) {
+	ctx := context.Background()
+	mgr, sops := newManager(t)
+	location := filepath.Join(t.TempDir(), "secrets.yaml")
+
+	_, err := mgr.GetSecretValue(ctx, location, "db")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+
+	require.NoError(t, mgr.SetSecret(location, "db", &secretstore.SecretValue{PropertyValues: map[string]string{"username": "admin"}}))
+	data, err := os.ReadFile(location)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "age: age1example")
+
+	require.NoError(t, mgr.SetSecret(location, "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "hunter2"}}))
+	require.NoError(t, mgr.SetSecret(location, "token", &secretstore.SecretValue{Value: "abc"}))
+	assert.Equal(t, []string{"--encrypt", "--decrypt", "set", "set"}, sops.commands)
+	for _, arg := range sops.args {
+		assert.NotContains(t, arg, "hunter2", "secret values are not passed as arguments")
+		assert.NotContains(t, arg, "abc", "secret values are not passed as arguments")
+	}
+
+	value, err := mgr.GetSecretValue(ctx, location, "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "hunter2"}, value.PropertyValues)
+	token, err := mgr.GetSecret(location, "token", "")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", token)
+	_, err = mgr.GetSecret(location, "db", "missing")
+	assert.ErrorIs(t, err, secretstore.ErrKeyNotFound)
+
+	require.NoError(t, mgr.SetSecret(location, "db", &secretstore.SecretValue{PropertyValues: map[string]string{"password": "changed"}, Overwrite: true}))
+	value, err = mgr.GetSecretValue(ctx, location, "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "changed"}, value.PropertyValues)
+
+	names, err := mgr.ListSecrets(ctx, location, nil).Names()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db", "token"}, names)
+
+	require.NoError(t, mgr.DeleteSecret(ctx, location, "token", nil))
+	assert.ErrorIs(t, mgr.DeleteSecret(ctx, location, "token", nil), secretstore.ErrSecretNotFound)
+	_, err = mgr.GetSecretValue(ctx, location, "token")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+
+	err = mgr.SetSecret(location, "db", &secretstore.SecretValue{Value: "x", ExpectedVersion: "1"})
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+}
+
+func TestDirectoryLocation(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newManager(t)
+	location := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(location, "shared.json"), []byte(`{"db":{"port":5432,"tls":true,"id":9007199254740993},"sops":{}}`), 0o600))
+
+	value, err := mgr.GetSecretValue(ctx, location, "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"port": "5432", "tls": "true", "id": "9007199254740993"}, value.PropertyValues)
+
+	require.NoError(t, mgr.SetSecret(location, "webhook", &secretstore.SecretValue{Value: "hmac"}))
+	_, err = os.Stat(filepath.Join(location, "webhook.yaml"))
+	require.NoError(t, err)
+
+	names, err := mgr.ListSecrets(ctx, location, &secretstore.ListOptions{Prefix: "web"}).Names()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"webhook"}, names)
+	names, err = mgr.ListSecrets(ctx, location, nil).Names()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db", "webhook"}, names)
+
+	for _, name := range []string{"../escape", "nested/secret", `nested\secret`, ".."} {
+		err = mgr.SetSecret(location, name, &secretstore.SecretValue{Value: "x"})
+		assert.Error(t, err, name)
+	}
+	_, err = os.Stat(filepath.Join(filepath.Dir(location), "escape.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestSopsErrors(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "sops")
+	require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\necho 'Failed to get the data key required to decrypt the SOPS file.' >&2\nexit 128\n"), 0o700))
+	location := filepath.Join(dir, "secrets.yaml")
+	require.NoError(t, os.WriteFile(location, []byte("db: ENC[AES256_GCM,data:abc]\nsops: {}\n"), 0o600))
+
+	mgr := sopssecrets.NewSopsSecretManager(sopssecrets.Options{Binary: binary})
+	_, err := mgr.GetSecretValue(context.Background(), location, "db")
+	assert.ErrorIs(t, err, secretstore.ErrPermissionDenied)
+	assert.True(t, strings.Contains(err.Error(), "Failed to get the data key"), err.Error())
+}
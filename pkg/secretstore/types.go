@@ -11,4 +11,14 @@ const (
 	SecretStoreTypeVault      Type = "vault"
 	SecretStoreTypeAwsASM     Type = "secretsManager"
 	SecretStoreTypeAwsSSM     Type = "systemManager"
+	// SecretStoreTypeSops sops encrypted files as the secret store
+	SecretStoreTypeSops Type = "sops"
+	// SecretStoreTypeAge age encrypted files in a local directory as the secret store
+	SecretStoreTypeAge Type = "age"
 )
+
+// PropertiesOnly returns true for store types which only store the properties of a secret, so the plain Value of a
+// secret value is not written
+func (t Type) PropertiesOnly() bool {
+	return t == SecretStoreTypeKubernetes || t == SecretStoreTypeVault
+}
@@ -0,0 +1,79 @@
+package secretstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DefaultUpdateAttempts is the number of times UpdateSecret tries to write a secret when UpdateOptions does not set
+// MaxAttempts
+const DefaultUpdateAttempts = 5
+
+// UpdateOptions configures UpdateSecret. A nil *UpdateOptions uses the defaults
+type UpdateOptions struct {
+	// MaxAttempts is the maximum number of times the secret is read, updated and written
+	MaxAttempts int
+}
+
+func (o *UpdateOptions) maxAttempts() int {
+	if o == nil || o.MaxAttempts <= 0 {
+		return DefaultUpdateAttempts
+	}
+	return o.MaxAttempts
+}
+
+// UpdateFunc returns the new value of a secret given a copy of its current value, which is nil if the secret does not
+// exist. Returning a nil value leaves the secret unchanged
+type UpdateFunc func(current *SecretValue) (*SecretValue, error)
+
+// UpdateSecret reads a secret, calls update and writes the result conditionally on the secret not having changed
+// since it was read. If another writer changed the secret in between the secret is read and update called again, so
+// update may be called several times. The value returned by update is the complete new value of the secret so it is
+// written with Overwrite set. A secret which does not exist is created with CreateOnly, so a secret created by another
+// writer in the meantime is read and updated again. Stores which cannot create secrets atomically, such as Azure Key
+// Vault and sops files, and stores which do not version secrets, such as sops files or Vault KV version 1, are written
+// unconditionally, so concurrent updates of those secrets can be lost
+func UpdateSecret(ctx context.Context, mgr Interface, location, secretName string, update UpdateFunc, options *UpdateOptions) error {
+	maxAttempts := options.maxAttempts()
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = updateSecret(ctx, mgr, location, secretName, update)
+		if !errors.Is(err, ErrConflict) && !errors.Is(err, ErrAlreadyExists) {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+	}
+	return fmt.Errorf("giving up updating secret %s at location %s after %d attempts: %w", secretName, location, maxAttempts, err)
+}
+
+func updateSecret(ctx context.Context, mgr Interface, location, secretName string, update UpdateFunc) error {
+	current, err := mgr.GetSecretValue(ctx, location, secretName)
+	if err != nil && !errors.Is(err, ErrSecretNotFound) {
+		return err
+	}
+	desired, err := update(current.DeepCopy())
+	if err != nil {
+		return err
+	}
+	if desired == nil {
+		return nil
+	}
+	desired = desired.DeepCopy()
+	desired.Overwrite = true
+	desired.ExpectedVersion = ""
+	desired.CreateOnly = false
+	if current != nil {
+		desired.ExpectedVersion = current.Version
+		return mgr.SetSecretWithContext(ctx, location, secretName, desired)
+	}
+	desired.CreateOnly = true
+	err = mgr.SetSecretWithContext(ctx, location, secretName, desired)
+	if errors.Is(err, ErrNotSupported) {
+		desired.CreateOnly = false
+		return mgr.SetSecretWithContext(ctx, location, secretName, desired)
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+//go:build unit
+// +build unit
+
+package secretstore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// racingStore writes the secret itself after each read, as if another writer got in between the read and the write
+type racingStore struct {
+	*fake.SecretStore
+	races int
+}
+
+func (r *racingStore) GetSecretValue(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	value, err := r.SecretStore.GetSecretValue(ctx, location, secretName)
+	if err == nil && r.races > 0 {
+		r.races--
+		racer := value.DeepCopy()
+		racer.PropertyValues["racer"] = "won"
+		if err := r.SecretStore.SetSecret(location, secretName, racer); err != nil {
+			return nil, err
+		}
+	}
+	return value, err
+}
+
+func addKey(key, value string) secretstore.UpdateFunc {
+	return func(current *secretstore.SecretValue) (*secretstore.SecretValue, error) {
+		if current == nil {
+			current = &secretstore.SecretValue{}
+		}
+		if current.PropertyValues == nil {
+			current.PropertyValues = map[string]string{}
+		}
+		current.PropertyValues[key] = value
+		return current, nil
+	}
+}
+
+func TestUpdateSecret(t *testing.T) {
+	ctx := context.Background()
+	store := fake.NewFakeSecretStore()
+
+	require.NoError(t, secretstore.UpdateSecret(ctx, store, "loc", "db", addKey("username", "admin"), nil))
+	require.NoError(t, secretstore.UpdateSecret(ctx, store, "loc", "db", addKey("password", "pwd"), nil))
+
+	value, err := store.GetSecretValue(ctx, "loc", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "pwd"}, value.PropertyValues)
+	assert.Equal(t, "2", value.Version)
+}
+
+func TestUpdateSecretRetriesConflicts(t *testing.T) {
+	ctx := context.Background()
+	store := &racingStore{SecretStore: fake.NewFakeSecretStore(), races: 2}
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"username": "admin"}}))
+	calls := 0
+	update := func(current *secretstore.SecretValue) (*secretstore.SecretValue, error) {
+		calls++
+		return addKey("password", "pwd")(current)
+	}
+
+	require.NoError(t, secretstore.UpdateSecret(ctx, store, "loc", "db", update, nil))
+
+	assert.Equal(t, 3, calls)
+	value, err := store.GetSecretValue(ctx, "loc", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "pwd", "racer": "won"}, value.PropertyValues)
+}
+
+// creatingStore creates the secret itself after reporting that it does not exist, as if another writer created it
+type creatingStore struct {
+	*fake.SecretStore
+	created bool
+}
+
+func (c *creatingStore) GetSecretValue(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	value, err := c.SecretStore.GetSecretValue(ctx, location, secretName)
+	if errors.Is(err, secretstore.ErrSecretNotFound) && !c.created {
+		c.created = true
+		if err := c.SecretStore.SetSecret(location, secretName, &secretstore.SecretValue{PropertyValues: map[string]string{"racer": "won"}}); err != nil {
+			return nil, err
+		}
+	}
+	return value, err
+}
+
+func TestUpdateSecretRetriesConcurrentCreate(t *testing.T) {
+	ctx := context.Background()
+	store := &creatingStore{SecretStore: fake.NewFakeSecretStore()}
+	calls := 0
+	update := func(current *secretstore.SecretValue) (*secretstore.SecretValue, error) {
+		calls++
+		return addKey("password", "pwd")(current)
+	}
+
+	require.NoError(t, secretstore.UpdateSecret(ctx, store, "loc", "db", update, nil))
+
+	assert.Equal(t, 2, calls)
+	value, err := store.GetSecretValue(ctx, "loc", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "pwd", "racer": "won"}, value.PropertyValues)
+	assert.False(t, value.CreateOnly)
+}
+
+// noCreateOnlyStore cannot create secrets atomically
+type noCreateOnlyStore struct {
+	*fake.SecretStore
+}
+
+func (n noCreateOnlyStore) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	if secretValue.CreateOnly {
+		return secretstore.NewError(secretstore.ErrNotSupported, location, secretName, nil)
+	}
+	return n.SecretStore.SetSecretWithContext(ctx, location, secretName, secretValue)
+}
+
+func TestUpdateSecretCreatesWithoutCreateOnly(t *testing.T) {
+	ctx := context.Background()
+	store := noCreateOnlyStore{SecretStore: fake.NewFakeSecretStore()}
+
+	require.NoError(t, secretstore.UpdateSecret(ctx, store, "loc", "db", addKey("username", "admin"), nil))
+
+	value, err := store.GetSecretValue(ctx, "loc", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin"}, value.PropertyValues)
+}
+
+func TestUpdateSecretGivesUp(t *testing.T) {
+	ctx := context.Background()
+	store := &racingStore{SecretStore: fake.NewFakeSecretStore(), races: 10}
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{PropertyValues: map[string]string{"username": "admin"}}))
+
+	err := secretstore.UpdateSecret(ctx, store, "loc", "db", addKey("password", "pwd"), &secretstore.UpdateOptions{MaxAttempts: 3})
+
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	assert.Equal(t, 7, store.races)
+}
+
+func TestUpdateSecretSkipsNilAndErrors(t *testing.T) {
+	ctx := context.Background()
+	store := fake.NewFakeSecretStore()
+	failed := errors.New("failed")
+
+	err := secretstore.UpdateSecret(ctx, store, "loc", "db", func(*secretstore.SecretValue) (*secretstore.SecretValue, error) {
+		return nil, nil
+	}, nil)
+	assert.NoError(t, err)
+	err = secretstore.UpdateSecret(ctx, store, "loc", "db", func(*secretstore.SecretValue) (*secretstore.SecretValue, error) {
+		return nil, failed
+	}, nil)
+	assert.ErrorIs(t, err, failed)
+
+	_, err = store.GetSecretValue(ctx, "loc", "db")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+}
+
+func TestExpectedVersionConflict(t *testing.T) {
+	store := fake.NewFakeSecretStore()
+
+	err := store.SetSecret("loc", "db", &secretstore.SecretValue{Value: "pwd", ExpectedVersion: "1"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict, "a secret which does not exist has no version")
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{Value: "pwd"}))
+	err = store.SetSecret("loc", "db", &secretstore.SecretValue{Value: "new", ExpectedVersion: "2"})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	assert.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{Value: "new", ExpectedVersion: "1"}))
+}
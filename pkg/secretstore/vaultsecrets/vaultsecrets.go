@@ -1,7 +1,15 @@
 package vaultsecrets
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
@@ -9,6 +17,9 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// defaultListDirectory is listed when the prefix passed to ListSecrets does not contain a directory
+const defaultListDirectory = "secret/data/"
+
 func NewVaultSecretManager(client *api.Client) (secretstore.Interface, error) {
 	return &vaultSecretManager{client}, nil
 }
@@ -18,10 +29,18 @@ type vaultSecretManager struct {
 }
 
 func (v vaultSecretManager) GetSecret(location, secretName, secretKey string) (string, error) {
-	secret, err := getSecret(v.vaultAPI, location, secretName)
-	if err != nil || secret == nil {
+	return v.GetSecretWithContext(context.Background(), location, secretName, secretKey)
+}
+
+func (v vaultSecretManager) GetSecretWithContext(ctx context.Context, location, secretName, secretKey string) (string, error) {
+	secret, err := getSecret(ctx, v.vaultAPI, location, secretName)
+	if err != nil {
 		return "", fmt.Errorf("error getting secret %s from Hasicorp vault %s: %w", secretName, location, err)
 	}
+	if secret == nil {
+		return "", fmt.Errorf("error getting secret %s from Hasicorp vault %s: %w", secretName, location,
+			secretstore.NewSecretNotFoundError(location, secretName))
+	}
 	mapData, err := getSecretData(secret)
 	if err != nil {
 		return "", fmt.Errorf("error converting secret data retrieved for secret %s from Hashicorp Vault %s: %w", secretName, location, err)
@@ -33,11 +52,84 @@ func (v vaultSecretManager) GetSecret(location, secretName, secretKey string) (s
 	return secretString, nil
 }
 
+func (v vaultSecretManager) GetSecretValue(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	secret, err := getSecret(ctx, v.vaultAPI, location, secretName)
+	if err != nil {
+		return nil, fmt.Errorf("error getting secret %s from Hasicorp vault %s: %w", secretName, location, err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("error getting secret %s from Hasicorp vault %s: %w", secretName, location,
+			secretstore.NewSecretNotFoundError(location, secretName))
+	}
+	return toSecretValue(location, secretName, secret)
+}
+
+func toSecretValue(location, secretName string, secret *api.Secret) (*secretstore.SecretValue, error) {
+	mapData, err := getSecretData(secret)
+	if err != nil {
+		return nil, fmt.Errorf("error converting secret data retrieved for secret %s from Hashicorp Vault %s: %w", secretName, location, err)
+	}
+	propertyValues := make(map[string]string, len(mapData))
+	for k, value := range mapData {
+		if s, ok := value.(string); ok {
+			propertyValues[k] = s
+			continue
+		}
+		// values not written by this library may be of any JSON type so keep them in their JSON form
+		j, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("error converting key %s of secret %s from Hashicorp Vault %s: %w", k, secretName, location, err)
+		}
+		propertyValues[k] = string(j)
+	}
+	return &secretstore.SecretValue{PropertyValues: propertyValues, Version: currentVersion(secret)}, nil
+}
+
+// currentVersion returns the KV v2 version of the secret that was read or an empty string for KV v1 secrets
+func currentVersion(secret *api.Secret) string {
+	if metadata, ok := secret.Data["metadata"].(map[string]interface{}); ok && metadata["version"] != nil {
+		return fmt.Sprint(metadata["version"])
+	}
+	return ""
+}
+
 func (v vaultSecretManager) SetSecret(location, secretName string, secretValue *secretstore.SecretValue) error {
-	secret, err := getSecret(v.vaultAPI, location, secretName)
+	return v.SetSecretWithContext(context.Background(), location, secretName, secretValue)
+}
+
+// SetSecretWithContext writes the secret, merging it with the existing secret unless Overwrite is set. An
+// ExpectedVersion is only supported for KV v2 secrets and is passed to Vault as the check-and-set version, as is a check
+// and set version of 0 for CreateOnly
+func (v vaultSecretManager) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	var cas int
+	if secretValue.CreateOnly && !isKVv2Path(secretName) {
+		return fmt.Errorf("secret %s is not a KV v2 secret so cannot be created only if it does not exist: %w", secretName, secretstore.ErrNotSupported)
+	}
+	if secretValue.ExpectedVersion != "" {
+		if !isKVv2Path(secretName) {
+			return fmt.Errorf("secret %s is not a KV v2 secret so cannot be written with an expected version: %w", secretName, secretstore.ErrNotSupported)
+		}
+		var err error
+		cas, err = strconv.Atoi(secretValue.ExpectedVersion)
+		if err != nil {
+			return fmt.Errorf("invalid expected version %s for secret %s in Hashicorp Vault %s: %w", secretValue.ExpectedVersion, secretName, location, err)
+		}
+	}
+	secret, err := getSecret(ctx, v.vaultAPI, location, secretName)
 	if err != nil {
 		return fmt.Errorf("error getting secret %s in Hashicorp vault %s prior to setting: %w", secretName, location, err)
 	}
+	if secretValue.CreateOnly && secret != nil {
+		return fmt.Errorf("error creating secret %s in Hashicorp Vault %s: %w", secretName, location,
+			secretstore.NewAlreadyExistsError(location, secretName))
+	}
+	if secretValue.ExpectedVersion != "" {
+		// fail fast rather than merging with a secret which Vault will refuse to overwrite anyway
+		if secret == nil || currentVersion(secret) != secretValue.ExpectedVersion {
+			return fmt.Errorf("error writing secret %s to Hashicorp Vault %s: %w", secretName, location,
+				secretstore.NewConflictError(location, secretName))
+		}
+	}
 
 	newSecretData := map[string]interface{}{}
 	if secret != nil && !secretValue.Overwrite {
@@ -55,23 +147,258 @@ func (v vaultSecretManager) SetSecret(location, secretName string, secretValue *
 	data := map[string]interface{}{
 		"data": newSecretData,
 	}
+	if secretValue.ExpectedVersion != "" || secretValue.CreateOnly {
+		data["options"] = map[string]interface{}{"cas": cas}
+	}
+
+	_, err = v.vaultAPI.Logical().WriteWithContext(ctx, secretName, data)
+	if err != nil {
+		if secretValue.CreateOnly && isCheckAndSetError(err) {
+			return fmt.Errorf("error creating secret %s in Hashicorp Vault %s: %w", secretName, location,
+				secretstore.NewError(secretstore.ErrAlreadyExists, location, secretName, err))
+		}
+		if secretValue.ExpectedVersion != "" && isCheckAndSetError(err) {
+			return fmt.Errorf("error writing secret %s to Hashicorp Vault %s: %w", secretName, location,
+				secretstore.NewError(secretstore.ErrConflict, location, secretName, err))
+		}
+		return fmt.Errorf("error writing secret %s to Hashicorp Vault %s: %w", secretName, location, classifyError(location, secretName, err))
+	}
+	return nil
+}
+
+// isCheckAndSetError returns true if Vault rejected a write because the check-and-set version did not match
+func isCheckAndSetError(err error) bool {
+	var respErr *api.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	for _, e := range respErr.Errors {
+		if strings.Contains(e, "check-and-set") {
+			return true
+		}
+	}
+	return false
+}
 
-	_, err = v.vaultAPI.Logical().Write(secretName, data)
+func (v vaultSecretManager) DeleteSecret(ctx context.Context, location, secretName string, options *secretstore.DeleteOptions) error {
+	err := v.vaultAPI.SetAddress(location)
 	if err != nil {
-		return fmt.Errorf("error writing secret %s to Hashicorp Vault %s: %w", secretName, location, err)
+		return fmt.Errorf("error setting location of Hashicorp vault %s on client: %w", location, err)
+	}
+	path := secretName
+	if options != nil && options.Purge {
+		path = metadataPath(secretName)
+	}
+	_, err = v.vaultAPI.Logical().DeleteWithContext(ctx, path)
+	if err != nil {
+		return fmt.Errorf("error deleting secret %s from Hashicorp Vault %s: %w", secretName, location, classifyError(location, secretName, err))
 	}
 	return nil
 }
 
-func getSecret(client *api.Client, location, secretName string) (*api.Secret, error) {
+// ListSecrets recursively lists the secrets beneath the directory containing the prefix. The prefix is a path such as
+// secret/data/jx/, when it does not contain a directory it is a prefix of the names in the default KV v2 mount of
+// secret/data/, so a prefix of jx lists secret/data/jx-db and secret/data/jx/app
+func (v vaultSecretManager) ListSecrets(ctx context.Context, location string, options *secretstore.ListOptions) *secretstore.SecretIterator {
+	err := v.vaultAPI.SetAddress(location)
+	if err != nil {
+		return secretstore.NewErrorSecretIterator(fmt.Errorf("error setting location of Hashicorp vault %s on client: %w", location, err))
+	}
+	prefix := options.GetPrefix()
+	if strings.LastIndex(prefix, "/") <= 0 {
+		prefix = defaultListDirectory + strings.TrimPrefix(prefix, "/")
+	}
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+	// each page is one directory, sub directories are queued as further pages
+	pending := []string{dir}
+	return secretstore.NewSecretIterator(ctx, prefix, func(ctx context.Context, _ string) ([]secretstore.SecretInfo, string, error) {
+		dir := pending[0]
+		pending = pending[1:]
+		keys, err := listKeys(ctx, v.vaultAPI, metadataPath(dir))
+		if err != nil {
+			return nil, "", fmt.Errorf("error listing secrets in %s from Hashicorp Vault %s: %w", dir, location, err)
+		}
+		var secrets []secretstore.SecretInfo
+		for _, key := range keys {
+			name := dir + key
+			if !strings.HasSuffix(key, "/") {
+				secrets = append(secrets, secretstore.SecretInfo{Name: name})
+			} else if strings.HasPrefix(name, prefix) || strings.HasPrefix(prefix, name) {
+				pending = append(pending, name)
+			}
+		}
+		nextPageToken := ""
+		if len(pending) > 0 {
+			nextPageToken = pending[0]
+		}
+		return secrets, nextPageToken, nil
+	})
+}
+
+func listKeys(ctx context.Context, client *api.Client, path string) ([]string, error) {
+	secret, err := client.Logical().ListWithContext(ctx, path)
+	if err != nil {
+		return nil, classifyError(client.Address(), path, err)
+	}
+	// Vault returns no secret when the path does not exist
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+	rawKeys, ok := secret.Data["keys"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("keys are not of type []interface{} in Hashicorp Vault list response")
+	}
+	keys := make([]string, 0, len(rawKeys))
+	for _, k := range rawKeys {
+		if key, ok := k.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (v vaultSecretManager) ListSecretVersions(ctx context.Context, location, secretName string) ([]secretstore.SecretVersion, error) {
+	if !isKVv2Path(secretName) {
+		return nil, fmt.Errorf("secret %s is not a KV v2 secret: %w", secretName, secretstore.ErrNotSupported)
+	}
+	metadata, err := getSecret(ctx, v.vaultAPI, location, metadataPath(secretName))
+	if err != nil {
+		return nil, fmt.Errorf("error getting metadata of secret %s from Hashicorp Vault %s: %w", secretName, location, err)
+	}
+	if metadata == nil {
+		return nil, fmt.Errorf("error getting metadata of secret %s from Hashicorp Vault %s: %w", secretName, location,
+			secretstore.NewSecretNotFoundError(location, secretName))
+	}
+	rawVersions, ok := metadata.Data["versions"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("versions are not of type map[string]interface{} in Hashicorp Vault metadata for secret %s", secretName)
+	}
+	versions := make([]secretstore.SecretVersion, 0, len(rawVersions))
+	for version, raw := range rawVersions {
+		info, _ := raw.(map[string]interface{})
+		secretVersion := secretstore.SecretVersion{
+			Version: version,
+			State:   secretstore.VersionStateEnabled,
+		}
+		if created, ok := info["created_time"].(string); ok {
+			secretVersion.CreatedAt, _ = time.Parse(time.RFC3339Nano, created)
+		}
+		if deleted, ok := info["deletion_time"].(string); ok && deleted != "" {
+			secretVersion.State = secretstore.VersionStateDisabled
+		}
+		if destroyed, ok := info["destroyed"].(bool); ok && destroyed {
+			secretVersion.State = secretstore.VersionStateDestroyed
+		}
+		versions = append(versions, secretVersion)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		vi, _ := strconv.Atoi(versions[i].Version)
+		vj, _ := strconv.Atoi(versions[j].Version)
+		return vi > vj
+	})
+	return versions, nil
+}
+
+func (v vaultSecretManager) GetSecretVersion(ctx context.Context, location, secretName, version string) (*secretstore.SecretValue, error) {
+	if !isKVv2Path(secretName) {
+		return nil, fmt.Errorf("secret %s is not a KV v2 secret: %w", secretName, secretstore.ErrNotSupported)
+	}
+	err := v.vaultAPI.SetAddress(location)
+	if err != nil {
+		return nil, fmt.Errorf("error setting location of Hashicorp vault %s on client: %w", location, err)
+	}
+	secret, err := v.vaultAPI.Logical().ReadWithDataWithContext(ctx, secretName, map[string][]string{"version": {version}})
+	if err != nil {
+		return nil, fmt.Errorf("error reading version %s of secret %s from Hashicorp Vault %s: %w", version, secretName, location,
+			classifyError(location, secretName, err))
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("error reading version %s of secret %s from Hashicorp Vault %s: %w", version, secretName, location,
+			secretstore.NewSecretNotFoundError(location, secretName))
+	}
+	return toSecretValue(location, secretName, secret)
+}
+
+// Watch polls the metadata of a KV v2 secret, which is reported as deleted when its current version is deleted
+func (v vaultSecretManager) Watch(ctx context.Context, location, secretName string, options *secretstore.WatchOptions) (<-chan secretstore.WatchEvent, error) {
+	if !isKVv2Path(secretName) {
+		return nil, fmt.Errorf("secret %s is not a KV v2 secret: %w", secretName, secretstore.ErrNotSupported)
+	}
+	return secretstore.PollWatch(ctx, location, secretName, options.GetPollInterval(), func(ctx context.Context) (string, error) {
+		metadata, err := getSecret(ctx, v.vaultAPI, location, metadataPath(secretName))
+		if err != nil {
+			return "", err
+		}
+		if metadata == nil {
+			return "", secretstore.NewSecretNotFoundError(location, secretName)
+		}
+		version := fmt.Sprint(metadata.Data["current_version"])
+		versions, _ := metadata.Data["versions"].(map[string]interface{})
+		info, _ := versions[version].(map[string]interface{})
+		if deleted, ok := info["deletion_time"].(string); ok && deleted != "" {
+			return "", secretstore.NewSecretNotFoundError(location, secretName)
+		}
+		return version, nil
+	}), nil
+}
+
+// DisableSecretVersion soft deletes the version, it can be restored using the KV v2 undelete endpoint
+func (v vaultSecretManager) DisableSecretVersion(ctx context.Context, location, secretName, version string) error {
+	return v.writeVersions(ctx, location, secretName, "delete", version)
+}
+
+func (v vaultSecretManager) DestroySecretVersion(ctx context.Context, location, secretName, version string) error {
+	return v.writeVersions(ctx, location, secretName, "destroy", version)
+}
+
+func (v vaultSecretManager) writeVersions(ctx context.Context, location, secretName, endpoint, version string) error {
+	if !isKVv2Path(secretName) {
+		return fmt.Errorf("secret %s is not a KV v2 secret: %w", secretName, secretstore.ErrNotSupported)
+	}
+	err := v.vaultAPI.SetAddress(location)
+	if err != nil {
+		return fmt.Errorf("error setting location of Hashicorp vault %s on client: %w", location, err)
+	}
+	data := map[string]interface{}{
+		"versions": []string{version},
+	}
+	_, err = v.vaultAPI.Logical().WriteWithContext(ctx, kvV2Path(secretName, endpoint), data)
+	if err != nil {
+		return fmt.Errorf("error calling %s for version %s of secret %s in Hashicorp Vault %s: %w", endpoint, version, secretName, location,
+			classifyError(location, secretName, err))
+	}
+	return nil
+}
+
+// metadataPath converts the data path of a KV v2 secret (e.g. secret/data/foo) to its metadata path
+// (e.g. secret/metadata/foo). Deleting the metadata path removes all versions of the secret
+func metadataPath(secretName string) string {
+	return kvV2Path(secretName, "metadata")
+}
+
+// kvV2Path converts the data path of a KV v2 secret to the path of another KV v2 endpoint such as delete or destroy.
+// Paths which are not KV v2 data paths are returned unchanged
+func kvV2Path(secretName, endpoint string) string {
+	parts := strings.SplitN(secretName, "/", 3)
+	if len(parts) == 3 && parts[1] == "data" {
+		return parts[0] + "/" + endpoint + "/" + parts[2]
+	}
+	return secretName
+}
+
+func isKVv2Path(secretName string) bool {
+	return kvV2Path(secretName, "metadata") != secretName
+}
+
+func getSecret(ctx context.Context, client *api.Client, location, secretName string) (*api.Secret, error) {
 	err := client.SetAddress(location)
 	if err != nil {
 		return nil, fmt.Errorf("error setting location of Hashicorp vault %s on client: %w", location, err)
 	}
 	logical := client.Logical()
-	secret, err := logical.Read(secretName)
+	secret, err := logical.ReadWithContext(ctx, secretName)
 	if err != nil {
-		return nil, fmt.Errorf("error reading secret %s from Hashicorp Vault API at %s: %w", secretName, location, err)
+		return nil, fmt.Errorf("error reading secret %s from Hashicorp Vault API at %s: %w", secretName, location, classifyError(location, secretName, err))
 	}
 	return secret, nil
 }
@@ -91,7 +418,7 @@ func getSecretData(secret *api.Secret) (map[string]interface{}, error) {
 func getSecretKeyString(secretData map[string]interface{}, secretKey string) (string, error) {
 	value, ok := secretData[secretKey]
 	if !ok {
-		return "", fmt.Errorf("%s does not occur in secret data", secretKey)
+		return "", fmt.Errorf("%s does not occur in secret data: %w", secretKey, secretstore.ErrKeyNotFound)
 	}
 	stringValue, ok := value.(string)
 	if !ok {
@@ -99,3 +426,12 @@ func getSecretKeyString(secretData map[string]interface{}, secretKey string) (st
 	}
 	return stringValue, nil
 }
+
+// classifyError maps Hashicorp Vault API errors on to the secretstore error kinds
+func classifyError(location, secretName string, err error) error {
+	var respErr *api.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+	return secretstore.NewError(secretstore.ErrorKindFromHTTPStatus(respErr.StatusCode), location, secretName, err)
+}
@@ -1,6 +1,238 @@
-package vaultsecrets_test
+//go:build unit
+// +build unit
 
-// TODO: Implement tests
+package vaultsecrets_test
 
 // Previously a test imported github.com/hashicorp/vault/vault as a module, which is not suppoorted anymore.
-// The test didn't do much anyway, so I removed it.
+// The tests below run against a minimal fake of the KV v2 HTTP API instead.
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/vaultsecrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeVault returns a secret manager and the location of a fake Vault which answers each "METHOD /path?query"
+// request with the matching response wrapped in a data field, or a 404
+func newFakeVault(t *testing.T, responses map[string]interface{}) (mgr secretstore.Interface, location string, requests *[]string) {
+	requests = &[]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.Path
+		if r.URL.RawQuery != "" {
+			key += "?" + r.URL.RawQuery
+		}
+		*requests = append(*requests, key)
+		resp, ok := responses[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+	mgr, err = vaultsecrets.NewVaultSecretManager(client)
+	require.NoError(t, err)
+	return mgr, server.URL, requests
+}
+
+func TestListSecretVersions(t *testing.T) {
+	mgr, location, _ := newFakeVault(t, map[string]interface{}{
+		"GET /v1/secret/metadata/jx/db": map[string]interface{}{
+			"versions": map[string]interface{}{
+				"1":  map[string]interface{}{"created_time": "2024-01-01T10:00:00.000000Z", "deletion_time": "", "destroyed": true},
+				"2":  map[string]interface{}{"created_time": "2024-01-02T10:00:00.000000Z", "deletion_time": "2024-01-03T10:00:00Z", "destroyed": false},
+				"10": map[string]interface{}{"created_time": "2024-01-04T10:00:00.000000Z", "deletion_time": "", "destroyed": false},
+			},
+		},
+	})
+	versioned, err := secretstore.AsVersionInterface(mgr)
+	require.NoError(t, err)
+
+	versions, err := versioned.ListSecretVersions(context.Background(), location, "secret/data/jx/db")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, "10", versions[0].Version)
+	assert.Equal(t, secretstore.VersionStateEnabled, versions[0].State)
+	assert.Equal(t, secretstore.VersionStateDisabled, versions[1].State)
+	assert.Equal(t, secretstore.VersionStateDestroyed, versions[2].State)
+	assert.Equal(t, 2024, versions[2].CreatedAt.Year())
+}
+
+func TestListSecretsWithPrefix(t *testing.T) {
+	mgr, location, _ := newFakeVault(t, map[string]interface{}{
+		"GET /v1/secret/metadata?list=true":    map[string]interface{}{"keys": []string{"jx-db", "other", "jx/", "tmp/"}},
+		"GET /v1/secret/metadata/jx?list=true": map[string]interface{}{"keys": []string{"app"}},
+	})
+
+	names, err := mgr.ListSecrets(context.Background(), location, &secretstore.ListOptions{Prefix: "jx"}).Names()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"secret/data/jx-db", "secret/data/jx/app"}, names)
+
+	names, err = mgr.ListSecrets(context.Background(), location, &secretstore.ListOptions{Prefix: "secret/data/jx/"}).Names()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"secret/data/jx/app"}, names)
+}
+
+func TestGetSecretVersion(t *testing.T) {
+	mgr, location, _ := newFakeVault(t, map[string]interface{}{
+		"GET /v1/secret/data/jx/db?version=2": map[string]interface{}{
+			"data":     map[string]interface{}{"password": "old"},
+			"metadata": map[string]interface{}{"version": 2},
+		},
+	})
+	versioned, err := secretstore.AsVersionInterface(mgr)
+	require.NoError(t, err)
+
+	secretValue, err := versioned.GetSecretVersion(context.Background(), location, "secret/data/jx/db", "2")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "old"}, secretValue.PropertyValues)
+	assert.Equal(t, "2", secretValue.Version)
+
+	_, err = versioned.GetSecretVersion(context.Background(), location, "secret/data/jx/db", "3")
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+}
+
+func TestDestroySecretVersion(t *testing.T) {
+	mgr, location, requests := newFakeVault(t, map[string]interface{}{
+		"PUT /v1/secret/destroy/jx/db": nil,
+	})
+	versioned, err := secretstore.AsVersionInterface(mgr)
+	require.NoError(t, err)
+
+	err = versioned.DestroySecretVersion(context.Background(), location, "secret/data/jx/db", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"PUT /v1/secret/destroy/jx/db"}, *requests)
+
+	err = versioned.DestroySecretVersion(context.Background(), location, "kv/jx/db", "1")
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+}
+
+func TestSetSecretWithExpectedVersion(t *testing.T) {
+	// a KV v2 secret at version 3 which rejects writes whose check-and-set version is not current
+	version := 3
+	readVersion := func() int { return version }
+	var written map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"password": "pwd"},
+				"metadata": map[string]interface{}{"version": readVersion()},
+			}})
+			return
+		}
+		body := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		cas := body["options"].(map[string]interface{})["cas"].(float64)
+		if int(cas) != version {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"errors": []string{"check-and-set parameter did not match the current version"},
+			})
+			return
+		}
+		written = body["data"].(map[string]interface{})
+		version++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"version": version}})
+	}))
+	t.Cleanup(server.Close)
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+	mgr, err := vaultsecrets.NewVaultSecretManager(client)
+	require.NoError(t, err)
+
+	err = mgr.SetSecret(server.URL, "secret/data/jx/db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"password": "stale"}, ExpectedVersion: "2",
+	})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	assert.Nil(t, written)
+
+	err = mgr.SetSecret(server.URL, "secret/data/jx/db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"password": "new"}, ExpectedVersion: "3",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"password": "new"}, written)
+
+	// another writer updates the secret between it being read and written
+	readVersion = func() int { return version - 1 }
+	err = mgr.SetSecret(server.URL, "secret/data/jx/db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"password": "lost"}, ExpectedVersion: "3",
+	})
+	assert.ErrorIs(t, err, secretstore.ErrConflict)
+	assert.Equal(t, map[string]interface{}{"password": "new"}, written)
+
+	err = mgr.SetSecret(server.URL, "kv/jx/db", &secretstore.SecretValue{Value: "pwd", ExpectedVersion: "1"})
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr, location, requests := newFakeVault(t, map[string]interface{}{
+		"GET /v1/secret/metadata/jx/db": map[string]interface{}{
+			"current_version": 3,
+			"versions": map[string]interface{}{
+				"3": map[string]interface{}{"created_time": "2024-01-04T10:00:00.000000Z", "deletion_time": "", "destroyed": false},
+			},
+		},
+	})
+	watcher, err := secretstore.AsWatchInterface(mgr)
+	require.NoError(t, err)
+
+	events, err := watcher.Watch(ctx, location, "secret/data/jx/db", &secretstore.WatchOptions{PollInterval: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, secretstore.WatchEvent{Type: secretstore.WatchEventAdded, Location: location, SecretName: "secret/data/jx/db", Version: "3"}, <-events)
+	assert.Equal(t, []string{"GET /v1/secret/metadata/jx/db"}, *requests, "secret values must not be read")
+
+	cancel()
+	for range events {
+	}
+	_, err = watcher.Watch(ctx, location, "kv/jx/db", nil)
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+}
+
+func TestSetSecretCreateOnly(t *testing.T) {
+	// the secret is missing when read but created by another writer before it is written
+	var options []interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		options = append(options, body["options"])
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": []string{"check-and-set parameter did not match the current version"},
+		})
+	}))
+	t.Cleanup(server.Close)
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+	mgr, err := vaultsecrets.NewVaultSecretManager(client)
+	require.NoError(t, err)
+
+	err = mgr.SetSecret(server.URL, "secret/data/jx/db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"password": "pwd"}, CreateOnly: true,
+	})
+	assert.ErrorIs(t, err, secretstore.ErrAlreadyExists)
+	assert.Equal(t, []interface{}{map[string]interface{}{"cas": float64(0)}}, options)
+
+	err = mgr.SetSecret(server.URL, "kv/jx/db", &secretstore.SecretValue{Value: "pwd", CreateOnly: true})
+	assert.ErrorIs(t, err, secretstore.ErrNotSupported)
+}
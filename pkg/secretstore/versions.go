@@ -0,0 +1,53 @@
+package secretstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// VersionState describes whether a version of a secret can still be read
+type VersionState string
+
+const (
+	// VersionStateEnabled the version can be read
+	VersionStateEnabled VersionState = "enabled"
+	// VersionStateDisabled the version cannot be read but can be re-enabled
+	VersionStateDisabled VersionState = "disabled"
+	// VersionStateDestroyed the value of the version has been permanently removed
+	VersionStateDestroyed VersionState = "destroyed"
+)
+
+// SecretVersion describes a single version of a secret
+type SecretVersion struct {
+	// Version identifies the version in the secret store, e.g. the GCP version number, AWS version id, Azure version or
+	// Hashicorp Vault KV v2 version number
+	Version   string
+	CreatedAt time.Time
+	State     VersionState
+	// Stages are the AWS Secrets Manager staging labels attached to the version such as AWSCURRENT
+	Stages []string
+}
+
+// VersionInterface is implemented by secret managers for stores which keep previous versions of secrets. Use
+// AsVersionInterface to check whether a secret manager supports versioning
+type VersionInterface interface {
+	// ListSecretVersions returns the versions of a secret, newest first
+	ListSecretVersions(ctx context.Context, location string, secretName string) ([]SecretVersion, error)
+	// GetSecretVersion reads the value of a specific version of a secret
+	GetSecretVersion(ctx context.Context, location string, secretName string, version string) (*SecretValue, error)
+	// DisableSecretVersion stops a version from being read while keeping it recoverable
+	DisableSecretVersion(ctx context.Context, location string, secretName string, version string) error
+	// DestroySecretVersion permanently removes the value of a version
+	DestroySecretVersion(ctx context.Context, location string, secretName string, version string) error
+}
+
+// AsVersionInterface returns the VersionInterface of the secret manager or an ErrNotSupported error if the secret
+// store does not support versions
+func AsVersionInterface(mgr Interface) (VersionInterface, error) {
+	versioned, ok := mgr.(VersionInterface)
+	if !ok {
+		return nil, fmt.Errorf("secret versions are not supported by %T: %w", mgr, ErrNotSupported)
+	}
+	return versioned, nil
+}
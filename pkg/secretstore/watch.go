@@ -0,0 +1,155 @@
+package secretstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultWatchPollInterval is how often secret stores without change notifications are polled when WatchOptions does
+// not set PollInterval
+const DefaultWatchPollInterval = 30 * time.Second
+
+// WatchEventType describes the change a WatchEvent reports
+type WatchEventType string
+
+const (
+	// WatchEventAdded the secret exists, either when the watch starts or because it was created
+	WatchEventAdded WatchEventType = "added"
+	// WatchEventModified a new version of the secret was written
+	WatchEventModified WatchEventType = "modified"
+	// WatchEventDeleted the secret was deleted
+	WatchEventDeleted WatchEventType = "deleted"
+	// WatchEventError the secret store could not be checked for changes. The watch carries on and Err holds the error
+	WatchEventError WatchEventType = "error"
+)
+
+// WatchEvent reports a change to a watched secret. Secret values are not included, read the secret to get its value
+type WatchEvent struct {
+	Type       WatchEventType
+	Location   string
+	SecretName string
+	// Version is the version of the secret after the change, where the secret store has versions
+	Version string
+	// Err is set for WatchEventError events
+	Err error
+}
+
+// WatchOptions configures Watch. A nil *WatchOptions uses the defaults
+type WatchOptions struct {
+	// PollInterval is how often secret stores without change notifications are polled
+	PollInterval time.Duration
+}
+
+// GetPollInterval returns the poll interval, defaulting to DefaultWatchPollInterval
+func (o *WatchOptions) GetPollInterval() time.Duration {
+	if o == nil || o.PollInterval <= 0 {
+		return DefaultWatchPollInterval
+	}
+	return o.PollInterval
+}
+
+// WatchInterface is implemented by secret managers which can report changes to secrets. Use AsWatchInterface to check
+// whether a secret manager supports watching
+type WatchInterface interface {
+	// Watch sends an event on the returned channel whenever the secret changes, starting with a WatchEventAdded event
+	// if the secret exists. The channel is closed once ctx is done
+	Watch(ctx context.Context, location string, secretName string, options *WatchOptions) (<-chan WatchEvent, error)
+}
+
+// AsWatchInterface returns the WatchInterface of the secret manager or an ErrNotSupported error if the secret store
+// does not support watching secrets
+func AsWatchInterface(mgr Interface) (WatchInterface, error) {
+	watcher, ok := mgr.(WatchInterface)
+	if !ok {
+		return nil, fmt.Errorf("watching secrets is not supported by %T: %w", mgr, ErrNotSupported)
+	}
+	return watcher, nil
+}
+
+// VersionFunc returns the current version of a secret, or an ErrSecretNotFound error if it does not exist
+type VersionFunc func(ctx context.Context) (string, error)
+
+// PollWatch implements Watch for secret stores without change notifications by calling currentVersion every
+// interval and sending an event whenever the version changes
+func PollWatch(ctx context.Context, location, secretName string, interval time.Duration, currentVersion VersionFunc) <-chan WatchEvent {
+	sink := NewWatchSink(ctx)
+	go func() {
+		defer sink.Close()
+		exists := false
+		version := ""
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			latest, err := currentVersion(ctx)
+			switch {
+			case errors.Is(err, ErrSecretNotFound):
+				if exists {
+					sink.Send(WatchEvent{Type: WatchEventDeleted, Location: location, SecretName: secretName, Version: version})
+				}
+				exists, version = false, ""
+			case err != nil:
+				if ctx.Err() == nil {
+					sink.Send(WatchEvent{Type: WatchEventError, Location: location, SecretName: secretName, Err: err})
+				}
+			case !exists:
+				sink.Send(WatchEvent{Type: WatchEventAdded, Location: location, SecretName: secretName, Version: latest})
+				exists, version = true, latest
+			case latest != version:
+				sink.Send(WatchEvent{Type: WatchEventModified, Location: location, SecretName: secretName, Version: latest})
+				version = latest
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return sink.Events()
+}
+
+// WatchSink delivers watch events to a channel which is closed when the watch context is done. Send may be called
+// concurrently and after the channel is closed, which makes it suitable for callbacks such as informer handlers
+type WatchSink struct {
+	ctx    context.Context
+	events chan WatchEvent
+
+	lock   sync.Mutex
+	closed bool
+}
+
+// NewWatchSink creates a WatchSink for a watch which stops when ctx is done
+func NewWatchSink(ctx context.Context) *WatchSink {
+	return &WatchSink{ctx: ctx, events: make(chan WatchEvent)}
+}
+
+// Events returns the channel events are delivered to
+func (s *WatchSink) Events() <-chan WatchEvent {
+	return s.events
+}
+
+// Send blocks until the event is received or the watch context is done. Events sent after Close are dropped
+func (s *WatchSink) Send(event WatchEvent) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- event:
+	case <-s.ctx.Done():
+	}
+}
+
+// Close closes the events channel, waiting for any Send in progress to finish
+func (s *WatchSink) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+}
@@ -0,0 +1,112 @@
+//go:build unit
+// +build unit
+
+package secretstore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nextEvent(t *testing.T, events <-chan secretstore.WatchEvent) secretstore.WatchEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "events channel closed")
+		return event
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for watch event")
+	}
+	return secretstore.WatchEvent{}
+}
+
+func TestPollWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	failed := errors.New("failed")
+	polls := []struct {
+		version string
+		err     error
+	}{
+		{err: secretstore.NewSecretNotFoundError("loc", "db")},
+		{version: "1"},
+		{version: "1"},
+		{err: failed},
+		{version: "2"},
+		{err: secretstore.NewSecretNotFoundError("loc", "db")},
+	}
+	events := secretstore.PollWatch(ctx, "loc", "db", time.Millisecond, func(context.Context) (string, error) {
+		if len(polls) == 0 {
+			return "", secretstore.NewSecretNotFoundError("loc", "db")
+		}
+		poll := polls[0]
+		polls = polls[1:]
+		return poll.version, poll.err
+	})
+
+	assert.Equal(t, secretstore.WatchEvent{Type: secretstore.WatchEventAdded, Location: "loc", SecretName: "db", Version: "1"}, nextEvent(t, events))
+	errEvent := nextEvent(t, events)
+	assert.Equal(t, secretstore.WatchEventError, errEvent.Type)
+	assert.ErrorIs(t, errEvent.Err, failed)
+	assert.Equal(t, secretstore.WatchEvent{Type: secretstore.WatchEventModified, Location: "loc", SecretName: "db", Version: "2"}, nextEvent(t, events))
+	assert.Equal(t, secretstore.WatchEvent{Type: secretstore.WatchEventDeleted, Location: "loc", SecretName: "db", Version: "2"}, nextEvent(t, events))
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestFakeWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{Value: "pwd"}))
+	watcher, err := secretstore.AsWatchInterface(store)
+	require.NoError(t, err)
+
+	events, err := watcher.Watch(ctx, "loc", "db", nil)
+	require.NoError(t, err)
+	require.NoError(t, store.SetSecret("loc", "other", &secretstore.SecretValue{Value: "ignored"}))
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{Value: "new"}))
+	require.NoError(t, store.DeleteSecret(ctx, "loc", "db", nil))
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{Value: "recreated"}))
+
+	assert.Equal(t, secretstore.WatchEvent{Type: secretstore.WatchEventAdded, Location: "loc", SecretName: "db", Version: "1"}, nextEvent(t, events))
+	assert.Equal(t, secretstore.WatchEvent{Type: secretstore.WatchEventModified, Location: "loc", SecretName: "db", Version: "2"}, nextEvent(t, events))
+	assert.Equal(t, secretstore.WatchEvent{Type: secretstore.WatchEventDeleted, Location: "loc", SecretName: "db", Version: "2"}, nextEvent(t, events))
+	assert.Equal(t, secretstore.WatchEvent{Type: secretstore.WatchEventAdded, Location: "loc", SecretName: "db", Version: "1"}, nextEvent(t, events))
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatchThroughMiddleware(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var operations []secretstore.Operation
+	record := secretstore.Intercept(func(ctx context.Context, call *secretstore.Call, invoke func(ctx context.Context) error) error {
+		operations = append(operations, call.Operation)
+		// cancelling the context of the call must not stop the watch
+		callCtx, cancelCall := context.WithCancel(ctx)
+		defer cancelCall()
+		return invoke(callCtx)
+	})
+	store := fake.NewFakeSecretStore()
+	watcher, err := secretstore.AsWatchInterface(secretstore.Chain(store, record))
+	require.NoError(t, err)
+
+	events, err := watcher.Watch(ctx, "loc", "db", nil)
+	require.NoError(t, err)
+	require.NoError(t, store.SetSecret("loc", "db", &secretstore.SecretValue{Value: "pwd"}))
+
+	assert.Equal(t, secretstore.WatchEventAdded, nextEvent(t, events).Type)
+	assert.Equal(t, []secretstore.Operation{secretstore.OperationWatch}, operations)
+}
@@ -0,0 +1,217 @@
+package secrettemplate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretref"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// refPattern matches inline references such as ref+gsm://project/name#key
+	refPattern = regexp.MustCompile(`ref\+([a-z0-9+]+://[^\s"'<>,\])}` + "`" + `]+)`)
+	// templatePattern matches template style references such as {{ secret "vault://host/path#key" }}
+	templatePattern = regexp.MustCompile(`\{\{-?\s*secret\s+"([^"]+)"\s*-?\}\}`)
+)
+
+// Resolver resolves a parsed secret reference, it is implemented by secretref.Resolver
+type Resolver interface {
+	ResolveRef(ctx context.Context, ref *secretref.Ref) (string, error)
+}
+
+// Renderer replaces secret references embedded in text or YAML with their values. References are written either as
+// ref+gsm://project/name#key or {{ secret "gsm://project/name#key" }}, any other {{ }} expressions are left untouched
+// so files can also contain Helm templates. Each reference is only resolved once per Renderer
+type Renderer struct {
+	resolver Resolver
+	cache    map[string]string
+}
+
+// NewRenderer creates a renderer resolving references with resolver
+func NewRenderer(resolver Resolver) *Renderer {
+	return &Renderer{
+		resolver: resolver,
+		cache:    map[string]string{},
+	}
+}
+
+// UnresolvedReference is a reference which could not be parsed or resolved
+type UnresolvedReference struct {
+	Reference string
+	// Line is the 1 based line the reference was found on
+	Line int
+	Err  error
+}
+
+// UnresolvedError is returned when any reference could not be resolved, it lists every failed reference rather than
+// only the first
+type UnresolvedError struct {
+	References []UnresolvedReference
+}
+
+func (e *UnresolvedError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "unable to resolve %d secret reference(s):", len(e.References))
+	for _, ref := range e.References {
+		fmt.Fprintf(&sb, "\n  line %d: %s: %s", ref.Line, ref.Reference, ref.Err)
+	}
+	return sb.String()
+}
+
+func (e *UnresolvedError) Unwrap() []error {
+	errs := make([]error, 0, len(e.References))
+	for _, ref := range e.References {
+		errs = append(errs, ref.Err)
+	}
+	return errs
+}
+
+// match is a reference found in text
+type match struct {
+	start, end int
+	reference  string
+}
+
+// Render replaces every reference in text with its value
+func (r *Renderer) Render(ctx context.Context, text string) (string, error) {
+	unresolved := &UnresolvedError{}
+	result := r.render(ctx, text, 1, unresolved)
+	if len(unresolved.References) > 0 {
+		return "", unresolved
+	}
+	return result, nil
+}
+
+// RenderYAML replaces references in the scalar values of every document of a YAML stream. Values are replaced in the
+// parsed documents so secrets containing newlines or YAML syntax are quoted correctly in the output
+func (r *Renderer) RenderYAML(ctx context.Context, data []byte) ([]byte, error) {
+	var docs []*yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		doc := &yaml.Node{}
+		err := decoder.Decode(doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+		docs = append(docs, doc)
+	}
+
+	unresolved := &UnresolvedError{}
+	for _, doc := range docs {
+		r.renderNode(ctx, doc, unresolved)
+	}
+	if len(unresolved.References) > 0 {
+		return nil, unresolved
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, doc := range docs {
+		err := encoder.Encode(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal YAML: %w", err)
+		}
+	}
+	err := encoder.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *Renderer) renderNode(ctx context.Context, node *yaml.Node, unresolved *UnresolvedError) {
+	if node.Kind == yaml.ScalarNode {
+		rendered := r.render(ctx, node.Value, node.Line, unresolved)
+		if rendered != node.Value {
+			node.Value = rendered
+			node.Tag = "!!str"
+			// let the encoder pick a style which can represent the value, such as a literal block for multi-line values
+			node.Style = 0
+		}
+		return
+	}
+	for _, child := range node.Content {
+		r.renderNode(ctx, child, unresolved)
+	}
+}
+
+// render replaces the references in text, adding any failures to unresolved. firstLine is the line text starts on
+func (r *Renderer) render(ctx context.Context, text string, firstLine int, unresolved *UnresolvedError) string {
+	matches := findReferences(text)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		value, err := r.resolve(ctx, m.reference)
+		if err != nil {
+			unresolved.References = append(unresolved.References, UnresolvedReference{
+				Reference: m.reference,
+				Line:      firstLine + strings.Count(text[:m.start], "\n"),
+				Err:       err,
+			})
+			continue
+		}
+		sb.WriteString(text[last:m.start])
+		sb.WriteString(value)
+		last = m.end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+func (r *Renderer) resolve(ctx context.Context, reference string) (string, error) {
+	if value, ok := r.cache[reference]; ok {
+		return value, nil
+	}
+	ref, err := secretref.Parse(reference)
+	if err != nil {
+		return "", err
+	}
+	value, err := r.resolver.ResolveRef(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	r.cache[reference] = value
+	return value, nil
+}
+
+// findReferences returns the references in text ordered by position
+func findReferences(text string) []match {
+	var matches []match
+	for _, loc := range templatePattern.FindAllStringSubmatchIndex(text, -1) {
+		reference := strings.TrimPrefix(text[loc[2]:loc[3]], "ref+")
+		matches = append(matches, match{start: loc[0], end: loc[1], reference: reference})
+	}
+	for _, loc := range refPattern.FindAllStringSubmatchIndex(text, -1) {
+		if !overlaps(matches, loc[0]) {
+			matches = append(matches, match{start: loc[0], end: loc[1], reference: text[loc[2]:loc[3]]})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].start < matches[j].start
+	})
+	return matches
+}
+
+func overlaps(matches []match, pos int) bool {
+	for _, m := range matches {
+		if pos >= m.start && pos < m.end {
+			return true
+		}
+	}
+	return false
+}
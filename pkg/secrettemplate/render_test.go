@@ -0,0 +1,124 @@
+//go:build unit
+// +build unit
+
+package secrettemplate_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretref"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secrettemplate"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingResolver counts the calls made to the underlying resolver
+type countingResolver struct {
+	resolver *secretref.Resolver
+	calls    int
+}
+
+func (c *countingResolver) ResolveRef(ctx context.Context, ref *secretref.Ref) (string, error) {
+	c.calls++
+	return c.resolver.ResolveRef(ctx, ref)
+}
+
+func newResolver(t *testing.T) *countingResolver {
+	factory := &fake.SecretManagerFactory{}
+	mgr, err := factory.NewSecretManager(secretstore.SecretStoreTypeGoogle)
+	require.NoError(t, err)
+	require.NoError(t, mgr.SetSecret("my-project", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{
+			"username": "admin",
+			"password": "p@ss: word",
+			"cert":     "line1\nline2",
+		},
+	}))
+	return &countingResolver{resolver: secretref.NewResolver(factory)}
+}
+
+func TestRender(t *testing.T) {
+	resolver := newResolver(t)
+	renderer := secrettemplate.NewRenderer(resolver)
+
+	text := `user=ref+gsm://my-project/db#username
+pass={{ secret "gsm://my-project/db#password" }}
+again=ref+gsm://my-project/db#username, helm={{ .Values.name }}`
+	result, err := renderer.Render(context.Background(), text)
+
+	require.NoError(t, err)
+	assert.Equal(t, `user=admin
+pass=p@ss: word
+again=admin, helm={{ .Values.name }}`, result)
+	assert.Equal(t, 2, resolver.calls)
+}
+
+func TestRenderReportsEveryUnresolvedReference(t *testing.T) {
+	renderer := secrettemplate.NewRenderer(newResolver(t))
+
+	text := `a: ref+gsm://my-project/db#missing
+b: ref+gsm://my-project/db#username
+c: {{ secret "gsm://my-project/other#key" }}
+d: {{ secret "bogus://x/y" }}`
+	_, err := renderer.Render(context.Background(), text)
+
+	var unresolved *secrettemplate.UnresolvedError
+	require.True(t, errors.As(err, &unresolved))
+	require.Len(t, unresolved.References, 3)
+	assert.Equal(t, "gsm://my-project/db#missing", unresolved.References[0].Reference)
+	assert.Equal(t, 1, unresolved.References[0].Line)
+	assert.ErrorIs(t, unresolved.References[0].Err, secretstore.ErrKeyNotFound)
+	assert.Equal(t, 3, unresolved.References[1].Line)
+	assert.ErrorIs(t, err, secretstore.ErrSecretNotFound)
+	assert.Equal(t, "bogus://x/y", unresolved.References[2].Reference)
+	assert.Contains(t, err.Error(), "line 4: bogus://x/y")
+}
+
+func TestRenderYAML(t *testing.T) {
+	renderer := secrettemplate.NewRenderer(newResolver(t))
+
+	data := []byte(`# database settings
+db:
+  username: ref+gsm://my-project/db#username
+  password: ref+gsm://my-project/db#password
+  cert: '{{ secret "gsm://my-project/db#cert" }}'
+  port: 5432
+`)
+	result, err := renderer.RenderYAML(context.Background(), data)
+
+	require.NoError(t, err)
+	assert.Equal(t, `# database settings
+db:
+  username: admin
+  password: 'p@ss: word'
+  cert: |-
+    line1
+    line2
+  port: 5432
+`, string(result))
+}
+
+func TestRenderYAMLDocuments(t *testing.T) {
+	renderer := secrettemplate.NewRenderer(newResolver(t))
+
+	data := []byte(`a: ref+gsm://my-project/db#username
+---
+b: ref+gsm://my-project/db#password
+`)
+	result, err := renderer.RenderYAML(context.Background(), data)
+
+	require.NoError(t, err)
+	assert.Equal(t, `a: admin
+---
+b: 'p@ss: word'
+`, string(result))
+
+	_, err = renderer.RenderYAML(context.Background(), []byte("a: 1\n---\nb: ref+gsm://my-project/missing#key\n"))
+	var unresolved *secrettemplate.UnresolvedError
+	require.ErrorAs(t, err, &unresolved)
+	assert.Equal(t, 3, unresolved.References[0].Line)
+}
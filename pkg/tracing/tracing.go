@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the OpenTelemetry tracer used for the spans of this library
+const TracerName = "github.com/jenkins-x-plugins/secretfacade"
+
+// Attribute keys set on the spans of secret store operations. Secret values are never recorded
+const (
+	StoreTypeKey  = attribute.Key("secretstore.type")
+	OperationKey  = attribute.Key("secretstore.operation")
+	LocationKey   = attribute.Key("secretstore.location")
+	SecretNameKey = attribute.Key("secretstore.secret_name")
+	SecretKeyKey  = attribute.Key("secretstore.secret_key")
+	VersionKey    = attribute.Key("secretstore.version")
+)
+
+// Options configures tracing. A nil *Options uses the global OpenTelemetry tracer provider
+type Options struct {
+	TracerProvider trace.TracerProvider
+}
+
+func (o *Options) tracer() trace.Tracer {
+	if o == nil || o.TracerProvider == nil {
+		return Tracer()
+	}
+	return o.TracerProvider.Tracer(TracerName)
+}
+
+// Tracer returns the tracer of this library from the global OpenTelemetry tracer provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// Start starts a span with the tracer from the global tracer provider, it is used to trace the steps of
+// authenticating with the secret stores
+func Start(ctx context.Context, spanName string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, spanName, trace.WithAttributes(attributes...))
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware creates a span for every call made to a secret manager named after the operation, e.g.
+// secretstore.GetSecret, recording the store type, location, secret name and key
+func Middleware(options *Options) secretstore.StoreMiddleware {
+	tracer := options.tracer()
+	return func(storeType secretstore.Type) secretstore.Middleware {
+		return secretstore.Intercept(func(ctx context.Context, call *secretstore.Call, invoke func(ctx context.Context) error) error {
+			attributes := []attribute.KeyValue{
+				StoreTypeKey.String(string(storeType)),
+				OperationKey.String(string(call.Operation)),
+				LocationKey.String(call.Location),
+			}
+			if call.SecretName != "" {
+				attributes = append(attributes, SecretNameKey.String(call.SecretName))
+			}
+			if call.SecretKey != "" {
+				attributes = append(attributes, SecretKeyKey.String(call.SecretKey))
+			}
+			if call.Version != "" {
+				attributes = append(attributes, VersionKey.String(call.Version))
+			}
+			ctx, span := tracer.Start(ctx, "secretstore."+string(call.Operation),
+				trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+			err := invoke(ctx)
+			End(span, err)
+			return err
+		})
+	}
+}
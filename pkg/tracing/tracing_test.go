@@ -0,0 +1,64 @@
+//go:build unit
+// +build unit
+
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/tracing"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]string {
+	attrs := map[attribute.Key]string{}
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	return attrs
+}
+
+func TestMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	middleware := tracing.Middleware(&tracing.Options{TracerProvider: provider})
+	mgr := secretstore.Chain(fake.NewFakeSecretStore(), middleware(secretstore.SecretStoreTypeGoogle))
+	ctx := context.Background()
+
+	require.NoError(t, mgr.SetSecretWithContext(ctx, "my-project", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"password": "super-secret"},
+	}))
+	_, err := mgr.GetSecretWithContext(ctx, "my-project", "db", "username")
+	require.ErrorIs(t, err, secretstore.ErrKeyNotFound)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "secretstore.SetSecret", spans[0].Name)
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	assert.Equal(t, map[attribute.Key]string{
+		tracing.StoreTypeKey:  string(secretstore.SecretStoreTypeGoogle),
+		tracing.OperationKey:  "SetSecret",
+		tracing.LocationKey:   "my-project",
+		tracing.SecretNameKey: "db",
+	}, attributes(spans[0]))
+
+	assert.Equal(t, "secretstore.GetSecret", spans[1].Name)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Equal(t, "username", attributes(spans[1])[tracing.SecretKeyKey])
+	require.Len(t, spans[1].Events, 1)
+
+	for _, span := range spans {
+		for _, value := range attributes(span) {
+			assert.NotContains(t, value, "super-secret")
+		}
+	}
+}
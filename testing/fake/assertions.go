@@ -1,8 +1,11 @@
 package fake
 
 import (
+	"context"
 	"testing"
 
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,3 +20,9 @@ func (f SecretStore) AssertValueEquals(t *testing.T, location, secretName, secre
 	assert.NoError(t, err)
 	assert.Equal(t, expectedValue, secret, "value does not match for secret %s and property %s at location %s, expected %s but got %s", secretName, secretKey, location, expectedValue, secret)
 }
+
+func (f SecretStore) AssertSecretNames(t *testing.T, location, prefix string, expectedNames ...string) {
+	names, err := f.ListSecrets(context.Background(), location, &secretstore.ListOptions{Prefix: prefix}).Names()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, expectedNames, names, "secrets listed at location %s with prefix %s do not match", location, prefix)
+}
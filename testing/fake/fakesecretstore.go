@@ -1,27 +1,45 @@
 package fake
 
 import (
-	"fmt"
+	"context"
+	"sort"
+	"strconv"
+	"sync"
 
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
 )
 
 func NewFakeSecretStore() *SecretStore {
-	return &SecretStore{secretStores: map[string]map[string]secretType{}}
+	return &SecretStore{secretStores: map[string]map[string]secretType{}, lock: &sync.RWMutex{}, watches: &watches{}}
 }
 
 type SecretStore struct {
 	secretStores map[string]map[string]secretType
+	lock         *sync.RWMutex
+	watches      *watches
 }
 
 type secretType struct {
 	secretName string
 	values     secretstore.SecretValue
+	version    int
 }
 
 func (f SecretStore) GetSecret(location, secretName, secretKey string) (string, error) {
+	return f.GetSecretWithContext(context.Background(), location, secretName, secretKey)
+}
+
+func (f SecretStore) GetSecretWithContext(ctx context.Context, location, secretName, secretKey string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f.lock.RLock()
+	defer f.lock.RUnlock()
 	store := f.secretStores[location]
-	secret := store[secretName]
+	secret, ok := store[secretName]
+	if !ok {
+		return "", secretstore.NewSecretNotFoundError(location, secretName)
+	}
 	if secretKey == "" {
 		return secret.values.Value, nil
 	}
@@ -30,10 +48,34 @@ func (f SecretStore) GetSecret(location, secretName, secretKey string) (string,
 			return v, nil
 		}
 	}
-	return "", fmt.Errorf("unable to find key %s in secret %s", secretKey, secretName)
+	return "", secretstore.NewKeyNotFoundError(location, secretName, secretKey)
+}
+
+func (f SecretStore) GetSecretValue(ctx context.Context, location, secretName string) (*secretstore.SecretValue, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	secret, ok := f.secretStores[location][secretName]
+	if !ok {
+		return nil, secretstore.NewSecretNotFoundError(location, secretName)
+	}
+	value := secret.values.DeepCopy()
+	value.Version = strconv.Itoa(secret.version)
+	return value, nil
 }
 
 func (f SecretStore) SetSecret(location, secretName string, secretValue *secretstore.SecretValue) error {
+	return f.SetSecretWithContext(context.Background(), location, secretName, secretValue)
+}
+
+func (f SecretStore) SetSecretWithContext(ctx context.Context, location, secretName string, secretValue *secretstore.SecretValue) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
 	var secrets map[string]secretType
 	var ok bool
 	if secrets, ok = f.secretStores[location]; !ok {
@@ -41,10 +83,199 @@ func (f SecretStore) SetSecret(location, secretName string, secretValue *secrets
 		f.secretStores[location] = secrets
 	}
 
+	existing, exists := secrets[secretName]
+	if secretValue.CreateOnly && exists {
+		return secretstore.NewAlreadyExistsError(location, secretName)
+	}
+	if secretValue.ExpectedVersion != "" && (!exists || strconv.Itoa(existing.version) != secretValue.ExpectedVersion) {
+		return secretstore.NewConflictError(location, secretName)
+	}
+	values := secretValue.DeepCopy()
+	values.ExpectedVersion = ""
+	values.CreateOnly = false
+	values.Overwrite = false
+	values.Version = ""
+	// like the real secret stores the properties, labels and annotations are merged in to those of the existing
+	// secret unless overwriting it
+	if exists && !secretValue.Overwrite {
+		if values.Value == "" {
+			values.PropertyValues = merge(existing.values.PropertyValues, values.PropertyValues)
+		}
+		values.Labels = merge(existing.values.Labels, values.Labels)
+		values.Annotations = merge(existing.values.Annotations, values.Annotations)
+		if values.SecretType == "" {
+			values.SecretType = existing.values.SecretType
+		}
+	}
 	secrets[secretName] = secretType{
 		secretName: secretName,
-		values:     *secretValue,
+		values:     *values,
+		version:    existing.version + 1,
+	}
+
+	eventType := secretstore.WatchEventAdded
+	if exists {
+		eventType = secretstore.WatchEventModified
+	}
+	f.watches.notify(secretstore.WatchEvent{
+		Type:       eventType,
+		Location:   location,
+		SecretName: secretName,
+		Version:    strconv.Itoa(existing.version + 1),
+	})
+
+	return nil
+}
+
+func (f SecretStore) ListSecrets(ctx context.Context, location string, options *secretstore.ListOptions) *secretstore.SecretIterator {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	var secrets []secretstore.SecretInfo
+	for name, secret := range f.secretStores[location] {
+		secrets = append(secrets, secretstore.SecretInfo{
+			Name:        name,
+			Labels:      secret.values.Labels,
+			Annotations: secret.values.Annotations,
+		})
 	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Name < secrets[j].Name
+	})
+	return secretstore.NewSecretIterator(ctx, options.GetPrefix(), func(_ context.Context, _ string) ([]secretstore.SecretInfo, string, error) {
+		return secrets, "", nil
+	})
+}
 
+func (f SecretStore) DeleteSecret(ctx context.Context, location, secretName string, _ *secretstore.DeleteOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	secrets := f.secretStores[location]
+	secret, ok := secrets[secretName]
+	if !ok {
+		return secretstore.NewSecretNotFoundError(location, secretName)
+	}
+	delete(secrets, secretName)
+	f.watches.notify(secretstore.WatchEvent{
+		Type:       secretstore.WatchEventDeleted,
+		Location:   location,
+		SecretName: secretName,
+		Version:    strconv.Itoa(secret.version),
+	})
 	return nil
 }
+
+// Watch sends an event for each SetSecret and DeleteSecret of the secret. Events are queued so writes never wait for
+// the watcher to receive them
+func (f SecretStore) Watch(ctx context.Context, location, secretName string, _ *secretstore.WatchOptions) (<-chan secretstore.WatchEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	w := &watch{location: location, secretName: secretName, wake: make(chan struct{}, 1)}
+	f.lock.RLock()
+	if secret, ok := f.secretStores[location][secretName]; ok {
+		w.push(secretstore.WatchEvent{
+			Type:       secretstore.WatchEventAdded,
+			Location:   location,
+			SecretName: secretName,
+			Version:    strconv.Itoa(secret.version),
+		})
+	}
+	f.watches.add(w)
+	f.lock.RUnlock()
+
+	sink := secretstore.NewWatchSink(ctx)
+	go func() {
+		defer sink.Close()
+		defer f.watches.remove(w)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.wake:
+			}
+			for _, event := range w.pop() {
+				sink.Send(event)
+			}
+		}
+	}()
+	return sink.Events(), nil
+}
+
+// watches are the active watches of a SecretStore
+type watches struct {
+	lock    sync.Mutex
+	watches []*watch
+}
+
+func (ws *watches) add(w *watch) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	ws.watches = append(ws.watches, w)
+}
+
+func (ws *watches) remove(w *watch) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	for i := range ws.watches {
+		if ws.watches[i] == w {
+			ws.watches = append(ws.watches[:i], ws.watches[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ws *watches) notify(event secretstore.WatchEvent) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	for _, w := range ws.watches {
+		if w.location == event.Location && w.secretName == event.SecretName {
+			w.push(event)
+		}
+	}
+}
+
+// watch queues the events of a single watch until they are sent
+type watch struct {
+	location   string
+	secretName string
+	wake       chan struct{}
+
+	lock  sync.Mutex
+	queue []secretstore.WatchEvent
+}
+
+func (w *watch) push(event secretstore.WatchEvent) {
+	w.lock.Lock()
+	w.queue = append(w.queue, event)
+	w.lock.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watch) pop() []secretstore.WatchEvent {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	events := w.queue
+	w.queue = nil
+	return events
+}
+
+// merge returns a copy of existing with values added to it
+func merge(existing, values map[string]string) map[string]string {
+	if len(existing) == 0 {
+		return values
+	}
+	merged := make(map[string]string, len(existing)+len(values))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	return merged
+}
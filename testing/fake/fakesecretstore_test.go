@@ -0,0 +1,57 @@
+//go:build unit
+// +build unit
+
+package fake_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetSecretMerges(t *testing.T) {
+	ctx := context.Background()
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("jx", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin"},
+		Labels:         map[string]string{"team": "data"},
+		Annotations:    map[string]string{"owner": "dba"},
+	}))
+	require.NoError(t, store.SetSecret("jx", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"password": "hunter2"},
+		Labels:         map[string]string{"env": "prod"},
+	}))
+
+	value, err := store.GetSecretValue(ctx, "jx", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin", "password": "hunter2"}, value.PropertyValues)
+	assert.Equal(t, map[string]string{"team": "data", "env": "prod"}, value.Labels)
+	assert.Equal(t, map[string]string{"owner": "dba"}, value.Annotations)
+	assert.Equal(t, "2", value.Version)
+}
+
+func TestSetSecretOverwrite(t *testing.T) {
+	ctx := context.Background()
+	store := fake.NewFakeSecretStore()
+	require.NoError(t, store.SetSecret("jx", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin", "legacy": "old"},
+		Labels:         map[string]string{"team": "data", "stale": "true"},
+		Annotations:    map[string]string{"owner": "dba"},
+	}))
+	require.NoError(t, store.SetSecret("jx", "db", &secretstore.SecretValue{
+		PropertyValues: map[string]string{"username": "admin"},
+		Labels:         map[string]string{"team": "data"},
+		Overwrite:      true,
+	}))
+
+	value, err := store.GetSecretValue(ctx, "jx", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": "admin"}, value.PropertyValues)
+	assert.Equal(t, map[string]string{"team": "data"}, value.Labels)
+	assert.Empty(t, value.Annotations)
+	assert.False(t, value.Overwrite)
+}